@@ -2,11 +2,19 @@ module github.com/mailstack/mailstack
 
 go 1.24.0
 
-require github.com/spf13/cobra v1.8.0
+require (
+	github.com/go-sql-driver/mysql v1.8.1
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.32
+	github.com/spf13/cobra v1.8.0
+	golang.org/x/crypto v0.43.0
+	golang.org/x/term v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.32 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
+	golang.org/x/sys v0.37.0 // indirect
 )
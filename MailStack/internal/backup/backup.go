@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/mailstack/mailstack/internal/system"
+)
+
+// timestampFormat names generation directories; it sorts chronologically
+const timestampFormat = "20060102-150405"
+
+// manifestFile lists the files saved in a generation
+const manifestFile = "manifest.json"
+
+// Entry records the state of one file before it was overwritten
+type Entry struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	UID     int         `json:"uid,omitempty"`
+	GID     int         `json:"gid,omitempty"`
+}
+
+// Generation is a set of files backed up together before one write pass
+type Generation struct {
+	Timestamp string
+	dir       string
+	entries   []Entry
+	seen      map[string]bool
+}
+
+// Begin starts a new backup generation under root
+func Begin(root string) (*Generation, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Two runs within the same second get a numeric suffix
+	base := time.Now().UTC().Format(timestampFormat)
+	timestamp := base
+	for n := 1; ; n++ {
+		err := os.Mkdir(filepath.Join(root, timestamp), 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create backup generation: %w", err)
+		}
+		timestamp = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	return &Generation{
+		Timestamp: timestamp,
+		dir:       filepath.Join(root, timestamp),
+		seen:      make(map[string]bool),
+	}, nil
+}
+
+// Save copies the current version of path into the generation. Files that
+// do not exist yet are recorded so that a restore removes them again.
+func (g *Generation) Save(path string) error {
+	if g.seen[path] {
+		return nil
+	}
+	g.seen[path] = true
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		g.entries = append(g.entries, Entry{Path: path})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	dest := filepath.Join(g.dir, path)
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.WriteFile(dest, content, 0600); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+
+	entry := Entry{Path: path, Existed: true, Mode: info.Mode().Perm()}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		entry.UID, entry.GID = int(st.Uid), int(st.Gid)
+	}
+	g.entries = append(g.entries, entry)
+	return nil
+}
+
+// Close writes the generation manifest. A generation that saved nothing is
+// removed instead of being kept around empty.
+func (g *Generation) Close() error {
+	if len(g.entries) == 0 {
+		return os.RemoveAll(g.dir)
+	}
+
+	data, err := json.MarshalIndent(g.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+
+	return system.WriteFile(filepath.Join(g.dir, manifestFile), data, 0600)
+}
+
+// List returns the timestamps of all complete generations, oldest first
+func List(root string) ([]string, error) {
+	dirEntries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var timestamps []string
+	for _, entry := range dirEntries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, entry.Name(), manifestFile)); err == nil {
+			timestamps = append(timestamps, entry.Name())
+		}
+	}
+
+	sort.Strings(timestamps)
+	return timestamps, nil
+}
+
+// Restore puts every file of a generation back in place. Files that did not
+// exist when the generation was taken are removed.
+func Restore(root, timestamp string) ([]Entry, error) {
+	dir := filepath.Join(root, timestamp)
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("backup %s not found: %w", timestamp, err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Existed {
+			if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup of %s: %w", entry.Path, err)
+		}
+		if err := system.WriteFileAs(entry.Path, content, entry.Mode, owner(entry.UID, os.Geteuid()), owner(entry.GID, os.Getegid())); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// owner returns id, or -1 to leave it alone when it is already current's
+func owner(id, current int) int {
+	if id == current {
+		return -1
+	}
+	return id
+}
@@ -0,0 +1,340 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// CSV files making up a dataset, one per record kind
+const (
+	DomainsFile      = "domains.csv"
+	UsersFile        = "users.csv"
+	AliasesFile      = "aliases.csv"
+	DomainAdminsFile = "domain_admins.csv"
+)
+
+var (
+	domainColumns      = []string{"name", "max_users", "max_aliases", "max_quota_bytes", "enabled"}
+	userColumns        = []string{"email", "display_name", "password", "password_hash", "quota_bytes", "enabled", "enable_imap", "enable_pop", "global_admin", "force_password_change"}
+	aliasColumns       = []string{"email", "destination", "enabled", "comment"}
+	domainAdminColumns = []string{"user", "domain"}
+)
+
+// Read loads a dataset from a JSON file, a single CSV file named after its
+// record kind (e.g. users.csv), or a directory of such CSV files
+func Read(path string) (*database.Dataset, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	ds := &database.Dataset{}
+	if info.IsDir() {
+		found := false
+		for _, name := range []string{DomainsFile, UsersFile, AliasesFile, DomainAdminsFile} {
+			file := filepath.Join(path, name)
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				continue
+			}
+			found = true
+			if err := readCSVFile(file, ds); err != nil {
+				return nil, err
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no %s, %s, %s or %s in %s", DomainsFile, UsersFile, AliasesFile, DomainAdminsFile, path)
+		}
+		return ds, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer f.Close()
+
+		decoder := json.NewDecoder(f)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(ds); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		return ds, nil
+	case ".csv":
+		if err := readCSVFile(path, ds); err != nil {
+			return nil, err
+		}
+		return ds, nil
+	default:
+		return nil, fmt.Errorf("unsupported file %s: expected .json, .csv or a directory", path)
+	}
+}
+
+// WriteJSON writes ds as indented JSON
+func WriteJSON(w io.Writer, ds *database.Dataset) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(ds); err != nil {
+		return fmt.Errorf("failed to encode dataset: %w", err)
+	}
+	return nil
+}
+
+// WriteCSVDir writes one CSV file per record kind into dir and returns the
+// files written. The files contain password hashes and are only readable
+// by their owner.
+func WriteCSVDir(dir string, ds *database.Dataset) ([]string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	tables := []struct {
+		name    string
+		columns []string
+		rows    [][]string
+	}{
+		{DomainsFile, domainColumns, nil},
+		{UsersFile, userColumns, nil},
+		{AliasesFile, aliasColumns, nil},
+		{DomainAdminsFile, domainAdminColumns, nil},
+	}
+	for _, d := range ds.Domains {
+		tables[0].rows = append(tables[0].rows, []string{d.Name, itoa(int64(d.MaxUsers)), itoa(int64(d.MaxAliases)), itoa(d.MaxQuota), formatBool(d.Enabled)})
+	}
+	for _, u := range ds.Users {
+		tables[1].rows = append(tables[1].rows, []string{u.Email, database.StringOr(u.DisplayName), "", u.PasswordHash, formatInt(u.Quota),
+			formatBool(u.Enabled), formatBool(u.EnableIMAP), formatBool(u.EnablePOP),
+			strconv.FormatBool(u.GlobalAdmin), strconv.FormatBool(u.ForcePasswordChange)})
+	}
+	for _, a := range ds.Aliases {
+		tables[2].rows = append(tables[2].rows, []string{a.Email, a.Destination, formatBool(a.Enabled), database.StringOr(a.Comment)})
+	}
+	for _, da := range ds.DomainAdmins {
+		tables[3].rows = append(tables[3].rows, []string{da.User, da.Domain})
+	}
+
+	var written []string
+	for _, table := range tables {
+		path := filepath.Join(dir, table.name)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return written, fmt.Errorf("failed to create %s: %w", path, err)
+		}
+
+		w := csv.NewWriter(f)
+		w.Write(table.columns)
+		w.WriteAll(table.rows)
+		if err := w.Error(); err != nil {
+			f.Close()
+			return written, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if err := f.Close(); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+
+	return written, nil
+}
+
+// readCSVFile appends the records of one CSV file to ds. The record kind
+// comes from the file name; columns are matched by header name.
+func readCSVFile(path string, ds *database.Dataset) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	var known []string
+	name := filepath.Base(path)
+	switch name {
+	case DomainsFile:
+		known = domainColumns
+	case UsersFile:
+		known = userColumns
+	case AliasesFile:
+		known = aliasColumns
+	case DomainAdminsFile:
+		known = domainAdminColumns
+	default:
+		return fmt.Errorf("cannot tell what %s contains: name it %s, %s, %s or %s",
+			path, DomainsFile, UsersFile, AliasesFile, DomainAdminsFile)
+	}
+
+	header := make(map[string]int)
+	for i, column := range records[0] {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !contains(known, column) {
+			return fmt.Errorf("%s: unknown column %q (expected %s)", path, column, strings.Join(known, ", "))
+		}
+		header[column] = i
+	}
+	if _, ok := header[known[0]]; !ok {
+		return fmt.Errorf("%s: missing required column %q", path, known[0])
+	}
+
+	for n, record := range records[1:] {
+		row := csvRow{header: header, record: record, where: fmt.Sprintf("%s line %d", path, n+2)}
+
+		switch name {
+		case DomainsFile:
+			d := database.DomainRecord{Name: row.get("name")}
+			d.MaxUsers = int(row.int("max_users"))
+			d.MaxAliases = int(row.int("max_aliases"))
+			d.MaxQuota = row.int("max_quota_bytes")
+			d.Enabled = row.bool("enabled")
+			ds.Domains = append(ds.Domains, d)
+		case UsersFile:
+			u := database.UserRecord{
+				Email:        row.get("email"),
+				DisplayName:  row.stringOrNil("display_name"),
+				Password:     row.get("password"),
+				PasswordHash: row.get("password_hash"),
+				Quota:        row.intOrNil("quota_bytes"),
+				Enabled:      row.bool("enabled"),
+				EnableIMAP:   row.bool("enable_imap"),
+				EnablePOP:    row.bool("enable_pop"),
+
+				GlobalAdmin:         isTrue(row.bool("global_admin")),
+				ForcePasswordChange: isTrue(row.bool("force_password_change")),
+			}
+			ds.Users = append(ds.Users, u)
+		case AliasesFile:
+			ds.Aliases = append(ds.Aliases, database.AliasRecord{
+				Email:       row.get("email"),
+				Destination: row.get("destination"),
+				Enabled:     row.bool("enabled"),
+				Comment:     row.stringOrNil("comment"),
+			})
+		case DomainAdminsFile:
+			ds.DomainAdmins = append(ds.DomainAdmins, database.DomainAdminRecord{
+				User:   row.get("user"),
+				Domain: row.get("domain"),
+			})
+		}
+
+		if row.err != nil {
+			return row.err
+		}
+	}
+
+	return nil
+}
+
+// csvRow reads typed fields from one CSV record, keeping the first error
+type csvRow struct {
+	header map[string]int
+	record []string
+	where  string
+	err    error
+}
+
+func (r *csvRow) get(column string) string {
+	i, ok := r.header[column]
+	if !ok || i >= len(r.record) {
+		return ""
+	}
+	return strings.TrimSpace(r.record[i])
+}
+
+func (r *csvRow) int(column string) int64 {
+	value := r.get(column)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("%s: invalid %s %q", r.where, column, value)
+	}
+	return n
+}
+
+// stringOrNil returns nil for an empty field so that the default applies
+func (r *csvRow) stringOrNil(column string) *string {
+	value := r.get(column)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// intOrNil returns nil for an empty field so that the default applies
+func (r *csvRow) intOrNil(column string) *int64 {
+	if r.get(column) == "" {
+		return nil
+	}
+	n := r.int(column)
+	return &n
+}
+
+// bool returns nil for an empty field so that the default applies
+func (r *csvRow) bool(column string) *bool {
+	value := strings.ToLower(r.get(column))
+	switch value {
+	case "":
+		return nil
+	case "yes", "y", "on":
+		value = "true"
+	case "no", "n", "off":
+		value = "false"
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		if r.err == nil {
+			r.err = fmt.Errorf("%s: invalid %s %q", r.where, column, value)
+		}
+		return nil
+	}
+	return &b
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+func formatInt(n *int64) string {
+	if n == nil {
+		return ""
+	}
+	return itoa(*n)
+}
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
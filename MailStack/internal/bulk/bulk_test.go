@@ -0,0 +1,105 @@
+package bulk
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/database/databasetest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, dir string, ds *database.Dataset) string
+	}{
+		{
+			name: "csv directory",
+			write: func(t *testing.T, dir string, ds *database.Dataset) string {
+				if _, err := WriteCSVDir(dir, ds); err != nil {
+					t.Fatalf("WriteCSVDir: %v", err)
+				}
+				return dir
+			},
+		},
+		{
+			name: "json",
+			write: func(t *testing.T, dir string, ds *database.Dataset) string {
+				var buf bytes.Buffer
+				if err := WriteJSON(&buf, ds); err != nil {
+					t.Fatalf("WriteJSON: %v", err)
+				}
+				path := filepath.Join(dir, "export.json")
+				if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+					t.Fatal(err)
+				}
+				return path
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Like an export, with hashes rather than passwords
+			want := databasetest.Dataset()
+			for i := range want.Users {
+				want.Users[i].Password = ""
+				want.Users[i].PasswordHash = fmt.Sprintf("$2a$10$abcdefghijklmnopqrstuuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ%02d", i)
+			}
+			path := tt.write(t, t.TempDir(), want)
+
+			got, err := Read(path)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Read returned\n %+v\nwant\n %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadCSVDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want database.UserRecord
+	}{
+		{
+			name: "left-out columns",
+			csv:  "email,password\nalice@example.com,secret\n",
+			want: database.UserRecord{Email: "alice@example.com", Password: "secret"},
+		},
+		{
+			name: "empty fields",
+			csv:  "email,password,quota_bytes,enabled,global_admin\nalice@example.com,secret,,,\n",
+			want: database.UserRecord{Email: "alice@example.com", Password: "secret"},
+		},
+		{
+			name: "yes and no",
+			csv:  "email,password,quota_bytes,enabled,enable_pop\nalice@example.com,secret,0,no,yes\n",
+			want: database.UserRecord{Email: "alice@example.com", Password: "secret", Quota: database.Ptr(int64(0)), Enabled: database.Ptr(false), EnablePOP: database.Ptr(true)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), UsersFile)
+			if err := os.WriteFile(path, []byte(tt.csv), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			ds, err := Read(path)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if len(ds.Users) != 1 || !reflect.DeepEqual(ds.Users[0], tt.want) {
+				t.Errorf("Read returned %+v, want [%+v]", ds.Users, tt.want)
+			}
+		})
+	}
+}
@@ -5,26 +5,32 @@ import (
 
 	"github.com/mailstack/mailstack/internal/config"
 	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/output"
 	"github.com/spf13/cobra"
 )
 
 func aliasCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "alias",
-		Short: "Manage email aliases",
-		Long:  `Create, delete, and list email aliases and forwarding rules.`,
+		Use:         "alias",
+		Short:       "Manage email aliases",
+		Annotations: delegable,
+		Long:        `Create, delete, and list email aliases and forwarding rules.`,
 	}
 
 	cmd.AddCommand(aliasAddCmd())
 	cmd.AddCommand(aliasDeleteCmd())
 	cmd.AddCommand(aliasListCmd())
 	cmd.AddCommand(aliasShowCmd())
+	cmd.AddCommand(aliasTestCmd())
+	cmd.AddCommand(aliasUpdateCmd())
 
 	return cmd
 }
 
 func aliasAddCmd() *cobra.Command {
-	return &cobra.Command{
+	var comment string
+
+	cmd := &cobra.Command{
 		Use:   "add <alias-email> <destination>",
 		Short: "Add a new email alias",
 		Long: `Add a new email alias that forwards to one or more destinations.
@@ -32,7 +38,13 @@ func aliasAddCmd() *cobra.Command {
 Examples:
   mailstack alias add sales@example.com john@example.com
   mailstack alias add support@example.com john@example.com,jane@example.com
-  mailstack alias add info@example.com external@gmail.com`,
+  mailstack alias add info@example.com external@gmail.com
+
+Wildcards: "%" in the local part matches any characters, and "@domain" is
+a catch-all for the domain. Users and exact aliases always win over
+wildcards, and a longer pattern wins over a shorter one:
+  mailstack alias add 'sales-%@example.com' sales@example.com
+  mailstack alias add @example.com postmaster@example.com`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			email := args[0]
@@ -43,21 +55,25 @@ Examples:
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
 			defer db.Close()
 
-			if err := db.AddAlias(email, destination); err != nil {
+			if err := db.AddAlias(email, destination, comment); err != nil {
 				return fmt.Errorf("failed to add alias: %w", err)
 			}
 
-			fmt.Printf("✅ Alias %s added successfully\n", email)
-			fmt.Printf("   Forwards to: %s\n", destination)
+			printer().Infof("✅ Alias %s added successfully\n", email)
+			printer().Infof("   Forwards to: %s\n", destination)
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&comment, "comment", "", "note on what the alias is for")
+
+	return cmd
 }
 
 func aliasDeleteCmd() *cobra.Command {
@@ -73,7 +89,7 @@ func aliasDeleteCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
@@ -83,7 +99,7 @@ func aliasDeleteCmd() *cobra.Command {
 				return fmt.Errorf("failed to delete alias: %w", err)
 			}
 
-			fmt.Printf("✅ Alias %s deleted successfully\n", email)
+			printer().Infof("✅ Alias %s deleted successfully\n", email)
 			return nil
 		},
 	}
@@ -99,7 +115,7 @@ func aliasListCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
@@ -110,21 +126,12 @@ func aliasListCmd() *cobra.Command {
 				return err
 			}
 
-			if len(aliases) == 0 {
-				fmt.Println("No aliases configured")
-				return nil
-			}
-
-			fmt.Println("📧 Email Aliases:")
+			view := output.List("📧 Email Aliases:", "email", "destination", "enabled", "comment")
+			view.Empty = "No aliases configured"
 			for _, alias := range aliases {
-				status := "✅"
-				if !alias.Enabled {
-					status = "❌"
-				}
-				fmt.Printf("  %s %s → %s\n", status, alias.Email, alias.Destination)
+				view.Row(alias.Email, alias.Destination, yesNo(alias.Enabled), alias.Comment)
 			}
-
-			return nil
+			return printer().Print(aliases, view)
 		},
 	}
 }
@@ -142,7 +149,7 @@ func aliasShowCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
@@ -153,11 +160,116 @@ func aliasShowCmd() *cobra.Command {
 				return err
 			}
 
-			fmt.Printf("📧 Alias: %s\n", alias.Email)
-			fmt.Printf("   Destination: %s\n", alias.Destination)
-			fmt.Printf("   Enabled: %v\n", alias.Enabled)
+			view := output.Record("📧 Alias: "+alias.Email).
+				Field("email", alias.Email).
+				Field("destination", alias.Destination).
+				Field("enabled", yesNo(alias.Enabled)).
+				Field("comment", alias.Comment)
+			return printer().Print(alias, view)
+		},
+	}
+}
+
+func aliasUpdateCmd() *cobra.Command {
+	var destination, comment string
+	var addDest, removeDest []string
+	var enabled bool
+
+	cmd := &cobra.Command{
+		Use:   "update <alias-email>",
+		Short: "Change an alias's destinations, state or comment",
+		Long: `Change an alias. Only the flags given are changed, e.g.
+
+  mailstack alias update sales@example.com --add-dest jane@example.com
+  mailstack alias update sales@example.com --remove-dest john@example.com
+  mailstack alias update sales@example.com --enabled=false
+  mailstack alias update sales@example.com --comment "Sales team"
+
+Changes that would make mail loop back to the alias through other
+aliases are refused.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			update := database.AliasUpdate{
+				AddDestinations:    addDest,
+				RemoveDestinations: removeDest,
+			}
+			flags := cmd.Flags()
+			if flags.Changed("destination") {
+				update.Destination = &destination
+			}
+			if flags.Changed("enabled") {
+				update.Enabled = &enabled
+			}
+			if flags.Changed("comment") {
+				update.Comment = &comment
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.UpdateAlias(email, update); err != nil {
+				return fmt.Errorf("failed to update alias: %w", err)
+			}
 
+			printer().Infof("✅ Alias %s updated successfully\n", email)
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&destination, "destination", "", "replace all destinations (comma-separated)")
+	cmd.Flags().StringSliceVar(&addDest, "add-dest", nil, "add destination addresses")
+	cmd.Flags().StringSliceVar(&removeDest, "remove-dest", nil, "remove destination addresses")
+	cmd.Flags().BoolVar(&enabled, "enabled", true, "forward mail for the alias")
+	cmd.Flags().StringVar(&comment, "comment", "", "note on what the alias is for")
+
+	return cmd
+}
+
+func aliasTestCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "test <address>",
+		Short: "Show which user or alias receives mail for an address",
+		Long: `Show which rule postfix uses to deliver mail for an address: the user
+itself, an exact alias or the most specific wildcard alias. Exits with
+status 3 when nothing receives mail for the address.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			match, err := db.ResolveAlias(address, cfg.Mail.RecipientDelimiter)
+			if err != nil {
+				return err
+			}
+
+			view := output.Record("📬 "+match.Address).
+				Field("address", match.Address).
+				Field("key", match.Key).
+				Field("via", match.Via).
+				Field("kind", match.Kind).
+				Field("rule", match.Rule).
+				Field("destination", match.Destination)
+			return printer().Print(match, view)
+		},
+	}
 }
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/output"
+	"github.com/mailstack/mailstack/internal/state"
+	"github.com/spf13/cobra"
+)
+
+func applyCmd() *cobra.Command {
+	var file string
+	var prune, dryRun, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "apply -f state.yaml",
+		Short: "Reconcile domains, users, aliases, relays and DKIM keys with a state file",
+		Long: `Reconcile the database with a declarative state file: create what is
+missing, update what differs and, with --prune, delete what is not listed.
+The plan is printed first and applied in a single transaction.
+
+Example state.yaml:
+
+  domains:
+    - name: example.com
+      max_users: 50
+      dkim_selectors: [dkim]
+  users:
+    - email: alice@example.com
+      display_name: Alice
+      password_hash: "{BLF-CRYPT}$2y$10$..."
+      quota_bytes: 2000000000
+  aliases:
+    - email: info@example.com
+      destination: alice@example.com
+  relays:
+    - name: example.org
+      nexthop: smtp:mx1.example.org:25
+
+A plain "password" is only used to create a user; use password_hash to
+manage existing passwords. Left-out enabled flags and user quota_bytes
+keep their current value. Pruning never removes mail directories; it
+removes the DKIM keys of pruned domains, while the keys of listed domains
+are only managed when they list dkim_selectors.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			st, err := state.Load(file)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			db.SetPasswordPolicy(cfg.PasswordPolicy)
+
+			plan, err := state.Compute(db, cfg, st, prune)
+			if err != nil {
+				return fmt.Errorf("failed to plan: %w", err)
+			}
+
+			create, update, remove := plan.Counts()
+			if create+update+remove == 0 {
+				printer().Infof("✅ No changes. The database matches the state file.\n")
+				return nil
+			}
+			if err := printPlan(plan); err != nil {
+				return err
+			}
+			if dryRun {
+				return nil
+			}
+
+			if !yes {
+				ok, err := confirm("\nApply these changes?", "yes")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("aborted")
+				}
+			}
+
+			if err := plan.Apply(db); err != nil {
+				return fmt.Errorf("failed to apply: %w", err)
+			}
+
+			printer().Infof("\n✅ Apply complete: %d added, %d changed, %d destroyed\n", create, update, remove)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "state file (YAML or JSON)")
+	cmd.Flags().BoolVar(&prune, "prune", false, "delete domains, users, aliases, relays and DKIM keys not in the state file")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the plan without applying it")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "apply without asking for confirmation")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+// printPlan lists the changes Terraform-style, or as a list of changes in
+// the machine formats
+func printPlan(plan *state.Plan) error {
+	p := printer()
+	if p.Format.Machine() {
+		view := output.List("📋 Plan:", "action", "kind", "name", "details")
+		for _, change := range plan.Changes {
+			view.Row(string(change.Action), change.Kind, change.Name, strings.Join(change.Details, "; "))
+		}
+		if err := p.Print(plan.Changes, view); err != nil {
+			return err
+		}
+	} else {
+		p.Infof("📋 Plan:\n")
+		for _, change := range plan.Changes {
+			p.Infof("  %s %s %s\n", change.Action, change.Kind, change.Name)
+			for _, detail := range change.Details {
+				p.Infof("        %s\n", detail)
+			}
+		}
+	}
+	if len(plan.Unmanaged) > 0 {
+		p.Infof("\n  %d record(s) not in the state file are kept (use --prune to delete them)\n", len(plan.Unmanaged))
+	}
+
+	create, update, remove := plan.Counts()
+	p.Infof("\nPlan: %d to add, %d to change, %d to destroy.\n", create, update, remove)
+	return nil
+}
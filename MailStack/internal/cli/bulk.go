@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/mailstack/mailstack/internal/bulk"
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/output"
+	"github.com/spf13/cobra"
+)
+
+func importCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "import <file.json|file.csv|directory>",
+		Short: "Import domains, users, aliases and domain admins",
+		Long: `Import domains, users, aliases and domain admins from a JSON file, a CSV
+file or a directory of CSV files (domains.csv, users.csv, aliases.csv,
+domain_admins.csv) as written by 'mailstack export'.
+
+Every record is validated before anything is written, and everything is
+created in a single transaction. Users need either a password, which must
+satisfy the password policy, or a password_hash in BLF-CRYPT or
+SHA512-CRYPT format, which is imported as-is.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			ds, err := bulk.Read(args[0])
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			db.SetPasswordPolicy(cfg.PasswordPolicy)
+
+			var report *database.ImportReport
+			if dryRun {
+				report, err = db.ValidateImport(ds)
+				if err != nil {
+					return err
+				}
+			} else {
+				report, err = db.Import(ds)
+				if report == nil {
+					return err
+				}
+			}
+
+			view := output.Record(fmt.Sprintf("📥 Import of %s:", args[0])).
+				Field("domains", strconv.Itoa(report.Domains)).
+				Field("users", strconv.Itoa(report.Users)).
+				Field("aliases", strconv.Itoa(report.Aliases)).
+				Field("domain_admins", strconv.Itoa(report.DomainAdmins)).
+				Field("unchanged", strconv.Itoa(report.Unchanged))
+			if perr := printer().Print(report, view); perr != nil {
+				return perr
+			}
+
+			if verr := report.Err(); verr != nil {
+				printer().Infof("\n")
+				return fmt.Errorf("nothing was imported: %w", verr)
+			}
+			if err != nil {
+				return err
+			}
+
+			if dryRun {
+				printer().Infof("\n✅ Dry run: all records are valid, nothing was written\n")
+			} else {
+				printer().Infof("\n✅ Import completed\n")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "validate and report without writing anything")
+
+	return cmd
+}
+
+func exportCmd() *cobra.Command {
+	var format, dest string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export domains, users, aliases and domain admins",
+		Long: `Export domains, users, aliases and domain admins, including password
+hashes, for use with 'mailstack import'.
+
+JSON goes to stdout or to --dest. CSV needs --dest, a directory that
+receives domains.csv, users.csv, aliases.csv and domain_admins.csv.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			ds, err := db.Export()
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case "json":
+				if dest == "" {
+					return bulk.WriteJSON(os.Stdout, ds)
+				}
+				f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+				if err != nil {
+					return fmt.Errorf("failed to create %s: %w", dest, err)
+				}
+				defer f.Close()
+				if err := bulk.WriteJSON(f, ds); err != nil {
+					return err
+				}
+				printer().Infof("✅ Exported to %s\n", dest)
+
+			case "csv":
+				if dest == "" {
+					return fmt.Errorf("CSV export needs --dest <directory>")
+				}
+				files, err := bulk.WriteCSVDir(dest, ds)
+				if err != nil {
+					return err
+				}
+				for _, file := range files {
+					printer().Infof("✅ Exported %s\n", file)
+				}
+
+			default:
+				return fmt.Errorf("unsupported format %q (use json or csv)", format)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "json", "export format: json or csv")
+	cmd.Flags().StringVar(&dest, "dest", "", "file (json) or directory (csv) to write to")
+
+	return cmd
+}
@@ -2,8 +2,13 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/mailstack/mailstack/internal/backup"
 	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/output"
+	"github.com/mailstack/mailstack/internal/templates"
 	"github.com/spf13/cobra"
 )
 
@@ -17,6 +22,8 @@ func configCmd() *cobra.Command {
 	cmd.AddCommand(configValidateCmd())
 	cmd.AddCommand(configRegenerateCmd())
 	cmd.AddCommand(configShowCmd())
+	cmd.AddCommand(configRollbackCmd())
+	cmd.AddCommand(configSourcesCmd())
 
 	return cmd
 }
@@ -35,28 +42,243 @@ func configValidateCmd() *cobra.Command {
 				return fmt.Errorf("configuration is invalid: %w", err)
 			}
 
-			fmt.Println("✅ Configuration is valid")
+			printer().Infof("✅ Configuration is valid\n")
 			return nil
 		},
 	}
 }
 
 func configRegenerateCmd() *cobra.Command {
-	return &cobra.Command{
+	var dryRun bool
+	var stagingDir string
+
+	cmd := &cobra.Command{
 		Use:   "regenerate",
 		Short: "Regenerate all service configuration files",
+		Long: `Render every enabled template from the current configuration, rebuild
+the postfix LMDB maps and reload the services whose files changed.
+
+With --dry-run the files are rendered into a staging directory instead and
+a unified diff against the installed files is printed. The command exits
+non-zero when any installed file has drifted from its rendered version.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, err := config.Load(cfgFile)
+			if dryRun {
+				cfg, err := config.Load(cfgFile)
+				if err != nil {
+					return err
+				}
+				return showConfigDrift(cmd, cfg, stagingDir)
+			}
+
+			if err := requireRoot("regenerating configuration"); err != nil {
+				return err
+			}
+
+			cfg, err := config.Load(cfgFile)
 			if err != nil {
 				return err
 			}
 
-			fmt.Println("🔄 Regenerating configuration files...")
-			// TODO: Implement regeneration logic
-			fmt.Println("✅ Configuration files regenerated")
+			if err := cfg.Validate(); err != nil {
+				return fmt.Errorf("configuration is invalid: %w", err)
+			}
+
+			printer().Infof("🔄 Regenerating configuration files...\n")
+			result, err := newInstaller(cfg, verbose).Regenerate()
+			if err != nil {
+				return fmt.Errorf("failed to regenerate configuration: %w", err)
+			}
+
+			for _, service := range result.Skipped {
+				printer().Infof("⏭️  %s configuration check skipped (checker not installed)\n", service)
+			}
+			if len(result.Changed) == 0 {
+				printer().Infof("✅ Configuration files are already up to date\n")
+				return nil
+			}
+
+			printer().Infof("✅ %d configuration file(s) regenerated\n", len(result.Changed))
+			printer().Infof("💾 Previous files saved as backup %s\n", result.Backup)
+			if len(result.Reloaded) > 0 {
+				printer().Infof("🔁 Reloaded: %s\n", strings.Join(result.Reloaded, ", "))
+			}
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "render into a staging directory and show a diff instead of writing")
+	cmd.Flags().StringVar(&stagingDir, "staging-dir", "", "staging directory for --dry-run (default: a new temporary directory)")
+
+	return cmd
+}
+
+// showConfigDrift renders the configuration into a staging directory and
+// prints a unified diff against the installed files. It returns an error if
+// any file differs so that scripts and CI can detect drift.
+func showConfigDrift(cmd *cobra.Command, cfg *config.Config, stagingDir string) error {
+	if stagingDir == "" {
+		dir, err := os.MkdirTemp("", "mailstack-staging-")
+		if err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		stagingDir = dir
+	}
+
+	inst := newInstaller(cfg, verbose)
+	staged, err := inst.Plan(stagingDir)
+	if err != nil {
+		return fmt.Errorf("failed to render configuration: %w", err)
+	}
+
+	drifted := 0
+	for _, file := range staged {
+		if !file.Changed {
+			continue
+		}
+		drifted++
+
+		if file.Source != nil && (file.Source.Origin != "embedded" || len(file.Source.Snippets) > 0) {
+			printer().Infof("# %s rendered from %s", file.Output, file.Source.Origin)
+			if len(file.Source.Snippets) > 0 {
+				printer().Infof(" + %s", strings.Join(file.Source.Snippets, ", "))
+			}
+			printer().Infof("\n")
+		}
+
+		diff, err := file.Diff()
+		if err != nil {
+			return err
+		}
+		printer().Infof("%s", diff)
+	}
+
+	printer().Infof("\n📂 Rendered files staged in %s\n", stagingDir)
+
+	checksFailed := 0
+	results := inst.Preflight(staged, stagingDir)
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			printer().Infof("⏭️  %s check skipped (%s not installed)\n", result.Service, strings.Fields(result.Command)[0])
+		case result.Err != nil:
+			checksFailed++
+			printer().Infof("❌ %v\n   $ %s\n%s\n", result.Err, result.Command, result.Output)
+		default:
+			printer().Infof("✅ %s configuration check passed\n", result.Service)
+		}
+	}
+
+	if len(results) > 0 {
+		printer().Infof("ℹ️  Checks read files mailstack does not render (mime.types, conf.d, /overrides) from the system\n")
+	}
+
+	if checksFailed > 0 {
+		return fmt.Errorf("%d pre-flight check(s) failed", checksFailed)
+	}
+
+	if drifted == 0 {
+		printer().Infof("✅ No drift: installed files match the rendered configuration\n")
+		return nil
+	}
+
+	return fmt.Errorf("configuration drift detected in %d of %d file(s)", drifted, len(staged))
+}
+
+func configRollbackCmd() *cobra.Command {
+	var list bool
+
+	cmd := &cobra.Command{
+		Use:   "rollback [timestamp]",
+		Short: "Restore configuration files from a backup",
+		Long: `Restore a whole generation of configuration files saved before a
+regenerate or install, then reload the affected services. Without a
+timestamp the most recent backup is restored.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			if list {
+				generations, err := backup.List(cfg.Paths.Backups)
+				if err != nil {
+					return err
+				}
+				view := output.List("💾 Configuration Backups:", "timestamp")
+				view.Empty = "No configuration backups found"
+				for _, timestamp := range generations {
+					view.Row(timestamp)
+				}
+				return printer().Print(generations, view)
+			}
+
+			if err := requireRoot("rolling back configuration"); err != nil {
+				return err
+			}
+
+			timestamp := ""
+			if len(args) == 1 {
+				timestamp = args[0]
+			}
+
+			result, err := newInstaller(cfg, verbose).Rollback(timestamp)
+			if err != nil {
+				return fmt.Errorf("failed to roll back configuration: %w", err)
+			}
+
+			printer().Infof("✅ Restored %d file(s) from backup %s\n", len(result.Changed), result.Backup)
+			if len(result.Reloaded) > 0 {
+				printer().Infof("🔁 Reloaded: %s\n", strings.Join(result.Reloaded, ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&list, "list", "l", false, "list available backups")
+
+	return cmd
+}
+
+func configSourcesCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sources",
+		Short: "Show which template or override each config file came from",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			sources, err := templates.LoadSources(templates.SourcesPath(cfg))
+			if err != nil {
+				return err
+			}
+
+			type configSource struct {
+				Output   string   `json:"output"`
+				Origin   string   `json:"origin"`
+				Snippets []string `json:"snippets"`
+			}
+			var result []configSource
+			view := output.List("📄 Configuration Sources:", "output", "origin", "snippets")
+			for _, target := range templates.Manifest(cfg) {
+				entry := configSource{Output: target.Output, Snippets: []string{}}
+				if source, ok := sources[target.Output]; ok && source != nil {
+					entry.Origin = source.Origin
+					entry.Snippets = append(entry.Snippets, source.Snippets...)
+				}
+				result = append(result, entry)
+
+				origin := entry.Origin
+				if origin == "" {
+					origin = "(not rendered yet)"
+				}
+				view.Row(entry.Output, origin, strings.Join(entry.Snippets, " + "))
+			}
+			return printer().Print(result, view)
+		},
+	}
 }
 
 func configShowCmd() *cobra.Command {
@@ -69,14 +291,28 @@ func configShowCmd() *cobra.Command {
 				return err
 			}
 
-			fmt.Printf("📋 Current Configuration:\n\n")
-			fmt.Printf("Domain:       %s\n", cfg.Domain)
-			fmt.Printf("Hostname:     %s\n", cfg.Hostname)
-			fmt.Printf("Database:     %s (%s)\n", cfg.Database.Type, cfg.Database.Path)
-			fmt.Printf("TLS:          %s\n", cfg.TLS.Flavor)
-			fmt.Printf("Admin Email:  %s\n", cfg.Admin.Email)
+			// Secrets such as passwords and keys are never shown
+			summary := struct {
+				Domain     string `json:"domain"`
+				Hostname   string `json:"hostname"`
+				Database   string `json:"database"`
+				DBPath     string `json:"database_path,omitempty"`
+				DBHost     string `json:"database_host,omitempty"`
+				TLS        string `json:"tls"`
+				AdminEmail string `json:"admin_email"`
+			}{cfg.Domain, cfg.Hostname, cfg.Database.Type, cfg.Database.Path, cfg.Database.Host, cfg.TLS.Flavor, cfg.Admin.Email}
 
-			return nil
+			location := summary.DBPath
+			if location == "" {
+				location = summary.DBHost
+			}
+			view := output.Record("📋 Current Configuration:").
+				Field("domain", summary.Domain).
+				Field("hostname", summary.Hostname).
+				Field("database", fmt.Sprintf("%s (%s)", summary.Database, location)).
+				Field("TLS", summary.TLS).
+				Field("admin_email", summary.AdminEmail)
+			return printer().Print(summary, view)
 		},
 	}
 }
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/output"
+	"github.com/spf13/cobra"
+)
+
+func dbCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the database schema",
+		Long:  `Apply, inspect, and roll back database schema migrations.`,
+	}
+
+	cmd.AddCommand(dbMigrateCmd())
+	cmd.AddCommand(dbStatusCmd())
+	cmd.AddCommand(dbRollbackCmd())
+
+	return cmd
+}
+
+func dbMigrateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply pending schema migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			applied, err := db.Migrate()
+			if err != nil {
+				return err
+			}
+
+			if applied == 0 {
+				printer().Infof("✅ Database schema is up to date\n")
+				return nil
+			}
+
+			printer().Infof("✅ Applied %d migration(s)\n", applied)
+			return nil
+		},
+	}
+}
+
+func dbStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show schema migration status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			status, err := db.MigrationStatus()
+			if err != nil {
+				return err
+			}
+
+			view := output.List(fmt.Sprintf("🗄️  Schema Migrations (%s):", db.Type()), "version", "name", "state", "applied_at")
+			for _, m := range status {
+				if m.Applied {
+					view.Row(strconv.Itoa(m.Version), m.Name, "applied", m.AppliedAt.Format("2006-01-02 15:04:05"))
+				} else {
+					view.Row(strconv.Itoa(m.Version), m.Name, "pending", "")
+				}
+			}
+			return printer().Print(status, view)
+		},
+	}
+}
+
+func dbRollbackCmd() *cobra.Command {
+	var steps int
+
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Revert the most recent schema migrations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if steps < 1 {
+				return fmt.Errorf("--steps must be at least 1")
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			reverted, err := db.Rollback(steps)
+			if err != nil {
+				return err
+			}
+
+			printer().Infof("✅ Rolled back %d migration(s)\n", reverted)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&steps, "steps", "n", 1, "number of migrations to roll back")
+
+	return cmd
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/mailstack/mailstack/internal/config"
 	"github.com/mailstack/mailstack/internal/dkim"
+	"github.com/mailstack/mailstack/internal/output"
 	"github.com/spf13/cobra"
 )
 
@@ -42,12 +43,10 @@ func dkimGenerateCmd() *cobra.Command {
 				return fmt.Errorf("failed to generate DKIM key: %w", err)
 			}
 
-			fmt.Printf("✅ DKIM key generated successfully\n")
-			fmt.Printf("📁 Key saved to: %s\n\n", keyPath)
-			fmt.Println("📝 Add this TXT record to your DNS:")
-			fmt.Printf("   %s._domainkey.%s IN TXT \"%s\"\n", selector, domain, dnsRecord)
-
-			return nil
+			printer().Infof("✅ DKIM key generated successfully\n")
+			printer().Infof("📁 Key saved to: %s\n\n", keyPath)
+			record := dkimRecord{Domain: domain, Selector: selector, KeyPath: keyPath, Value: dnsRecord}
+			return printer().Print(record, record.view("📝 Add this TXT record to your DNS:"))
 		},
 	}
 
@@ -77,10 +76,8 @@ func dkimShowCmd() *cobra.Command {
 				return fmt.Errorf("failed to read DKIM key: %w", err)
 			}
 
-			fmt.Println("📝 DKIM DNS TXT record:")
-			fmt.Printf("   %s._domainkey.%s IN TXT \"%s\"\n", selector, domain, dnsRecord)
-
-			return nil
+			record := dkimRecord{Domain: domain, Selector: selector, Value: dnsRecord}
+			return printer().Print(record, record.view("📝 DKIM DNS TXT record:"))
 		},
 	}
 
@@ -88,3 +85,18 @@ func dkimShowCmd() *cobra.Command {
 
 	return cmd
 }
+
+// dkimRecord is the DNS TXT record publishing the public key of a domain
+type dkimRecord struct {
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+	KeyPath  string `json:"key_path,omitempty"`
+	Value    string `json:"value"`
+}
+
+func (r dkimRecord) view(title string) *output.View {
+	return output.Record(title).
+		Field("name", r.Selector+"._domainkey."+r.Domain).
+		Field("type", "TXT").
+		Field("value", `"`+r.Value+`"`)
+}
@@ -2,22 +2,30 @@ package cli
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/mailstack/mailstack/internal/config"
 	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/dkim"
+	"github.com/mailstack/mailstack/internal/mailbox"
+	"github.com/mailstack/mailstack/internal/output"
 	"github.com/spf13/cobra"
 )
 
 func domainCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "domain",
-		Short: "Manage mail domains",
-		Long:  `Add, remove, and list mail domains.`,
+		Use:         "domain",
+		Short:       "Manage mail domains",
+		Annotations: delegable,
+		Long:        `Add, remove, and list mail domains.`,
 	}
 
 	cmd.AddCommand(domainAddCmd())
 	cmd.AddCommand(domainDeleteCmd())
 	cmd.AddCommand(domainListCmd())
+	cmd.AddCommand(domainUpdateCmd())
+	cmd.AddCommand(domainAlternativeCmd())
+	cmd.AddCommand(domainAdminCmd())
 
 	return cmd
 }
@@ -35,7 +43,7 @@ func domainAddCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
@@ -45,20 +53,25 @@ func domainAddCmd() *cobra.Command {
 				return fmt.Errorf("failed to add domain: %w", err)
 			}
 
-			fmt.Printf("✅ Domain %s added successfully\n", domain)
-			fmt.Println("\n📝 Don't forget to:")
-			fmt.Printf("  1. Add DNS records (MX, SPF, DKIM, DMARC)\n")
-			fmt.Printf("  2. Generate DKIM keys: mailstack dkim generate %s\n", domain)
+			printer().Infof("✅ Domain %s added successfully\n", domain)
+			printer().Infof("\n📝 Don't forget to:\n")
+			printer().Infof("  1. Add DNS records (MX, SPF, DKIM, DMARC)\n")
+			printer().Infof("  2. Generate DKIM keys: mailstack dkim generate %s\n", domain)
 			return nil
 		},
 	}
 }
 
 func domainDeleteCmd() *cobra.Command {
-	return &cobra.Command{
+	var cascade, archive, yes bool
+
+	cmd := &cobra.Command{
 		Use:   "delete <domain>",
 		Short: "Delete a mail domain",
-		Args:  cobra.ExactArgs(1),
+		Long: `Delete a mail domain. The domain must have no users, aliases or domain
+admins unless --cascade is given, which also removes them along with its DKIM
+keys and mail directories.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			domain := args[0]
 
@@ -67,20 +80,79 @@ func domainDeleteCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
 			defer db.Close()
 
-			if err := db.DeleteDomain(domain); err != nil {
+			if !cascade {
+				if err := db.DeleteDomain(domain); err != nil {
+					return fmt.Errorf("failed to delete domain: %w", err)
+				}
+				printer().Infof("✅ Domain %s deleted successfully\n", domain)
+				return nil
+			}
+
+			d, err := db.GetDomain(domain)
+			if err != nil {
+				return fmt.Errorf("failed to delete domain: %w", err)
+			}
+			dir, err := mailbox.DomainPath(cfg.Paths.Mail, domain)
+			if err != nil {
 				return fmt.Errorf("failed to delete domain: %w", err)
 			}
 
-			fmt.Printf("✅ Domain %s deleted successfully\n", domain)
+			if !yes {
+				ok, err := confirm(fmt.Sprintf("⚠️  This permanently deletes %s with %d users, %d aliases, its DKIM keys and %s.",
+					domain, d.UserCount, d.AliasCount, dir), domain)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("aborted")
+				}
+			}
+
+			// Files go only once the deletion is committed, so they are
+			// never lost for a domain that is kept
+			var archivePath string
+			var keys []string
+			err = db.DeleteDomainCascade(domain, func() error {
+				if archive {
+					var err error
+					archivePath, err = mailbox.Archive(cfg.Paths.Mail, dir, mailboxArchiveDir(cfg), domain)
+					if err != nil {
+						return err
+					}
+				}
+				if err := mailbox.Remove(cfg.Paths.Mail, dir); err != nil {
+					return err
+				}
+				keys, err = dkim.Remove(domain, cfg.DKIMPath)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete domain: %w", err)
+			}
+
+			printer().Infof("✅ Domain %s deleted with %d users and %d aliases\n", domain, d.UserCount, d.AliasCount)
+			if archivePath != "" {
+				printer().Infof("📦 Mail archived to %s\n", archivePath)
+			}
+			printer().Infof("🗑️  Mail directory %s removed\n", dir)
+			for _, key := range keys {
+				printer().Infof("🗑️  DKIM key %s removed\n", key)
+			}
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&cascade, "cascade", false, "also delete the domain's users, aliases, DKIM keys and mail")
+	cmd.Flags().BoolVar(&archive, "archive", false, "archive the domain's mail to a tarball before deleting (with --cascade)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "do not ask for confirmation")
+
+	return cmd
 }
 
 func domainListCmd() *cobra.Command {
@@ -93,7 +165,7 @@ func domainListCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
@@ -104,12 +176,313 @@ func domainListCmd() *cobra.Command {
 				return err
 			}
 
-			fmt.Println("🌐 Mail Domains:")
+			view := output.List("🌐 Mail Domains:", "name", "users", "aliases", "max_quota", "enabled")
+			view.Empty = "No domains configured"
 			for _, domain := range domains {
-				fmt.Printf("  - %s (%d users)\n", domain.Name, domain.UserCount)
+				maxQuota := "unlimited"
+				if domain.MaxQuota > 0 {
+					maxQuota = fmt.Sprintf("%d MB", domain.MaxQuota/(1024*1024))
+				}
+				view.Row(domain.Name, usage(domain.UserCount, domain.MaxUsers), usage(domain.AliasCount, domain.MaxAliases),
+					maxQuota, yesNo(domain.Enabled))
+			}
+			return printer().Print(domains, view)
+		},
+	}
+}
+
+// usage formats a count against its limit, such as "3/10"
+func usage(count, limit int) string {
+	if limit <= 0 {
+		return strconv.Itoa(count)
+	}
+	return fmt.Sprintf("%d/%d", count, limit)
+}
+
+func domainUpdateCmd() *cobra.Command {
+	var maxUsers, maxAliases int
+	var maxQuota int64
+	var enabled bool
+
+	cmd := &cobra.Command{
+		Use:   "update <domain>",
+		Short: "Update the limits of a mail domain",
+		Long: `Update the limits of a mail domain. Only the given flags are changed;
+0 means unlimited. Limits cannot be set below what the domain already uses.
+
+Examples:
+  mailstack domain update example.com --max-users 50 --max-aliases 200
+  mailstack domain update example.com --max-quota 2000000000`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domain := args[0]
+
+			var update database.DomainUpdate
+			flags := cmd.Flags()
+			if flags.Changed("max-users") {
+				update.MaxUsers = &maxUsers
+			}
+			if flags.Changed("max-aliases") {
+				update.MaxAliases = &maxAliases
+			}
+			if flags.Changed("max-quota") {
+				update.MaxQuota = &maxQuota
+			}
+			if flags.Changed("enabled") {
+				update.Enabled = &enabled
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
 			}
 
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.UpdateDomain(domain, update); err != nil {
+				return fmt.Errorf("failed to update domain: %w", err)
+			}
+
+			printer().Infof("✅ Domain %s updated successfully\n", domain)
 			return nil
 		},
 	}
+
+	cmd.Flags().IntVar(&maxUsers, "max-users", 0, "maximum number of users (0 for unlimited)")
+	cmd.Flags().IntVar(&maxAliases, "max-aliases", 0, "maximum number of aliases (0 for unlimited)")
+	cmd.Flags().Int64Var(&maxQuota, "max-quota", 0, "largest mailbox quota of a user in bytes (0 for unlimited)")
+	cmd.Flags().BoolVar(&enabled, "enabled", true, "accept mail for the domain")
+
+	return cmd
+}
+
+func domainAlternativeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "alternative",
+		Aliases: []string{"alt"},
+		Short:   "Manage alternative domains",
+		Long: `Alternative domains mirror a primary domain: mail to user@example.net is
+delivered to user@example.com, and users can log in and send with either
+domain. Only addresses that exist in the primary domain are accepted.`,
+	}
+
+	cmd.AddCommand(domainAlternativeAddCmd())
+	cmd.AddCommand(domainAlternativeRemoveCmd())
+	cmd.AddCommand(domainAlternativeListCmd())
+
+	return cmd
+}
+
+func domainAlternativeAddCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <alternative> <domain>",
+		Short: "Make a domain an alternative of a mail domain",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			alternative, domain := args[0], args[1]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.AddAlternative(alternative, domain); err != nil {
+				return fmt.Errorf("failed to add alternative domain: %w", err)
+			}
+
+			printer().Infof("✅ Mail for %s is now delivered to %s\n", alternative, domain)
+			printer().Infof("\n📝 Don't forget to add MX and SPF records for %s\n", alternative)
+			return nil
+		},
+	}
+}
+
+func domainAlternativeRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <alternative>",
+		Short: "Remove an alternative domain",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			alternative := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.DeleteAlternative(alternative); err != nil {
+				return fmt.Errorf("failed to remove alternative domain: %w", err)
+			}
+
+			printer().Infof("✅ Alternative domain %s removed\n", alternative)
+			return nil
+		},
+	}
+}
+
+func domainAlternativeListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [domain]",
+		Short: "List alternative domains, optionally of one domain",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domain := ""
+			if len(args) == 1 {
+				domain = args[0]
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			alternatives, err := db.ListAlternatives(domain)
+			if err != nil {
+				return err
+			}
+
+			view := output.List("🔀 Alternative Domains:", "alternative", "domain")
+			view.Empty = "No alternative domains configured"
+			for _, alt := range alternatives {
+				view.Row(alt.Name, alt.Domain)
+			}
+			return printer().Print(alternatives, view)
+		},
+	}
+}
+
+func domainAdminCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Manage domain administrators",
+		Long: `Domain administrators manage the users and aliases of their domains
+with --as, e.g. from a sudo rule, without full rights on the server:
+
+  mailstack --as it@example.com user add bob@example.com
+
+Global administrators (user update --global-admin) manage every domain.`,
+	}
+
+	cmd.AddCommand(domainAdminAddCmd())
+	cmd.AddCommand(domainAdminRemoveCmd())
+	cmd.AddCommand(domainAdminListCmd())
+
+	return cmd
+}
+
+func domainAdminAddCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "add <user> <domain>",
+		Short: "Make a user an administrator of a domain",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, domain := args[0], args[1]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.AddDomainAdmin(user, domain); err != nil {
+				return fmt.Errorf("failed to add domain admin: %w", err)
+			}
+
+			printer().Infof("✅ %s is now an administrator of %s\n", user, domain)
+			return nil
+		},
+	}
+}
+
+func domainAdminRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <user> <domain>",
+		Short: "Revoke a user's administration of a domain",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			user, domain := args[0], args[1]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.DeleteDomainAdmin(user, domain); err != nil {
+				return fmt.Errorf("failed to remove domain admin: %w", err)
+			}
+
+			printer().Infof("✅ %s is no longer an administrator of %s\n", user, domain)
+			return nil
+		},
+	}
+}
+
+func domainAdminListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [domain]",
+		Short: "List domain administrators, optionally of one domain",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domain := ""
+			if len(args) == 1 {
+				domain = args[0]
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			admins, err := db.ListDomainAdmins(domain)
+			if err != nil {
+				return err
+			}
+
+			view := output.List("👤 Domain Administrators:", "user", "domain")
+			view.Empty = "No domain administrators configured"
+			for _, admin := range admins {
+				view.Row(admin.User, admin.Domain)
+			}
+			return printer().Print(admins, view)
+		},
+	}
 }
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/output"
+)
+
+// Exit codes are part of the command line interface; scripts rely on them,
+// so existing values must never change meaning
+const (
+	ExitOK          = 0
+	ExitError       = 1 // anything not covered below
+	ExitUsage       = 2 // bad flags or arguments
+	ExitNotFound    = 3 // the domain, user, alias or file does not exist
+	ExitExists      = 4 // the object to create already exists
+	ExitInvalid     = 5 // a value was rejected, e.g. by the password policy
+	ExitConflict    = 6 // the change conflicts with existing data
+	ExitUnavailable = 7 // the database cannot be reached
+	ExitPermission  = 8 // must be run as root, a file is not accessible, or not allowed with --as
+	ExitLimit       = 9 // a domain limit would be exceeded
+)
+
+// errorKinds names each exit code in structured errors
+var errorKinds = map[int]string{
+	ExitError:       "error",
+	ExitUsage:       "usage",
+	ExitNotFound:    "not_found",
+	ExitExists:      "exists",
+	ExitInvalid:     "invalid",
+	ExitConflict:    "conflict",
+	ExitUnavailable: "unavailable",
+	ExitPermission:  "permission",
+	ExitLimit:       "limit",
+}
+
+// usageError marks an error in how the command was invoked
+type usageError struct{ err error }
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+var errNotRoot = errors.New("must be run as root")
+
+var errDelegated = errors.New("cannot be used with --as")
+
+// requireRoot fails unless running as root
+func requireRoot(what string) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("%s %w", what, errNotRoot)
+	}
+	return nil
+}
+
+// exitCode maps an error to its exit code
+func exitCode(err error) int {
+	var usage *usageError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &usage):
+		return ExitUsage
+	case errors.Is(err, database.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		return ExitNotFound
+	case errors.Is(err, database.ErrExists):
+		return ExitExists
+	case errors.Is(err, database.ErrInvalid):
+		return ExitInvalid
+	case errors.Is(err, database.ErrConflict):
+		return ExitConflict
+	case errors.Is(err, database.ErrUnavailable):
+		return ExitUnavailable
+	case errors.Is(err, errNotRoot), errors.Is(err, errDelegated), errors.Is(err, fs.ErrPermission), errors.Is(err, database.ErrPermission):
+		return ExitPermission
+	case errors.Is(err, database.ErrLimit):
+		return ExitLimit
+	default:
+		return ExitError
+	}
+}
+
+// cliError is how errors are reported in json and yaml output
+type cliError struct {
+	Error struct {
+		Kind     string `json:"kind"`
+		Message  string `json:"message"`
+		ExitCode int    `json:"exit_code"`
+	} `json:"error"`
+}
+
+// reportError writes err to w in the selected format and returns its exit code
+func reportError(w io.Writer, format output.Format, err error) int {
+	code := exitCode(err)
+	if format != output.JSON && format != output.YAML {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return code
+	}
+
+	var report cliError
+	report.Error.Kind = errorKinds[code]
+	report.Error.Message = err.Error()
+	report.Error.ExitCode = code
+	p := &output.Printer{Format: format, Out: w}
+	if perr := p.Print(report, nil); perr != nil {
+		fmt.Fprintf(w, "Error: %v\n", err)
+	}
+	return code
+}
@@ -2,7 +2,6 @@ package cli
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/mailstack/mailstack/internal/config"
 	"github.com/mailstack/mailstack/internal/installer"
@@ -11,15 +10,28 @@ import (
 
 func installCmd() *cobra.Command {
 	var force bool
+	var dryRun bool
 
 	cmd := &cobra.Command{
 		Use:   "install",
 		Short: "Install and configure the mail server",
 		Long:  `Install all required components and configure the mail server based on the config file.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// A dry run only renders configs into a staging directory
+			if dryRun {
+				cfg, err := config.Load(cfgFile)
+				if err != nil {
+					return fmt.Errorf("failed to load config: %w", err)
+				}
+				if err := cfg.Validate(); err != nil {
+					return fmt.Errorf("invalid configuration: %w", err)
+				}
+				return showConfigDrift(cmd, cfg, "")
+			}
+
 			// Check if running as root
-			if os.Geteuid() != 0 {
-				return fmt.Errorf("installation must be run as root")
+			if err := requireRoot("installation"); err != nil {
+				return err
 			}
 
 			// Load configuration
@@ -34,24 +46,33 @@ func installCmd() *cobra.Command {
 			}
 
 			// Create installer
-			inst := installer.New(cfg, verbose)
+			inst := newInstaller(cfg, verbose)
 
 			// Run installation
-			fmt.Println("🚀 Starting MailStack installation...")
+			printer().Infof("🚀 Starting MailStack installation...\n")
 			if err := inst.Install(force); err != nil {
 				return fmt.Errorf("installation failed: %w", err)
 			}
 
-			fmt.Println("✅ MailStack installation completed successfully!")
-			fmt.Printf("\n📧 Admin panel: https://%s/admin\n", cfg.Hostname)
-			fmt.Printf("👤 Admin email: %s\n", cfg.Admin.Email)
-			fmt.Println("\n🔒 Please change the admin password after first login!")
+			printer().Infof("✅ MailStack installation completed successfully!\n")
+			printer().Infof("\n📧 Admin panel: https://%s/admin\n", cfg.Hostname)
+			printer().Infof("👤 Admin email: %s\n", cfg.Admin.Email)
+			printer().Infof("\n🔒 Please change the admin password after first login!\n")
 
 			return nil
 		},
 	}
 
 	cmd.Flags().BoolVarP(&force, "force", "f", false, "force reinstallation even if already installed")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only render configuration files and diff them against the installed ones")
 
 	return cmd
 }
+
+// newInstaller returns an installer whose progress messages go where the
+// printer sends messages, keeping stdout parseable in machine formats
+func newInstaller(cfg *config.Config, verbose bool) *installer.Installer {
+	inst := installer.New(cfg, verbose)
+	inst.SetOutput(printer().Info())
+	return inst
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// confirm asks the user to type expected to go ahead
+func confirm(question, expected string) (bool, error) {
+	printer().Infof("%s\nType %q to confirm: ", question, expected)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	return strings.TrimSpace(answer) == expected, nil
+}
+
+// addPasswordFlags registers --password and --password-stdin on cmd
+func addPasswordFlags(cmd *cobra.Command, password *string, fromStdin *bool, usage string) {
+	cmd.Flags().StringVarP(password, "password", "p", "", usage+" (visible in shell history and ps; prefer the prompt or --password-stdin)")
+	cmd.Flags().BoolVar(fromStdin, "password-stdin", false, "read the password from the first line of stdin")
+	cmd.MarkFlagsMutuallyExclusive("password", "password-stdin")
+}
+
+// readPassword returns the password from --password, from stdin, or from a
+// no-echo prompt with confirmation when stdin is a terminal
+func readPassword(cmd *cobra.Command, password string, fromStdin bool) (string, error) {
+	if cmd.Flags().Changed("password") {
+		fmt.Fprintln(os.Stderr, "⚠️  Passwords given with --password end up in shell history and ps output")
+		return password, nil
+	}
+
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return "", fmt.Errorf("no password on stdin")
+		}
+		return line, nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("no password given: use --password-stdin or run interactively")
+	}
+
+	first, err := promptHidden("Password: ")
+	if err != nil {
+		return "", err
+	}
+	second, err := promptHidden("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+	if first != second {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	if first == "" {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+
+	return first, nil
+}
+
+// promptHidden reads a line from the terminal with echo turned off
+func promptHidden(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	saved, err := term.GetState(fd)
+	if err != nil {
+		return "", fmt.Errorf("cannot prompt for a password, use --password-stdin: %w", err)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+
+	// Turn echo back on even if interrupted
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupted:
+			term.Restore(fd, saved)
+			fmt.Fprintln(os.Stderr)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		signal.Stop(interrupted)
+		fmt.Fprintln(os.Stderr)
+	}()
+
+	password, err := term.ReadPassword(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(password), nil
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
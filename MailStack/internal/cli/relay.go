@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/output"
+	"github.com/spf13/cobra"
+)
+
+func relayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "relay",
+		Short: "Manage relay domains",
+		Long: `Relay domains are accepted by postfix and forwarded to another host
+instead of being delivered to mailboxes, e.g. when this server is a backup
+MX or part of a split delivery. Mail goes to the given upstream host, or to
+the MX hosts of the domain when none is given. Every change rewrites
+/etc/postfix/transport.map and compiles it with postmap.`,
+	}
+
+	cmd.AddCommand(relayAddCmd())
+	cmd.AddCommand(relayRemoveCmd())
+	cmd.AddCommand(relayListCmd())
+
+	return cmd
+}
+
+func relayAddCmd() *cobra.Command {
+	var comment string
+
+	cmd := &cobra.Command{
+		Use:   "add <domain> [smtp:host:port]",
+		Short: "Relay mail for a domain to an upstream host",
+		Long: `Relay mail for a domain to an upstream host, given as host, host:port or
+smtp:host:port (port 25 by default). Without one, mail goes to the MX hosts
+of the domain, which suits a backup MX.
+
+  mailstack relay add example.org smtp:mx1.example.org:25
+  mailstack relay add backup.example.com`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domain, nexthop := args[0], ""
+			if len(args) == 2 {
+				nexthop = args[1]
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			var relay *database.Relay
+			err = updateRelays(cfg, db, func(tx *database.DB) error {
+				if err := tx.AddRelay(domain, nexthop, comment); err != nil {
+					return err
+				}
+				relay, err = tx.GetRelay(domain)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to add relay domain: %w", err)
+			}
+
+			if relay.Nexthop == "" {
+				printer().Infof("✅ Mail for %s is now relayed to its MX hosts\n", domain)
+			} else {
+				printer().Infof("✅ Mail for %s is now relayed to %s\n", domain, relay.Nexthop)
+			}
+			printer().Infof("\n📝 Don't forget to add an MX record for %s pointing to this server\n", domain)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&comment, "comment", "", "what the relay is for")
+
+	return cmd
+}
+
+func relayRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <domain>",
+		Short: "Stop relaying mail for a domain",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domain := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			err = updateRelays(cfg, db, func(tx *database.DB) error {
+				return tx.DeleteRelay(domain)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to remove relay domain: %w", err)
+			}
+
+			printer().Infof("✅ Relay domain %s removed\n", domain)
+			return nil
+		},
+	}
+}
+
+func relayListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List relay domains",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			relays, err := db.ListRelays()
+			if err != nil {
+				return err
+			}
+
+			view := output.List("📨 Relay Domains:", "domain", "nexthop", "comment")
+			view.Empty = "No relay domains configured"
+			for _, relay := range relays {
+				nexthop := relay.Nexthop
+				if nexthop == "" {
+					nexthop = "(MX hosts)"
+				}
+				view.Row(relay.Name, nexthop, relay.Comment)
+			}
+			return printer().Print(relays, view)
+		},
+	}
+}
+
+// updateRelays runs change in a transaction and rewrites the transport map
+// once it has committed, so postfix never sees a relay the database lost
+// to a rollback
+func updateRelays(cfg *config.Config, db *database.DB, change func(tx *database.DB) error) error {
+	if err := db.Transaction(change); err != nil {
+		return err
+	}
+	relays, err := db.ListRelays()
+	if err != nil {
+		return err
+	}
+	if err := newInstaller(cfg, false).WriteTransportMap(relays); err != nil {
+		return fmt.Errorf("relay domains were changed, but the transport map was kept as it was: %w", err)
+	}
+	return nil
+}
@@ -2,38 +2,178 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/output"
 	"github.com/spf13/cobra"
 )
 
 var (
-	cfgFile string
-	verbose bool
+	cfgFile      string
+	verbose      bool
+	outputFlag   string
+	outputFormat = output.Table
+	actAs        onceFlag
 )
 
-// Execute runs the root command
-func Execute(version, commit, date string) error {
+// Execute runs the root command and returns the process exit code
+func Execute(version, commit, date string) int {
+	rootCmd := newRootCmd(fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date))
+
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return ExitOK
+	}
+	// cobra reports unknown subcommands with a plain error
+	if strings.HasPrefix(err.Error(), "unknown command") {
+		err = &usageError{err}
+	}
+	code := reportError(os.Stderr, outputFormat, err)
+	if code == ExitUsage && !outputFormat.Machine() {
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+	}
+	return code
+}
+
+// newRootCmd builds the command tree
+func newRootCmd(version string) *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "mailstack",
 		Short: "MailStack - Complete mail server installer and management",
 		Long: `MailStack is a complete mail server solution that installs and manages
 Postfix, Dovecot, Rspamd, Nginx, and other components on bare metal or VMs.`,
-		Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
+		Version: version,
+
+		// Errors are reported once, by reportError
+		SilenceErrors: true,
+		SilenceUsage:  true,
+
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			format, err := output.ParseFormat(outputFlag)
+			if err != nil {
+				return &usageError{err}
+			}
+			outputFormat = format
+			return checkDelegation(cmd)
+		},
 	}
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "mailstack.json", "config file")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", string(output.Table), "output format: table, json, yaml or csv")
+	rootCmd.PersistentFlags().Var(&actAs, "as", "act as this admin user, limited to the domains they administer")
 
 	// Add subcommands
 	rootCmd.AddCommand(installCmd())
 	rootCmd.AddCommand(userCmd())
 	rootCmd.AddCommand(domainCmd())
 	rootCmd.AddCommand(aliasCmd())
+	rootCmd.AddCommand(relayCmd())
 	rootCmd.AddCommand(dkimCmd())
 	rootCmd.AddCommand(statusCmd())
 	rootCmd.AddCommand(updateCmd())
 	rootCmd.AddCommand(configCmd())
+	rootCmd.AddCommand(dbCmd())
+	rootCmd.AddCommand(importCmd())
+	rootCmd.AddCommand(exportCmd())
+	rootCmd.AddCommand(applyCmd())
+	rootCmd.AddCommand(serveCmd())
+
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &usageError{err}
+	})
+	markUsageErrors(rootCmd)
+
+	return rootCmd
+}
+
+// markUsageErrors tags argument validation errors of cmd and its
+// subcommands as usage errors
+func markUsageErrors(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return &usageError{err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markUsageErrors(sub)
+	}
+}
+
+// printer writes command output in the format chosen with --output
+func printer() *output.Printer {
+	return &output.Printer{Format: outputFormat, Out: os.Stdout, Err: os.Stderr}
+}
+
+// delegatedConfig is the only config file used with --as, so that a sudo
+// rule cannot be pointed at another config or database
+const delegatedConfig = "/etc/mailstack/mailstack.json"
 
-	return rootCmd.Execute()
+// delegable marks the command groups that may be run with --as. They only
+// change the database through connect, which limits them to the domains
+// of the --as user; every other command acts with full rights.
+var delegable = map[string]string{"delegable": "true"}
+
+// checkDelegation restricts --as to the delegable commands and pins the
+// config file
+func checkDelegation(cmd *cobra.Command) error {
+	if !actAs.set {
+		return nil
+	}
+	if cmd.Flags().Changed("config") {
+		return fmt.Errorf("--config %w", errDelegated)
+	}
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations["delegable"] == "true" {
+			cfgFile = delegatedConfig
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %w", cmd.CommandPath(), errDelegated)
+}
+
+// connect opens the database, acting for the --as user if one was given
+func connect(cfg *config.Config) (*database.DB, error) {
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	if actAs.value == "" {
+		return db, nil
+	}
+
+	principal, err := db.LoadPrincipal(actAs.value)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db.As(principal), nil
+}
+
+// onceFlag is a string flag that may be given only once, so that the --as
+// fixed in a sudo rule cannot be overridden by another one after it
+type onceFlag struct {
+	value string
+	set   bool
+}
+
+func (f *onceFlag) String() string { return f.value }
+func (f *onceFlag) Type() string   { return "email" }
+
+func (f *onceFlag) Set(value string) error {
+	if f.set {
+		return fmt.Errorf("can only be given once")
+	}
+	if value == "" {
+		return fmt.Errorf("cannot be empty")
+	}
+	f.value, f.set = value, true
+	return nil
 }
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDelegation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		refused bool
+	}{
+		{name: "user", args: []string{"--as", "alice@example.com", "user", "list"}},
+		{name: "user forward", args: []string{"--as", "alice@example.com", "user", "forward", "clear", "bob@example.com"}},
+		{name: "domain", args: []string{"--as", "alice@example.com", "domain", "list"}},
+		{name: "alias", args: []string{"--as", "alice@example.com", "alias", "list"}},
+		{name: "relay", args: []string{"--as", "alice@example.com", "relay", "list"}, refused: true},
+		{name: "dkim", args: []string{"--as", "alice@example.com", "dkim", "show", "example.com"}, refused: true},
+		{name: "db", args: []string{"--as", "alice@example.com", "db", "migrate"}, refused: true},
+		{name: "config", args: []string{"--as", "alice@example.com", "config", "regenerate"}, refused: true},
+		{name: "import", args: []string{"--as", "alice@example.com", "import", "accounts.json"}, refused: true},
+		{name: "apply", args: []string{"--as", "alice@example.com", "apply", "-f", "state.yaml"}, refused: true},
+		{name: "serve", args: []string{"--as", "alice@example.com", "serve"}, refused: true},
+		{name: "other config", args: []string{"--as", "alice@example.com", "--config", "/tmp/other.json", "user", "list"}, refused: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The flags are package state, as in the binary
+			t.Cleanup(func() {
+				actAs, cfgFile, outputFlag = onceFlag{}, "", ""
+			})
+
+			// Resolve the command as Execute does, without running it
+			cmd, _, err := newRootCmd("test").Find(tt.args)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatalf("ParseFlags: %v", err)
+			}
+			err = checkDelegation(cmd)
+
+			if refused := errors.Is(err, errDelegated); refused != tt.refused {
+				t.Fatalf("refused = %v (%v), want %v", refused, err, tt.refused)
+			}
+			if !tt.refused && cfgFile != delegatedConfig {
+				t.Errorf("config = %q, want %q", cfgFile, delegatedConfig)
+			}
+		})
+	}
+}
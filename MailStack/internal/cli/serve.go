@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/server"
+	"github.com/spf13/cobra"
+)
+
+func serveCmd() *cobra.Command {
+	var listen, apiListen string
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the internal HTTP service for nginx and rspamd",
+		Long: `Run the HTTP service that nginx and rspamd query on this host:
+
+  /internal/auth/email                     nginx mail auth_http
+  /internal/rspamd/vault/v1/dkim/<domain>  DKIM keys for signing
+  /internal/rspamd/local_domains           mail and alternative domains
+  /health                                  204 when the database answers
+
+They are served on a loopback address only; the DKIM vault also checks the
+token that rspamd sends. When api_token is set in the config, the REST API
+is served on --api-listen, under the web_api path (/api/v1 by default) with
+the token as bearer token; its OpenAPI description is at
+/api/v1/openapi.json.
+Stops on SIGINT or SIGTERM once the requests in progress are done.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			// The services need every domain, so --as does not apply
+			db, err := database.Connect(cfg.Database)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			db.SetPasswordPolicy(cfg.PasswordPolicy)
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			logger := log.New(os.Stderr, "", log.LstdFlags)
+			srv := server.New(cfg, db, logger)
+			if cfg.API && cfg.APIToken != "" {
+				printer().Infof("🌐 Listening on %s, REST API on %s\n", listen, apiListen)
+			} else {
+				apiListen = ""
+				printer().Infof("🌐 Listening on %s\n", listen)
+			}
+			if err := srv.ListenAndServe(ctx, listen, apiListen); err != nil {
+				return err
+			}
+			printer().Infof("👋 Stopped\n")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&listen, "listen", "l", "127.0.0.1:8080", "loopback address of the internal endpoints")
+	cmd.Flags().StringVar(&apiListen, "api-listen", "127.0.0.1:8081", "address of the REST API, which nginx proxies")
+
+	return cmd
+}
@@ -1,9 +1,8 @@
 package cli
 
 import (
-	"fmt"
-
 	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/output"
 	"github.com/mailstack/mailstack/internal/services"
 	"github.com/spf13/cobra"
 )
@@ -24,20 +23,17 @@ func statusCmd() *cobra.Command {
 				return err
 			}
 
-			fmt.Println("📊 MailStack Service Status:")
-
+			view := output.List("📊 MailStack Service Status:", "service", "state", "status")
 			for _, svc := range status {
-				icon := "✅"
+				state := "running"
 				if !svc.Running {
-					icon = "❌"
+					state = "stopped"
 				} else if !svc.Healthy {
-					icon = "⚠️"
+					state = "unhealthy"
 				}
-
-				fmt.Printf("%s %-15s %s\n", icon, svc.Name, svc.Status)
+				view.Row(svc.Name, state, svc.Status)
 			}
-
-			return nil
+			return printer().Print(status, view)
 		},
 	}
 }
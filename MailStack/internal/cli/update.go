@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/mailstack/mailstack/internal/config"
-	"github.com/mailstack/mailstack/internal/installer"
 	"github.com/spf13/cobra"
 )
 
@@ -19,14 +18,14 @@ func updateCmd() *cobra.Command {
 				return err
 			}
 
-			inst := installer.New(cfg, verbose)
+			inst := newInstaller(cfg, verbose)
 
-			fmt.Println("🔄 Updating MailStack components...")
+			printer().Infof("🔄 Updating MailStack components...\n")
 			if err := inst.Update(); err != nil {
 				return fmt.Errorf("update failed: %w", err)
 			}
 
-			fmt.Println("✅ MailStack updated successfully!")
+			printer().Infof("✅ MailStack updated successfully!\n")
 			return nil
 		},
 	}
@@ -2,23 +2,39 @@ package cli
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mailstack/mailstack/internal/config"
 	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/mailbox"
+	"github.com/mailstack/mailstack/internal/output"
+	"github.com/mailstack/mailstack/internal/sieve"
 	"github.com/spf13/cobra"
 )
 
 func userCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "user",
-		Short: "Manage mail users",
-		Long:  `Add, remove, list, and modify mail users.`,
+		Use:         "user",
+		Short:       "Manage mail users",
+		Annotations: delegable,
+		Long:        `Add, remove, list, and modify mail users.`,
 	}
 
 	cmd.AddCommand(userAddCmd())
 	cmd.AddCommand(userDeleteCmd())
 	cmd.AddCommand(userListCmd())
 	cmd.AddCommand(userPasswordCmd())
+	cmd.AddCommand(userShowCmd())
+	cmd.AddCommand(userUpdateCmd())
+	cmd.AddCommand(userForwardCmd())
+	cmd.AddCommand(userAutoReplyCmd())
+	cmd.AddCommand(userTokenCmd())
 
 	return cmd
 }
@@ -26,6 +42,7 @@ func userCmd() *cobra.Command {
 func userAddCmd() *cobra.Command {
 	var quota int64
 	var password string
+	var passwordStdin bool
 
 	cmd := &cobra.Command{
 		Use:   "add <email>",
@@ -39,29 +56,35 @@ func userAddCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			password, err := readPassword(cmd, password, passwordStdin)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
 			defer db.Close()
+			db.SetPasswordPolicy(cfg.PasswordPolicy)
 
 			if err := db.AddUser(email, password, quota); err != nil {
 				return fmt.Errorf("failed to add user: %w", err)
 			}
 
-			fmt.Printf("✅ User %s added successfully\n", email)
+			printer().Infof("✅ User %s added successfully\n", email)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&password, "password", "p", "", "user password (will prompt if not provided)")
+	addPasswordFlags(cmd, &password, &passwordStdin, "user password (will prompt if not provided)")
 	cmd.Flags().Int64VarP(&quota, "quota", "q", 1000000000, "mailbox quota in bytes")
 
 	return cmd
 }
 
 func userDeleteCmd() *cobra.Command {
-	var removeMailbox bool
+	var removeMailbox, archive bool
 
 	cmd := &cobra.Command{
 		Use:   "delete <email>",
@@ -75,26 +98,63 @@ func userDeleteCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
 			defer db.Close()
 
-			if err := db.DeleteUser(email, removeMailbox); err != nil {
+			dir, err := mailbox.Path(cfg.Paths.Mail, email)
+			if err != nil {
 				return fmt.Errorf("failed to delete user: %w", err)
 			}
 
-			fmt.Printf("✅ User %s deleted successfully\n", email)
+			// The mailbox is archived and removed only once the user is
+			// gone from the database
+			var archivePath string
+			var cleanup func() error
+			if archive || removeMailbox {
+				cleanup = func() error {
+					if archive {
+						var err error
+						archivePath, err = mailbox.Archive(cfg.Paths.Mail, dir, mailboxArchiveDir(cfg), email)
+						if err != nil {
+							return err
+						}
+					}
+					if removeMailbox {
+						return mailbox.Remove(cfg.Paths.Mail, dir)
+					}
+					return nil
+				}
+			}
+
+			if err := db.DeleteUser(email, cleanup); err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+
+			printer().Infof("✅ User %s deleted successfully\n", email)
+			if archivePath != "" {
+				printer().Infof("📦 Mailbox archived to %s\n", archivePath)
+			}
+			if removeMailbox {
+				printer().Infof("🗑️  Mailbox %s removed\n", dir)
+			}
 			return nil
 		},
 	}
 
 	cmd.Flags().BoolVarP(&removeMailbox, "remove-mailbox", "r", false, "also remove user's mailbox data")
+	cmd.Flags().BoolVar(&archive, "archive", false, "archive the mailbox to a tarball before deleting")
 
 	return cmd
 }
 
+// mailboxArchiveDir is where deleted mailboxes are archived
+func mailboxArchiveDir(cfg *config.Config) string {
+	return filepath.Join(cfg.Paths.Backups, "mailboxes")
+}
+
 func userListCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "list",
@@ -105,7 +165,7 @@ func userListCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
@@ -116,18 +176,27 @@ func userListCmd() *cobra.Command {
 				return err
 			}
 
-			fmt.Println("📧 Mail Users:")
-			for _, user := range users {
-				fmt.Printf("  - %s (quota: %d MB)\n", user.Email, user.Quota/(1024*1024))
+			// Refresh the recorded usage when dovecot can report it
+			if usage, ok := doveadmQuota("-A"); ok {
+				if err := recordUsage(db, users, usage); err != nil {
+					return err
+				}
 			}
 
-			return nil
+			view := output.List("📧 Mail Users:", "email", "display_name", "quota_mb", "used_mb", "enabled")
+			view.Empty = "No users configured"
+			for _, user := range users {
+				view.Row(user.Email, user.DisplayName, strconv.FormatInt(user.Quota/(1024*1024), 10),
+					strconv.FormatInt(user.QuotaUsed/(1024*1024), 10), yesNo(user.Enabled))
+			}
+			return printer().Print(users, view)
 		},
 	}
 }
 
 func userPasswordCmd() *cobra.Command {
 	var password string
+	var passwordStdin bool
 
 	cmd := &cobra.Command{
 		Use:   "password <email>",
@@ -141,22 +210,687 @@ func userPasswordCmd() *cobra.Command {
 				return err
 			}
 
-			db, err := database.Connect(cfg.Database)
+			password, err := readPassword(cmd, password, passwordStdin)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
 			if err != nil {
 				return err
 			}
 			defer db.Close()
+			db.SetPasswordPolicy(cfg.PasswordPolicy)
 
 			if err := db.ChangePassword(email, password); err != nil {
 				return fmt.Errorf("failed to change password: %w", err)
 			}
 
-			fmt.Printf("✅ Password changed for %s\n", email)
+			printer().Infof("✅ Password changed for %s\n", email)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&password, "password", "p", "", "new password (will prompt if not provided)")
+	addPasswordFlags(cmd, &password, &passwordStdin, "new password (will prompt if not provided)")
 
 	return cmd
 }
+
+func userShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <email>",
+		Short: "Show a mail user's attributes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			user, err := db.GetUser(email)
+			if err != nil {
+				return err
+			}
+
+			// Show the live usage when dovecot can report it
+			if used, ok := mailboxUsage(email); ok {
+				if err := db.SetQuotaUsed(user.Email, used); err != nil {
+					return err
+				}
+				user.QuotaUsed = used
+			}
+
+			quota := "unlimited"
+			if user.Quota > 0 {
+				quota = fmt.Sprintf("%d MB (%d%% used)", user.Quota/(1024*1024), user.QuotaUsed*100/user.Quota)
+			}
+
+			forward := "no"
+			if user.ForwardEnabled {
+				forward = user.ForwardDestination
+				if user.ForwardKeep {
+					forward += " (keeping a copy)"
+				}
+			}
+
+			view := output.Record("📧 "+user.Email).
+				Field("email", user.Email).
+				Field("display_name", user.DisplayName).
+				Field("enabled", yesNo(user.Enabled)).
+				Field("IMAP", yesNo(user.EnableIMAP)).
+				Field("POP3", yesNo(user.EnablePOP)).
+				Field("global_admin", yesNo(user.GlobalAdmin)).
+				Field("force_password_change", yesNo(user.ForcePasswordChange)).
+				Field("forward", forward).
+				Field("quota", quota).
+				Field("used", fmt.Sprintf("%d MB", user.QuotaUsed/(1024*1024))).
+				Field("created", user.CreatedAt.Format("2006-01-02 15:04:05")).
+				Field("updated", user.UpdatedAt.Format("2006-01-02 15:04:05"))
+			return printer().Print(user, view)
+		},
+	}
+}
+
+func userUpdateCmd() *cobra.Command {
+	var displayName string
+	var quota int64
+	var enabled, imap, pop, globalAdmin, forcePasswordChange bool
+
+	cmd := &cobra.Command{
+		Use:   "update <email>",
+		Short: "Change a mail user's attributes",
+		Long: `Change a mail user's attributes. Only the flags given are changed, e.g.
+
+  mailstack user update alice@example.com --enabled=false
+  mailstack user update alice@example.com --pop=false --quota 2000000000`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			var update database.UserUpdate
+			flags := cmd.Flags()
+			if flags.Changed("display-name") {
+				update.DisplayName = &displayName
+			}
+			if flags.Changed("quota") {
+				update.Quota = &quota
+			}
+			if flags.Changed("enabled") {
+				update.Enabled = &enabled
+			}
+			if flags.Changed("imap") {
+				update.EnableIMAP = &imap
+			}
+			if flags.Changed("pop") {
+				update.EnablePOP = &pop
+			}
+			if flags.Changed("global-admin") {
+				update.GlobalAdmin = &globalAdmin
+			}
+			if flags.Changed("force-password-change") {
+				update.ForcePasswordChange = &forcePasswordChange
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.UpdateUser(email, update); err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+
+			printer().Infof("✅ User %s updated successfully\n", email)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&displayName, "display-name", "", "display name")
+	cmd.Flags().Int64VarP(&quota, "quota", "q", 0, "mailbox quota in bytes (0 for unlimited)")
+	cmd.Flags().BoolVar(&enabled, "enabled", true, "allow the user to receive mail and log in")
+	cmd.Flags().BoolVar(&imap, "imap", true, "allow IMAP access")
+	cmd.Flags().BoolVar(&pop, "pop", true, "allow POP3 access")
+	cmd.Flags().BoolVar(&globalAdmin, "global-admin", false, "grant administration of all domains")
+	cmd.Flags().BoolVar(&forcePasswordChange, "force-password-change", false, "mark the password as to be replaced; logins still work and a new password clears the mark")
+
+	return cmd
+}
+
+// mailboxUsage asks dovecot for the current storage used by a mailbox
+func mailboxUsage(email string) (int64, bool) {
+	usage, ok := doveadmQuota("-u", email)
+	if !ok {
+		return 0, false
+	}
+	used, ok := usage[""]
+	return used, ok
+}
+
+// doveadmQuota runs doveadm quota get and returns the storage used by each
+// user, keyed by "" when the output has no user column (-u)
+func doveadmQuota(args ...string) (map[string]int64, bool) {
+	if _, err := exec.LookPath("doveadm"); err != nil {
+		return nil, false
+	}
+
+	// Output is "[Username\t]Quota name\tType\tValue\tLimit\t%" with a
+	// header line and values in KiB
+	output, err := exec.Command("doveadm", append([]string{"-f", "tab", "quota", "get"}, args...)...).Output()
+	if err != nil {
+		return nil, false
+	}
+	return parseQuota(string(output))
+}
+
+// parseQuota reads the tab separated output of doveadm quota get
+func parseQuota(output string) (map[string]int64, bool) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	columns := map[string]int{}
+	for i, name := range strings.Split(lines[0], "\t") {
+		columns[name] = i
+	}
+	typeCol, ok1 := columns["Type"]
+	valueCol, ok2 := columns["Value"]
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	userCol, hasUser := columns["Username"]
+
+	usage := map[string]int64{}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) <= max(typeCol, valueCol, userCol) || fields[typeCol] != "STORAGE" {
+			continue
+		}
+		kib, err := strconv.ParseInt(fields[valueCol], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		user := ""
+		if hasUser {
+			user = fields[userCol]
+		}
+		usage[user] = kib * 1024
+	}
+	return usage, true
+}
+
+// recordUsage stores the mailbox sizes dovecot reported for users, so that
+// the API and exports show them too
+func recordUsage(db *database.DB, users []database.User, usage map[string]int64) error {
+	return db.Transaction(func(tx *database.DB) error {
+		for i := range users {
+			used, ok := usage[users[i].Email]
+			if !ok {
+				continue
+			}
+			users[i].QuotaUsed = used
+			if err := tx.SetQuotaUsed(users[i].Email, used); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func userForwardCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "forward",
+		Short: "Forward a user's mail to other addresses",
+	}
+
+	cmd.AddCommand(userForwardSetCmd())
+	cmd.AddCommand(userForwardClearCmd())
+
+	return cmd
+}
+
+func userForwardSetCmd() *cobra.Command {
+	var keep bool
+
+	cmd := &cobra.Command{
+		Use:   "set <email> <destination>",
+		Short: "Forward a user's mail",
+		Long: `Forward the mail delivered to a user to one or more addresses
+(comma-separated). With --keep, a copy also stays in the user's mailbox.
+
+Examples:
+  mailstack user forward set alice@example.com alice@gmail.com
+  mailstack user forward set alice@example.com bob@example.com,carol@example.com --keep=false`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, destination := args[0], args[1]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.SetForward(email, destination, keep); err != nil {
+				return fmt.Errorf("failed to set forward: %w", err)
+			}
+
+			printer().Infof("✅ Mail for %s is now forwarded to %s\n", email, destination)
+			if keep {
+				printer().Infof("   A copy stays in the mailbox\n")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&keep, "keep", true, "keep a copy in the user's mailbox")
+
+	return cmd
+}
+
+func userForwardClearCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear <email>",
+		Short: "Stop forwarding a user's mail",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.ClearForward(email); err != nil {
+				return fmt.Errorf("failed to clear forward: %w", err)
+			}
+
+			printer().Infof("✅ Mail for %s is no longer forwarded\n", email)
+			return nil
+		},
+	}
+}
+
+func userAutoReplyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "autoreply",
+		Aliases: []string{"vacation"},
+		Short:   "Manage a user's out-of-office auto-reply",
+		Long: `Manage a user's out-of-office auto-reply. The settings are stored in the
+database and written as a sieve script to the user's mail home, which
+dovecot runs before the user's own filters.`,
+	}
+
+	cmd.AddCommand(userAutoReplySetCmd())
+	cmd.AddCommand(userAutoReplyClearCmd())
+	cmd.AddCommand(userAutoReplyShowCmd())
+
+	return cmd
+}
+
+func userAutoReplySetCmd() *cobra.Command {
+	var subject, message, messageFile, start, end string
+	var days int
+
+	cmd := &cobra.Command{
+		Use:   "set <email>",
+		Short: "Turn on a user's auto-reply",
+		Long: `Turn on a user's auto-reply. Settings not given are kept from the last
+auto-reply. Replies are only sent from --start to --end (inclusive, either
+may be left open), and each sender is answered at most once every --days
+days. Spam and mail from mailing lists get no reply.
+
+Examples:
+  mailstack user autoreply set alice@example.com --subject "Out of office" \
+    --message "I am away until 3 November." --start 2026-10-20 --end 2026-11-02
+  mailstack user autoreply set alice@example.com --message-file away.txt`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			reply, err := db.GetAutoReply(email)
+			if err != nil {
+				return fmt.Errorf("failed to set auto-reply: %w", err)
+			}
+			flags := cmd.Flags()
+			if flags.Changed("subject") || reply.Subject == "" {
+				reply.Subject = subject
+			}
+			if flags.Changed("message") {
+				reply.Body = message
+			}
+			if flags.Changed("message-file") {
+				body, err := readMessageFile(messageFile)
+				if err != nil {
+					return err
+				}
+				reply.Body = body
+			}
+			if flags.Changed("start") {
+				reply.Start = start
+			}
+			if flags.Changed("end") {
+				reply.End = end
+			}
+			if flags.Changed("days") {
+				reply.Days = days
+			}
+			reply.Enabled = true
+
+			home, err := mailbox.Path(cfg.Paths.Mail, email)
+			if err != nil {
+				return fmt.Errorf("failed to set auto-reply: %w", err)
+			}
+			err = db.SetAutoReply(*reply, func() error {
+				return sieve.Install(home, sieve.Vacation(reply))
+			})
+			if err != nil {
+				return fmt.Errorf("failed to set auto-reply: %w", err)
+			}
+
+			printer().Infof("✅ Auto-reply for %s is %s\n", email, reply.Status(time.Now()))
+			if reply.Start != "" || reply.End != "" {
+				printer().Infof("   From %s to %s\n", orOpen(reply.Start), orOpen(reply.End))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&subject, "subject", "Out of office", "subject of the reply")
+	cmd.Flags().StringVarP(&message, "message", "m", "", "text of the reply")
+	cmd.Flags().StringVar(&messageFile, "message-file", "", "read the text of the reply from a file (- for stdin)")
+	cmd.Flags().StringVar(&start, "start", "", "first day to reply, YYYY-MM-DD (empty for now)")
+	cmd.Flags().StringVar(&end, "end", "", "last day to reply, YYYY-MM-DD (empty for no end)")
+	cmd.Flags().IntVar(&days, "days", 1, "days before the same sender gets another reply")
+	cmd.MarkFlagsMutuallyExclusive("message", "message-file")
+
+	return cmd
+}
+
+// readMessageFile reads an auto-reply text from path, or stdin for "-"
+func readMessageFile(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else if actAs.set {
+		// Files are read with the rights of root
+		return "", fmt.Errorf("--message-file other than - %w", errDelegated)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read message: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// orOpen shows an empty date as open-ended
+func orOpen(date string) string {
+	if date == "" {
+		return "open"
+	}
+	return date
+}
+
+func userAutoReplyClearCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "clear <email>",
+		Short: "Turn off a user's auto-reply",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			home, err := mailbox.Path(cfg.Paths.Mail, email)
+			if err != nil {
+				return fmt.Errorf("failed to clear auto-reply: %w", err)
+			}
+			err = db.ClearAutoReply(email, func() error {
+				return sieve.Uninstall(home)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to clear auto-reply: %w", err)
+			}
+
+			printer().Infof("✅ Auto-reply for %s turned off\n", email)
+			return nil
+		},
+	}
+}
+
+func userAutoReplyShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <email>",
+		Short: "Show a user's auto-reply",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			reply, err := db.GetAutoReply(email)
+			if err != nil {
+				return err
+			}
+
+			view := output.Record("🏖️  "+reply.Email).
+				Field("email", reply.Email).
+				Field("status", reply.Status(time.Now())).
+				Field("subject", reply.Subject).
+				Field("start", orOpen(reply.Start)).
+				Field("end", orOpen(reply.End)).
+				Field("days", strconv.Itoa(reply.Days)).
+				Field("message", reply.Body)
+			return printer().Print(reply, view)
+		},
+	}
+}
+
+func userTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage a user's application passwords",
+		Long: `Application passwords (tokens) log in to IMAP, POP3 and SMTP like the
+user's password, and can be limited to source addresses and revoked on
+their own, e.g. for phones and scanners.`,
+	}
+
+	cmd.AddCommand(userTokenCreateCmd())
+	cmd.AddCommand(userTokenListCmd())
+	cmd.AddCommand(userTokenRevokeCmd())
+
+	return cmd
+}
+
+func userTokenCreateCmd() *cobra.Command {
+	var comment, ip string
+
+	cmd := &cobra.Command{
+		Use:   "create <email>",
+		Short: "Create an application password",
+		Long: `Create an application password for a user. The secret is printed once
+and cannot be shown again.
+
+Examples:
+  mailstack user token create alice@example.com --comment "Alice's phone"
+  mailstack user token create scanner@example.com --ip 192.0.2.10,2001:db8::/64`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			token, secret, err := db.CreateToken(email, comment, ip)
+			if err != nil {
+				return fmt.Errorf("failed to create token: %w", err)
+			}
+
+			created := struct {
+				*database.Token
+				Secret string `json:"secret"`
+			}{token, secret}
+			view := output.Record(fmt.Sprintf("🔑 Token %d for %s", token.ID, token.Email)).
+				Field("id", strconv.FormatInt(token.ID, 10)).
+				Field("comment", token.Comment).
+				Field("ip", orAnyAddress(token.IP)).
+				Field("secret", secret)
+			if err := printer().Print(created, view); err != nil {
+				return err
+			}
+			printer().Infof("⚠️  The secret is shown only once; store it now\n")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&comment, "comment", "", "what the token is for")
+	cmd.Flags().StringVar(&ip, "ip", "", "comma-separated addresses and networks it may be used from (default any)")
+
+	return cmd
+}
+
+func userTokenListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [email]",
+		Short: "List application passwords, optionally of one user",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := ""
+			if len(args) == 1 {
+				email = args[0]
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			tokens, err := db.ListTokens(email)
+			if err != nil {
+				return err
+			}
+
+			view := output.List("🔑 Tokens:", "id", "email", "comment", "ip", "created")
+			view.Empty = "No tokens"
+			for _, t := range tokens {
+				view.Row(strconv.FormatInt(t.ID, 10), t.Email, t.Comment, orAnyAddress(t.IP),
+					t.CreatedAt.Format("2006-01-02 15:04"))
+			}
+			return printer().Print(tokens, view)
+		},
+	}
+}
+
+func userTokenRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <email> <id>",
+		Short: "Revoke an application password",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email := args[0]
+			id, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return &usageError{fmt.Errorf("invalid token id %q", args[1])}
+			}
+
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			db, err := connect(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := db.RevokeToken(email, id); err != nil {
+				return fmt.Errorf("failed to revoke token: %w", err)
+			}
+
+			printer().Infof("✅ Token %d of %s revoked\n", id, email)
+			return nil
+		},
+	}
+}
+
+// orAnyAddress shows an empty address restriction as "any"
+func orAnyAddress(nets string) string {
+	if nets == "" {
+		return "any"
+	}
+	return nets
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]int64
+		ok     bool
+	}{
+		{
+			name:   "one user",
+			output: "Quota name\tType\tValue\tLimit\t%\nUser quota\tSTORAGE\t2048\t1048576\t0\nUser quota\tMESSAGE\t12\t-\t0\n",
+			want:   map[string]int64{"": 2048 * 1024},
+			ok:     true,
+		},
+		{
+			name: "all users",
+			output: "Username\tQuota name\tType\tValue\tLimit\t%\n" +
+				"alice@example.com\tUser quota\tSTORAGE\t10\t-\t0\n" +
+				"alice@example.com\tUser quota\tMESSAGE\t3\t-\t0\n" +
+				"bob@example.com\tUser quota\tSTORAGE\t0\t1024\t0\n",
+			want: map[string]int64{"alice@example.com": 10 * 1024, "bob@example.com": 0},
+			ok:   true,
+		},
+		{name: "no quota", output: "Quota name\tType\tValue\tLimit\t%\n", want: map[string]int64{}, ok: true},
+		{name: "unknown format", output: "something else\n", ok: false},
+		{name: "bad value", output: "Quota name\tType\tValue\tLimit\t%\nUser quota\tSTORAGE\tlots\t-\t0\n", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseQuota(tt.output)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !maps.Equal(got, tt.want) {
+				t.Errorf("usage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
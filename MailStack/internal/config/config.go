@@ -1,12 +1,16 @@
 package config
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/mailstack/mailstack/internal/system"
 )
 
 // Config represents the main MailStack configuration
@@ -24,7 +28,10 @@ type Config struct {
 	Network    NetworkConfig  `json:"network"`
 	Paths      PathsConfig    `json:"paths"`
 	DKIMPath   string         `json:"dkim_path"`
-	SecretKey  string         `json:"secret_key"`
+
+	PasswordPolicy PasswordPolicyConfig `json:"password_policy"`
+	SecretKey      string               `json:"secret_key"`
+	APIToken       string               `json:"api_token,omitempty"` // bearer token of the REST API, which is off when empty
 
 	// Service addresses
 	FrontAddress    string `json:"front_address,omitempty"`
@@ -148,6 +155,20 @@ type PathsConfig struct {
 	Filter    string `json:"filter"`
 	Certs     string `json:"certs"`
 	Overrides string `json:"overrides"`
+	Backups   string `json:"backups"`
+}
+
+// PasswordPolicyConfig for mail user passwords
+type PasswordPolicyConfig struct {
+	MinLength   int  `json:"min_length"`
+	MinClasses  int  `json:"min_classes"`  // of lowercase, uppercase, digits and symbols
+	AllowCommon bool `json:"allow_common"` // skip the obvious-password check
+}
+
+// DefaultPasswordPolicy applies to settings missing from the config file
+var DefaultPasswordPolicy = PasswordPolicyConfig{
+	MinLength:  10,
+	MinClasses: 2,
 }
 
 // Load reads and parses the configuration file
@@ -157,7 +178,9 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var cfg Config
+	// Settings missing from the file keep their default, so that an
+	// explicit zero turns a password rule off
+	cfg := Config{PasswordPolicy: DefaultPasswordPolicy}
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
@@ -165,9 +188,96 @@ func Load(path string) (*Config, error) {
 	// Set defaults
 	cfg.setDefaults()
 
+	if err := cfg.checkDatabase(); err != nil {
+		return nil, err
+	}
+
+	// The secret key is generated once and saved with the config, as the
+	// vault token derived from it must stay the same across runs
+	if cfg.SecretKey == "" {
+		key := make([]byte, 16)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate secret_key: %w", err)
+		}
+		cfg.SecretKey = hex.EncodeToString(key)
+		if err := saveSecretKey(path, data, cfg.SecretKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.checkSecretKey(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
+// saveSecretKey adds a generated secret key to the config file, leaving
+// the other settings as they were written
+func saveSecretKey(path string, data []byte, key string) error {
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	settings["secret_key"], _ = json.Marshal(key)
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := system.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to save the generated secret_key: %w", err)
+	}
+	return nil
+}
+
+// checkSecretKey rejects a secret key that is short or still the
+// placeholder of the example configs: the vault token that gives out the
+// DKIM keys is derived from it
+func (c *Config) checkSecretKey() error {
+	if len(c.SecretKey) < 16 {
+		return fmt.Errorf("secret_key must be at least 16 characters")
+	}
+	if strings.HasPrefix(strings.ToUpper(c.SecretKey), "CHANGE") {
+		return fmt.Errorf("secret_key is still the example placeholder; remove it to have one generated")
+	}
+	return nil
+}
+
+// checkDatabase rejects database types mailstack cannot connect to
+func (c *Config) checkDatabase() error {
+	switch c.Database.Type {
+	case "", "sqlite", "postgresql", "postgres", "mysql", "mariadb":
+		return nil
+	default:
+		return fmt.Errorf("invalid database type: %s (must be sqlite, postgresql or mysql)", c.Database.Type)
+	}
+}
+
+// DatabaseDriver returns the name postfix and dovecot give the database
+// backend: sqlite, mysql or pgsql
+func (c *Config) DatabaseDriver() string {
+	switch c.Database.Type {
+	case "postgresql", "postgres":
+		return "pgsql"
+	case "mysql", "mariadb":
+		return "mysql"
+	default:
+		return "sqlite"
+	}
+}
+
+// DatabasePath returns the sqlite database file, taken from the DSN
+// first as mailstack itself connects that way
+func (c *Config) DatabasePath() string {
+	if strings.HasPrefix(c.Database.DSN, "sqlite:") {
+		return strings.TrimPrefix(c.Database.DSN, "sqlite:")
+	}
+	if c.Database.Path != "" {
+		return c.Database.Path
+	}
+	return c.Paths.Data + "/mailstack.db"
+}
+
 // Save writes the configuration to a file
 func (c *Config) Save(path string) error {
 	data, err := json.MarshalIndent(c, "", "  ")
@@ -204,9 +314,8 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database type is required")
 	}
 
-	validDBTypes := map[string]bool{"sqlite": true, "postgresql": true, "mysql": true}
-	if !validDBTypes[c.Database.Type] {
-		return fmt.Errorf("invalid database type: %s (must be sqlite, postgresql, or mysql)", c.Database.Type)
+	if err := c.checkDatabase(); err != nil {
+		return err
 	}
 
 	if c.TLS.Flavor == "" {
@@ -224,9 +333,33 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("TLS email is required for Let's Encrypt")
 	}
 
+	if err := c.checkSecretKey(); err != nil {
+		return err
+	}
+
+	if c.APIToken != "" && len(c.APIToken) < 32 {
+		return fmt.Errorf("API token must be at least 32 characters")
+	}
+
+	if c.PasswordPolicy.MinLength < 0 || c.PasswordPolicy.MinLength > 72 {
+		return fmt.Errorf("password_policy.min_length must be between 0 and 72")
+	}
+	if c.PasswordPolicy.MinClasses < 0 || c.PasswordPolicy.MinClasses > 4 {
+		return fmt.Errorf("password_policy.min_classes must be between 0 and 4")
+	}
+
 	return nil
 }
 
+// VaultToken is the token rspamd sends to fetch DKIM keys from mailstack
+// serve. It is derived from the secret key, so that the rspamd config and
+// the server agree without another setting.
+func (c *Config) VaultToken() string {
+	mac := hmac.New(sha256.New, []byte(c.SecretKey))
+	mac.Write([]byte("rspamd vault"))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
 // setDefaults sets default values for optional fields
 func (c *Config) setDefaults() {
 	if c.Postmaster == "" {
@@ -291,6 +424,9 @@ func (c *Config) setDefaults() {
 	if c.Paths.Overrides == "" {
 		c.Paths.Overrides = "/etc/mailstack/overrides"
 	}
+	if c.Paths.Backups == "" {
+		c.Paths.Backups = "/var/lib/mailstack/backups"
+	}
 
 	if c.DKIMPath == "" {
 		c.DKIMPath = c.Paths.DKIM + "/{domain}.{selector}.key"
@@ -367,6 +503,22 @@ func (c *Config) setDefaults() {
 		}
 	}
 
+	// Database server defaults, which postfix and dovecot need even when
+	// the DSN is given
+	switch c.DatabaseDriver() {
+	case "pgsql":
+		if c.Database.Port == 0 {
+			c.Database.Port = 5432
+		}
+	case "mysql":
+		if c.Database.Port == 0 {
+			c.Database.Port = 3306
+		}
+	}
+	if c.DatabaseDriver() != "sqlite" && c.Database.Host == "" {
+		c.Database.Host = "localhost"
+	}
+
 	// Database DSN construction
 	if c.Database.DSN == "" {
 		c.Database.DSN = c.buildDSN()
@@ -375,10 +527,8 @@ func (c *Config) setDefaults() {
 		c.Database.DBDsnw = c.Database.DSN
 	}
 
-	// Generate security keys if not provided
-	if c.SecretKey == "" {
-		c.SecretKey = generateRandomKey(32)
-	}
+	// Generate security keys if not provided. The secret key is left to
+	// Load, which saves it with the config.
 	if c.RoundcubeKey == "" && c.Webmail == "roundcube" {
 		c.RoundcubeKey = generateRandomKey(24)
 	}
@@ -397,32 +547,15 @@ func (c *Config) setDefaults() {
 
 // buildDSN constructs a database DSN string
 func (c *Config) buildDSN() string {
-	switch c.Database.Type {
-	case "sqlite":
-		if c.Database.Path != "" {
-			return "sqlite:" + c.Database.Path
-		}
-		return "sqlite:" + c.Paths.Data + "/mailstack.db"
-	case "postgresql":
-		if c.Database.Host == "" {
-			c.Database.Host = "localhost"
-		}
-		if c.Database.Port == 0 {
-			c.Database.Port = 5432
-		}
+	switch c.DatabaseDriver() {
+	case "pgsql":
 		return fmt.Sprintf("pgsql:host=%s;port=%d;dbname=%s;user=%s;password=%s",
 			c.Database.Host, c.Database.Port, c.Database.Name, c.Database.User, c.Database.Password)
 	case "mysql":
-		if c.Database.Host == "" {
-			c.Database.Host = "localhost"
-		}
-		if c.Database.Port == 0 {
-			c.Database.Port = 3306
-		}
 		return fmt.Sprintf("mysql:host=%s;port=%d;dbname=%s;user=%s;password=%s",
 			c.Database.Host, c.Database.Port, c.Database.Name, c.Database.User, c.Database.Password)
 	default:
-		return ""
+		return "sqlite:" + c.DatabasePath()
 	}
 }
 
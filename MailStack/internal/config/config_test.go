@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want PasswordPolicyConfig
+	}{
+		{name: "missing", json: `{}`, want: DefaultPasswordPolicy},
+		{name: "empty", json: `{"password_policy": {}}`, want: DefaultPasswordPolicy},
+		{name: "no minimum length", json: `{"password_policy": {"min_length": 0}}`, want: PasswordPolicyConfig{MinLength: 0, MinClasses: 2}},
+		{name: "no classes", json: `{"password_policy": {"min_classes": 0, "allow_common": true}}`, want: PasswordPolicyConfig{MinLength: 10, AllowCommon: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mailstack.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.PasswordPolicy != tt.want {
+				t.Errorf("password policy = %+v, want %+v", cfg.PasswordPolicy, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDatabase(t *testing.T) {
+	tests := []struct {
+		name       string
+		json       string
+		wantErr    bool
+		wantDriver string
+		wantPort   int
+		wantPath   string
+	}{
+		{name: "default", json: `{"paths": {"data": "/srv/mail"}}`, wantDriver: "sqlite", wantPath: "/srv/mail/mailstack.db"},
+		{name: "sqlite path", json: `{"database": {"type": "sqlite", "path": "/srv/db.sqlite"}}`, wantDriver: "sqlite", wantPath: "/srv/db.sqlite"},
+		{name: "sqlite dsn", json: `{"database": {"type": "sqlite", "dsn": "sqlite:/srv/dsn.sqlite", "path": "/srv/db.sqlite"}}`, wantDriver: "sqlite", wantPath: "/srv/dsn.sqlite"},
+		{name: "postgresql", json: `{"database": {"type": "postgresql"}}`, wantDriver: "pgsql", wantPort: 5432},
+		{name: "postgres", json: `{"database": {"type": "postgres", "port": 6432}}`, wantDriver: "pgsql", wantPort: 6432},
+		{name: "mysql", json: `{"database": {"type": "mysql"}}`, wantDriver: "mysql", wantPort: 3306},
+		{name: "mariadb with dsn", json: `{"database": {"type": "mariadb", "dsn": "mysql:host=db"}}`, wantDriver: "mysql", wantPort: 3306},
+		{name: "unknown", json: `{"database": {"type": "oracle"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mailstack.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := cfg.DatabaseDriver(); got != tt.wantDriver {
+				t.Errorf("driver = %q, want %q", got, tt.wantDriver)
+			}
+			if cfg.Database.Port != tt.wantPort {
+				t.Errorf("port = %d, want %d", cfg.Database.Port, tt.wantPort)
+			}
+			if tt.wantPath != "" && cfg.DatabasePath() != tt.wantPath {
+				t.Errorf("path = %q, want %q", cfg.DatabasePath(), tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestLoadSecretKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+		want    string // "" for a generated key
+	}{
+		{name: "missing", json: `{"domain": "example.com"}`},
+		{name: "empty", json: `{"domain": "example.com", "secret_key": ""}`},
+		{name: "set", json: `{"secret_key": "0123456789abcdef"}`, want: "0123456789abcdef"},
+		{name: "too short", json: `{"secret_key": "0123456789"}`, wantErr: true},
+		{name: "example placeholder", json: `{"secret_key": "CHANGE-THIS-TO-RANDOM-STRING-32-CHARS"}`, wantErr: true},
+		{name: "readme placeholder", json: `{"secret_key": "CHANGE-ME-TO-RANDOM-32-CHAR-STRING"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "mailstack.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := Load(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if tt.want != "" {
+				if cfg.SecretKey != tt.want {
+					t.Errorf("secret_key = %q, want %q", cfg.SecretKey, tt.want)
+				}
+				return
+			}
+
+			// A generated key is saved, so the vault token stays the same
+			if len(cfg.SecretKey) != 32 {
+				t.Errorf("generated secret_key %q is not 32 characters", cfg.SecretKey)
+			}
+			again, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load again: %v", err)
+			}
+			if again.SecretKey != cfg.SecretKey || again.Domain != "example.com" {
+				t.Errorf("reloaded secret_key %q and domain %q, want %q and example.com", again.SecretKey, again.Domain, cfg.SecretKey)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("config file mode = %v, want 0600", info.Mode().Perm())
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DomainAdmin grants a user the management of a domain's users and aliases
+type DomainAdmin struct {
+	User      string    `json:"user"`
+	Domain    string    `json:"domain"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddDomainAdmin makes user an administrator of domain
+func (db *DB) AddDomainAdmin(user, domain string) error {
+	if err := db.requireGlobalAdmin("grant domain admin rights"); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *DB) error {
+		var userID, domainID int64
+		err := tx.queryRow("SELECT id FROM users WHERE email = ?", user).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return errorf(ErrNotFound, "user %s does not exist", user)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		err = tx.queryRow("SELECT id FROM domains WHERE name = ?", domain).Scan(&domainID)
+		if err == sql.ErrNoRows {
+			return errorf(ErrNotFound, "domain %s does not exist", domain)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get domain: %w", err)
+		}
+
+		_, err = tx.exec("INSERT INTO domain_admins (user_id, domain_id) VALUES (?, ?)", userID, domainID)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return errorf(ErrExists, "%s is already an administrator of %s", user, domain)
+			}
+			return fmt.Errorf("failed to add domain admin: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteDomainAdmin revokes a user's administration of domain
+func (db *DB) DeleteDomainAdmin(user, domain string) error {
+	if err := db.requireGlobalAdmin("revoke domain admin rights"); err != nil {
+		return err
+	}
+
+	result, err := db.exec(`DELETE FROM domain_admins
+		WHERE user_id IN (SELECT id FROM users WHERE email = ?)
+		AND domain_id IN (SELECT id FROM domains WHERE name = ?)`, user, domain)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain admin: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete domain admin: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "%s is not an administrator of %s", user, domain)
+	}
+	return nil
+}
+
+// ListDomainAdmins returns the administrators of domain, or of every
+// domain the principal may see when domain is empty
+func (db *DB) ListDomainAdmins(domain string) ([]DomainAdmin, error) {
+	query := `
+		SELECT u.email, d.name, da.created_at
+		FROM domain_admins da
+		JOIN users u ON u.id = da.user_id
+		JOIN domains d ON d.id = da.domain_id`
+	var args []interface{}
+	if domain != "" {
+		if err := db.authorize(domain); err != nil {
+			return nil, err
+		}
+		var exists bool
+		err := db.queryRow("SELECT COUNT(*) > 0 FROM domains WHERE name = ?", domain).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check domain: %w", err)
+		}
+		if !exists {
+			return nil, errorf(ErrNotFound, "domain %s does not exist", domain)
+		}
+		query += " WHERE d.name = ?"
+		args = append(args, domain)
+	}
+
+	rows, err := db.query(query+" ORDER BY d.name, u.email", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query domain admins: %w", err)
+	}
+	defer rows.Close()
+
+	var admins []DomainAdmin
+	for rows.Next() {
+		var da DomainAdmin
+		if err := rows.Scan(&da.User, &da.Domain, &da.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan domain admin: %w", err)
+		}
+		if db.principal.CanManage(da.Domain) {
+			admins = append(admins, da)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating domain admins: %w", err)
+	}
+
+	return admins, nil
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Alternative is a domain whose mail is delivered to the same local parts
+// of its primary domain, e.g. user@example.net to user@example.com
+type Alternative struct {
+	Name      string    `json:"name"`
+	Domain    string    `json:"domain"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddAlternative makes name an alternative domain of domain
+func (db *DB) AddAlternative(name, domain string) error {
+	if err := db.requireGlobalAdmin("add alternative domains"); err != nil {
+		return err
+	}
+
+	if !strings.Contains(name, ".") || strings.ContainsAny(name, "@/%_ ") {
+		return errorf(ErrInvalid, "invalid domain format: %s", name)
+	}
+	if name == domain {
+		return errorf(ErrInvalid, "%s cannot be an alternative of itself", name)
+	}
+
+	var isDomain bool
+	err := db.queryRow("SELECT COUNT(*) > 0 FROM domains WHERE name = ?", name).Scan(&isDomain)
+	if err != nil {
+		return fmt.Errorf("failed to check domain: %w", err)
+	}
+	if isDomain {
+		return errorf(ErrConflict, "%s is already a mail domain", name)
+	}
+	var isRelay bool
+	err = db.queryRow("SELECT COUNT(*) > 0 FROM relays WHERE name = ?", name).Scan(&isRelay)
+	if err != nil {
+		return fmt.Errorf("failed to check relay domains: %w", err)
+	}
+	if isRelay {
+		return errorf(ErrConflict, "%s is a relay domain", name)
+	}
+
+	result, err := db.exec(`
+		INSERT INTO alternatives (name, domain_id)
+		SELECT ?, id FROM domains WHERE name = ?
+	`, name, domain)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return errorf(ErrExists, "alternative domain %s already exists", name)
+		}
+		return fmt.Errorf("failed to create alternative domain: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to create alternative domain: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "domain %s does not exist", domain)
+	}
+
+	return nil
+}
+
+// DeleteAlternative removes an alternative domain
+func (db *DB) DeleteAlternative(name string) error {
+	if err := db.requireGlobalAdmin("remove alternative domains"); err != nil {
+		return err
+	}
+
+	result, err := db.exec("DELETE FROM alternatives WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete alternative domain: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete alternative domain: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "alternative domain %s does not exist", name)
+	}
+	return nil
+}
+
+// ListAlternatives returns the alternative domains of domain, or of every
+// domain when domain is empty
+func (db *DB) ListAlternatives(domain string) ([]Alternative, error) {
+	query := `
+		SELECT a.name, d.name, a.created_at
+		FROM alternatives a
+		JOIN domains d ON d.id = a.domain_id`
+	var args []interface{}
+	if domain != "" {
+		var exists bool
+		err := db.queryRow("SELECT COUNT(*) > 0 FROM domains WHERE name = ?", domain).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check domain: %w", err)
+		}
+		if !exists {
+			return nil, errorf(ErrNotFound, "domain %s does not exist", domain)
+		}
+		query += " WHERE d.name = ?"
+		args = append(args, domain)
+	}
+
+	rows, err := db.query(query+" ORDER BY d.name, a.name", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alternative domains: %w", err)
+	}
+	defer rows.Close()
+
+	var alternatives []Alternative
+	for rows.Next() {
+		var alt Alternative
+		if err := rows.Scan(&alt.Name, &alt.Domain, &alt.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alternative domain: %w", err)
+		}
+		if db.principal.CanManage(alt.Domain) {
+			alternatives = append(alternatives, alt)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alternative domains: %w", err)
+	}
+
+	return alternatives, nil
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddAlternative(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddDomain("example.net"),
+		db.AddAlternative("example.org", "example.com"),
+		db.AddRelay("backup.example.info", "", ""),
+	)
+
+	tests := []struct {
+		name   string
+		alt    string
+		domain string
+		want   error
+	}{
+		{name: "alternative", alt: "example.info", domain: "example.com"},
+		{name: "mail domain", alt: "example.net", domain: "example.com", want: ErrConflict},
+		{name: "relay domain", alt: "backup.example.info", domain: "example.com", want: ErrConflict},
+		{name: "existing alternative", alt: "example.org", domain: "example.net", want: ErrExists},
+		{name: "itself", alt: "example.com", domain: "example.com", want: ErrInvalid},
+		{name: "missing primary", alt: "example.biz", domain: "example.edu", want: ErrNotFound},
+		{name: "invalid domain", alt: "example_org", domain: "example.com", want: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.AddAlternative(tt.alt, tt.domain)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AddAlternative(%q, %q) = %v, want %v", tt.alt, tt.domain, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("mail domain named like an alternative", func(t *testing.T) {
+		if err := db.AddDomain("example.org"); !errors.Is(err, ErrConflict) {
+			t.Errorf("AddDomain = %v, want ErrConflict", err)
+		}
+	})
+}
+
+func TestResolveAlternative(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddAlternative("example.org", "example.com"),
+		db.AddUser("alice@example.com", testPassword, 0),
+		db.AddAlias("info@example.com", "alice@example.com", ""),
+	)
+
+	tests := []struct {
+		name     string
+		address  string
+		wantRule string // empty when nothing receives the address
+	}{
+		{name: "user", address: "alice@example.org", wantRule: "alice@example.com"},
+		{name: "alias", address: "info@example.org", wantRule: "info@example.com"},
+		{name: "with an extension", address: "alice+news@example.org", wantRule: "alice@example.com"},
+		{name: "missing on the primary", address: "bob@example.org"},
+		{name: "not an alternative", address: "alice@example.net"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := db.ResolveAlias(tt.address, "+")
+			if tt.wantRule == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("ResolveAlias(%q) = %+v, %v; want ErrNotFound", tt.address, match, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveAlias(%q): %v", tt.address, err)
+			}
+			if match.Rule != tt.wantRule || match.Via != "example.org" || match.Address != tt.address {
+				t.Errorf("ResolveAlias(%q) = %+v, want rule %s via example.org", tt.address, *match, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestDeleteDomainAlternatives(t *testing.T) {
+	tests := []struct {
+		name   string
+		delete func(db *DB) error
+	}{
+		{name: "delete", delete: func(db *DB) error { return db.DeleteDomain("example.com") }},
+		{name: "cascade", delete: func(db *DB) error { return db.DeleteDomainCascade("example.com", nil) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			mustRun(t,
+				db.AddDomain("example.com"),
+				db.AddDomain("example.net"),
+				db.AddAlternative("example.org", "example.com"),
+				db.AddAlternative("example.info", "example.net"),
+			)
+
+			if err := tt.delete(db); err != nil {
+				t.Fatalf("deleting the primary domain: %v", err)
+			}
+
+			alternatives, err := db.ListAlternatives("")
+			if err != nil {
+				t.Fatalf("ListAlternatives: %v", err)
+			}
+			if len(alternatives) != 1 || alternatives[0].Name != "example.info" {
+				t.Errorf("alternatives left = %+v, want only example.info", alternatives)
+			}
+			// The name is free again
+			if err := db.AddDomain("example.org"); err != nil {
+				t.Errorf("AddDomain(example.org) after deleting its primary: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Ping checks that the database still answers
+func (db *DB) Ping() error {
+	if err := db.conn.Ping(); err != nil {
+		return errorf(ErrUnavailable, "failed to ping database: %w", err)
+	}
+	return nil
+}
+
+// Authenticate checks the password of a user logging in over protocol
+// ("imap", "pop3", "smtp", ...) from ip with the same rules as dovecot's
+// password queries: the user must be enabled, IMAP and POP3 must be
+// allowed for them, and an address in an alternative domain logs in as the
+// user of the primary domain. The password may also be one of the user's
+// tokens allowed from ip. It returns the canonical address.
+func (db *DB) Authenticate(email, password, protocol, ip string) (string, error) {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" || password == "" {
+		return "", errorf(ErrPermission, "invalid credentials")
+	}
+
+	var user, hash string
+	var enabled, imap, pop bool
+	err := db.queryRow(`
+		SELECT email, password_hash, enabled, enable_imap, enable_pop
+		FROM users
+		WHERE email = ? OR email IN (SELECT `+db.dialect.concat("?", "'@'", "d.name")+`
+			FROM alternatives a JOIN domains d ON d.id = a.domain_id WHERE a.name = ?)
+	`, email, local, domain).Scan(&user, &hash, &enabled, &imap, &pop)
+	if err == sql.ErrNoRows {
+		VerifyPassword(dummyHash(), password)
+		return "", errorf(ErrPermission, "invalid credentials")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !enabled || (protocol == "imap" && !imap) || (protocol == "pop3" && !pop) {
+		VerifyPassword(hash, password)
+		return "", errorf(ErrPermission, "invalid credentials")
+	}
+	ok = VerifyPassword(hash, password)
+	if !ok {
+		ok, err = db.checkToken(user, password, ip)
+		if err != nil {
+			return "", err
+		}
+	}
+	if !ok {
+		return "", errorf(ErrPermission, "invalid credentials")
+	}
+	return user, nil
+}
+
+// PrimaryDomain returns name if it is a mail domain, or the domain it is
+// an alternative of
+func (db *DB) PrimaryDomain(name string) (string, error) {
+	var primary string
+	err := db.queryRow(`
+		SELECT name FROM domains WHERE name = ?
+		UNION
+		SELECT d.name FROM alternatives a JOIN domains d ON d.id = a.domain_id WHERE a.name = ?
+	`, name, name).Scan(&primary)
+	if err == sql.ErrNoRows {
+		return "", errorf(ErrNotFound, "domain %s does not exist", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get domain: %w", err)
+	}
+	return primary, nil
+}
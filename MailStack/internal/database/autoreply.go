@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateFormat is how auto-reply start and end dates are written
+const DateFormat = "2006-01-02"
+
+// AutoReply is a user's vacation responder
+type AutoReply struct {
+	Email   string `json:"email"`
+	Enabled bool   `json:"enabled"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Start   string `json:"start,omitempty"` // first day replies are sent, empty for right away
+	End     string `json:"end,omitempty"`   // last day replies are sent, empty for no end
+	Days    int    `json:"days"`            // days before the same sender is answered again
+}
+
+// Status reports whether the auto-reply is off, scheduled, active or
+// expired on the day of now
+func (r *AutoReply) Status(now time.Time) string {
+	today := now.Format(DateFormat)
+	switch {
+	case !r.Enabled:
+		return "off"
+	case r.Start != "" && today < r.Start:
+		return "scheduled"
+	case r.End != "" && today > r.End:
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// GetAutoReply returns a user's auto-reply settings
+func (db *DB) GetAutoReply(email string) (*AutoReply, error) {
+	if err := db.authorizeAddress(email); err != nil {
+		return nil, err
+	}
+
+	r := AutoReply{Email: email}
+	var body sql.NullString
+	var start, end sql.NullTime
+	var days sql.NullInt64
+	err := db.queryRow(`
+		SELECT reply_enabled, COALESCE(reply_subject, ''), reply_body, reply_start, reply_end, reply_days
+		FROM users
+		WHERE email = ?
+	`, email).Scan(&r.Enabled, &r.Subject, &body, &start, &end, &days)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "user %s does not exist", email)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auto-reply: %w", err)
+	}
+
+	r.Body = body.String
+	if start.Valid {
+		r.Start = start.Time.Format(DateFormat)
+	}
+	if end.Valid {
+		r.End = end.Time.Format(DateFormat)
+	}
+	r.Days = int(days.Int64)
+	if r.Days < 1 {
+		r.Days = 1
+	}
+	return &r, nil
+}
+
+// SetAutoReply turns on a user's auto-reply with the settings in r. If
+// install is not nil it runs just before the commit, e.g. to write the
+// sieve script; if it fails the settings are not changed.
+func (db *DB) SetAutoReply(r AutoReply, install func() error) error {
+	if err := db.authorizeUser(r.Email); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(r.Subject) == "" {
+		return errorf(ErrInvalid, "auto-reply subject cannot be empty")
+	}
+	if strings.ContainsAny(r.Subject, "\r\n") {
+		return errorf(ErrInvalid, "auto-reply subject must be a single line")
+	}
+	if strings.TrimSpace(r.Body) == "" {
+		return errorf(ErrInvalid, "auto-reply message cannot be empty")
+	}
+	if r.Days < 1 {
+		return errorf(ErrInvalid, "days between replies to a sender must be at least 1")
+	}
+	start, err := nullDate(r.Start)
+	if err != nil {
+		return err
+	}
+	end, err := nullDate(r.End)
+	if err != nil {
+		return err
+	}
+	if r.Start != "" && r.End != "" && r.End < r.Start {
+		return errorf(ErrInvalid, "auto-reply ends (%s) before it starts (%s)", r.End, r.Start)
+	}
+
+	return db.Transaction(func(tx *DB) error {
+		result, err := tx.exec(`
+			UPDATE users
+			SET reply_enabled = ?, reply_subject = ?, reply_body = ?, reply_start = ?, reply_end = ?, reply_days = ?,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE email = ?
+		`, true, r.Subject, r.Body, start, end, r.Days, r.Email)
+		if err != nil {
+			return fmt.Errorf("failed to set auto-reply: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return errorf(ErrNotFound, "user %s does not exist", r.Email)
+		}
+		if install != nil {
+			return install()
+		}
+		return nil
+	})
+}
+
+// nullDate checks a YYYY-MM-DD date, returning nil for none
+func nullDate(date string) (interface{}, error) {
+	if date == "" {
+		return nil, nil
+	}
+	if _, err := time.Parse(DateFormat, date); err != nil {
+		return nil, errorf(ErrInvalid, "invalid date %q (use YYYY-MM-DD)", date)
+	}
+	return date, nil
+}
+
+// ClearAutoReply turns off a user's auto-reply, keeping the message for
+// the next time. If uninstall is not nil it runs just before the commit.
+func (db *DB) ClearAutoReply(email string, uninstall func() error) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *DB) error {
+		result, err := tx.exec(`
+			UPDATE users
+			SET reply_enabled = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE email = ?
+		`, false, email)
+		if err != nil {
+			return fmt.Errorf("failed to clear auto-reply: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return errorf(ErrNotFound, "user %s does not exist", email)
+		}
+		if uninstall != nil {
+			return uninstall()
+		}
+		return nil
+	})
+}
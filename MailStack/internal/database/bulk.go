@@ -0,0 +1,570 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Dataset is the portable form of the accounts in a database, used by
+// import and export
+type Dataset struct {
+	Domains      []DomainRecord      `json:"domains,omitempty" yaml:"domains,omitempty"`
+	Users        []UserRecord        `json:"users,omitempty" yaml:"users,omitempty"`
+	Aliases      []AliasRecord       `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	DomainAdmins []DomainAdminRecord `json:"domain_admins,omitempty" yaml:"domain_admins,omitempty"`
+}
+
+// DomainRecord is a domain in a Dataset
+type DomainRecord struct {
+	Name       string `json:"name" yaml:"name"`
+	MaxUsers   int    `json:"max_users,omitempty" yaml:"max_users,omitempty"`
+	MaxAliases int    `json:"max_aliases,omitempty" yaml:"max_aliases,omitempty"`
+	MaxQuota   int64  `json:"max_quota_bytes,omitempty" yaml:"max_quota_bytes,omitempty"`
+	Enabled    *bool  `json:"enabled,omitempty" yaml:"enabled,omitempty"` // nil means enabled
+}
+
+// UserRecord is a user in a Dataset. Exactly one of Password and
+// PasswordHash is set on import; export always fills PasswordHash.
+type UserRecord struct {
+	Email               string  `json:"email" yaml:"email"`
+	DisplayName         *string `json:"display_name,omitempty" yaml:"display_name,omitempty"` // nil means empty on create, unchanged by apply
+	Password            string  `json:"password,omitempty" yaml:"password,omitempty"`
+	PasswordHash        string  `json:"password_hash,omitempty" yaml:"password_hash,omitempty"` // BLF-CRYPT or SHA512-CRYPT
+	Quota               *int64  `json:"quota_bytes,omitempty" yaml:"quota_bytes,omitempty"`     // nil means unlimited on create, unchanged by apply
+	Enabled             *bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"`             // nil means enabled
+	EnableIMAP          *bool   `json:"enable_imap,omitempty" yaml:"enable_imap,omitempty"`     // nil means enabled
+	EnablePOP           *bool   `json:"enable_pop,omitempty" yaml:"enable_pop,omitempty"`       // nil means enabled
+	GlobalAdmin         bool    `json:"global_admin,omitempty" yaml:"global_admin,omitempty"`
+	ForcePasswordChange bool    `json:"force_password_change,omitempty" yaml:"force_password_change,omitempty"`
+}
+
+// AliasRecord is an alias in a Dataset
+type AliasRecord struct {
+	Email       string  `json:"email" yaml:"email"`
+	Destination string  `json:"destination" yaml:"destination"`
+	Enabled     *bool   `json:"enabled,omitempty" yaml:"enabled,omitempty"` // nil means enabled
+	Comment     *string `json:"comment,omitempty" yaml:"comment,omitempty"` // nil means empty on create, unchanged by apply
+}
+
+// DomainAdminRecord grants a user administration of a domain
+type DomainAdminRecord struct {
+	User   string `json:"user" yaml:"user"`
+	Domain string `json:"domain" yaml:"domain"`
+}
+
+// ImportReport summarizes a validated Dataset
+type ImportReport struct {
+	Domains      int      `json:"domains"`
+	Users        int      `json:"users"`
+	Aliases      int      `json:"aliases"`
+	DomainAdmins int      `json:"domain_admins"`
+	Unchanged    int      `json:"unchanged"` // existing domains identical to their record, left as they are
+	Errors       []string `json:"errors,omitempty"`
+}
+
+// Err returns the validation errors as one error, or nil
+func (r *ImportReport) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return errorf(ErrInvalid, "%d validation error(s):\n  %s", len(r.Errors), strings.Join(r.Errors, "\n  "))
+}
+
+// EnabledOr returns *b, or true when it is unset
+func EnabledOr(b *bool) bool {
+	return b == nil || *b
+}
+
+// Ptr returns a pointer to v, for the optional fields of records and
+// updates
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// StringOr returns *s, or "" when it is unset
+func StringOr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// quotaOr returns *q, or 0 (unlimited) when it is unset
+func quotaOr(q *int64) int64 {
+	if q == nil {
+		return 0
+	}
+	return *q
+}
+
+var (
+	bcryptHash      = regexp.MustCompile(`^\$2[abxy]?\$\d\d\$[./0-9A-Za-z]{53}$`)
+	sha512CryptHash = regexp.MustCompile(`^\$6\$(rounds=\d+\$)?[./0-9A-Za-z]{1,16}\$[./0-9A-Za-z]{86}$`)
+)
+
+// NormalizeHash returns a pre-hashed password in the form stored in the
+// users table: bare bcrypt (dovecot's default BLF-CRYPT scheme) or
+// {SHA512-CRYPT}-prefixed crypt(3) hashes
+func NormalizeHash(hash string) (string, error) {
+	scheme := ""
+	if strings.HasPrefix(hash, "{") {
+		end := strings.Index(hash, "}")
+		if end < 0 {
+			return "", errorf(ErrInvalid, "malformed password scheme prefix")
+		}
+		scheme, hash = strings.ToUpper(hash[1:end]), hash[end+1:]
+	}
+
+	switch {
+	case (scheme == "" || scheme == "BLF-CRYPT") && bcryptHash.MatchString(hash):
+		return hash, nil
+	case (scheme == "" || scheme == "SHA512-CRYPT") && sha512CryptHash.MatchString(hash):
+		return "{SHA512-CRYPT}" + hash, nil
+	case scheme != "" && scheme != "BLF-CRYPT" && scheme != "SHA512-CRYPT":
+		return "", errorf(ErrInvalid, "unsupported password scheme %s (only BLF-CRYPT and SHA512-CRYPT)", scheme)
+	default:
+		return "", errorf(ErrInvalid, "password hash is not a valid BLF-CRYPT or SHA512-CRYPT hash")
+	}
+}
+
+// ValidateImport checks every record of ds against itself and the current
+// database without changing anything. Hashes are normalized in place.
+func (db *DB) ValidateImport(ds *Dataset) (*ImportReport, error) {
+	if err := db.requireGlobalAdmin("import accounts"); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		Domains:      len(ds.Domains),
+		Users:        len(ds.Users),
+		Aliases:      len(ds.Aliases),
+		DomainAdmins: len(ds.DomainAdmins),
+	}
+	fail := func(format string, args ...interface{}) {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+	}
+	exists := func(table, column, value string) (bool, error) {
+		var found bool
+		err := db.queryRow("SELECT COUNT(*) > 0 FROM "+table+" WHERE "+column+" = ?", value).Scan(&found)
+		if err != nil {
+			return false, fmt.Errorf("failed to check %s: %w", table, err)
+		}
+		return found, nil
+	}
+
+	// Domains the import creates. An existing domain with the same limits
+	// is left as it is, so that an export can be imported into a fresh
+	// install that already has its primary domain.
+	domains := make(map[string]bool)
+	seen := make(map[string]bool)
+	for i, d := range ds.Domains {
+		where := fmt.Sprintf("domains[%d] %s", i, d.Name)
+		if !strings.Contains(d.Name, ".") || strings.ContainsAny(d.Name, "@/ ") {
+			fail("%s: invalid domain name", where)
+			continue
+		}
+		if seen[d.Name] {
+			fail("%s: duplicate domain", where)
+			continue
+		}
+		seen[d.Name] = true
+		if d.MaxUsers < 0 || d.MaxAliases < 0 || d.MaxQuota < 0 {
+			fail("%s: limits cannot be negative", where)
+		}
+
+		have, err := db.GetDomain(d.Name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			domains[d.Name] = true
+		case err != nil:
+			return nil, err
+		case have.MaxUsers == d.MaxUsers && have.MaxAliases == d.MaxAliases &&
+			have.MaxQuota == d.MaxQuota && have.Enabled == EnabledOr(d.Enabled):
+			report.Domains--
+			report.Unchanged++
+		default:
+			fail("%s: domain already exists with different settings", where)
+		}
+	}
+	domainKnown := func(domain string) (bool, error) {
+		if domains[domain] {
+			return true, nil
+		}
+		return exists("domains", "name", domain)
+	}
+
+	// Limits and usage of each domain, counting the records imported so far
+	limits := make(map[string]*Domain)
+	for _, d := range ds.Domains {
+		if domains[d.Name] && limits[d.Name] == nil {
+			limits[d.Name] = &Domain{Name: d.Name, MaxUsers: d.MaxUsers, MaxAliases: d.MaxAliases, MaxQuota: d.MaxQuota}
+		}
+	}
+	limitsOf := func(domain string) (*Domain, error) {
+		if d, ok := limits[domain]; ok {
+			return d, nil
+		}
+		d, err := db.GetDomain(domain)
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		limits[domain] = d
+		return d, err
+	}
+
+	// Addresses known after the import, mapped to whether they are users
+	addresses := make(map[string]bool)
+	for i := range ds.Users {
+		u := &ds.Users[i]
+		where := fmt.Sprintf("users[%d] %s", i, u.Email)
+
+		parts := strings.Split(u.Email, "@")
+		if len(parts) != 2 || parts[0] == "" {
+			fail("%s: invalid email format", where)
+			continue
+		}
+		if _, dup := addresses[u.Email]; dup {
+			fail("%s: duplicate user", where)
+			continue
+		}
+		addresses[u.Email] = true
+
+		known, err := domainKnown(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			fail("%s: domain %s does not exist", where, parts[1])
+		}
+		found, err := exists("users", "email", u.Email)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			fail("%s: user already exists", where)
+		}
+
+		switch {
+		case u.Password != "" && u.PasswordHash != "":
+			fail("%s: set either password or password_hash, not both", where)
+		case u.Password != "":
+			if err := CheckPassword(db.policy, u.Email, u.Password); err != nil {
+				fail("%s: %v", where, err)
+			}
+		case u.PasswordHash != "":
+			hash, err := NormalizeHash(u.PasswordHash)
+			if err != nil {
+				fail("%s: %v", where, err)
+			} else {
+				u.PasswordHash = hash
+			}
+		default:
+			fail("%s: password or password_hash is required", where)
+		}
+		quota := quotaOr(u.Quota)
+		if quota < 0 {
+			fail("%s: quota cannot be negative", where)
+		}
+
+		d, err := limitsOf(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			if err := d.checkQuota(quota); err != nil && quota >= 0 {
+				fail("%s: %v", where, err)
+			}
+			if d.UserCount++; d.MaxUsers > 0 && d.UserCount > d.MaxUsers {
+				fail("%s: domain %s would exceed its limit of %d users", where, d.Name, d.MaxUsers)
+			}
+		}
+	}
+
+	for i := range ds.Aliases {
+		a := &ds.Aliases[i]
+		where := fmt.Sprintf("aliases[%d] %s", i, a.Email)
+
+		a.Email = AliasKey(a.Email)
+		domain, _, err := checkAliasKey(a.Email)
+		if err != nil {
+			fail("%s: %v", where, err)
+			continue
+		}
+		if isUser, dup := addresses[a.Email]; dup {
+			if isUser {
+				fail("%s: already a user in this import", where)
+			} else {
+				fail("%s: duplicate alias", where)
+			}
+			continue
+		}
+		addresses[a.Email] = false
+
+		known, err := domainKnown(domain)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			fail("%s: domain %s does not exist", where, domain)
+		}
+		for _, table := range []string{"aliases", "users"} {
+			found, err := exists(table, "email", a.Email)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				fail("%s: address already exists in %s", where, table)
+			}
+		}
+		destination, err := NormalizeDestinations(a.Destination)
+		if err != nil {
+			fail("%s: %v", where, err)
+		} else {
+			a.Destination = destination
+		}
+
+		d, err := limitsOf(domain)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			if d.AliasCount++; d.MaxAliases > 0 && d.AliasCount > d.MaxAliases {
+				fail("%s: domain %s would exceed its limit of %d aliases", where, d.Name, d.MaxAliases)
+			}
+		}
+	}
+
+	grants := make(map[DomainAdminRecord]bool)
+	for i, da := range ds.DomainAdmins {
+		where := fmt.Sprintf("domain_admins[%d] %s/%s", i, da.User, da.Domain)
+		if grants[da] {
+			fail("%s: duplicate grant", where)
+			continue
+		}
+		grants[da] = true
+
+		isUser := addresses[da.User]
+		if !isUser {
+			found, err := exists("users", "email", da.User)
+			if err != nil {
+				return nil, err
+			}
+			isUser = found
+		}
+		if !isUser {
+			fail("%s: user %s does not exist", where, da.User)
+		}
+		known, err := domainKnown(da.Domain)
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			fail("%s: domain %s does not exist", where, da.Domain)
+		}
+
+		var granted bool
+		err = db.queryRow(`SELECT COUNT(*) > 0 FROM domain_admins da
+			JOIN users u ON u.id = da.user_id
+			JOIN domains d ON d.id = da.domain_id
+			WHERE u.email = ? AND d.name = ?`, da.User, da.Domain).Scan(&granted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check domain admins: %w", err)
+		}
+		if granted {
+			fail("%s: grant already exists", where)
+		}
+	}
+
+	return report, nil
+}
+
+// Import validates ds and then creates all of its records in a single
+// transaction. Nothing is written if any record is invalid.
+func (db *DB) Import(ds *Dataset) (*ImportReport, error) {
+	report, err := db.ValidateImport(ds)
+	if err != nil {
+		return nil, err
+	}
+	if err := report.Err(); err != nil {
+		return report, err
+	}
+
+	// Hash plain passwords before opening the transaction
+	hashes := make([]string, len(ds.Users))
+	for i, u := range ds.Users {
+		if u.PasswordHash != "" {
+			hashes[i] = u.PasswordHash
+			continue
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return report, fmt.Errorf("failed to hash password for %s: %w", u.Email, err)
+		}
+		hashes[i] = string(hashed)
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) error {
+		_, err := tx.Exec(db.dialect.rebind(query), args...)
+		return err
+	}
+
+	// Domains that already exist were checked to be identical
+	for _, d := range ds.Domains {
+		if err := exec(db.dialect.insertIgnore(`INSERT INTO domains (name, max_users, max_aliases, max_quota_bytes, enabled)
+			VALUES (?, ?, ?, ?, ?)`), d.Name, d.MaxUsers, d.MaxAliases, d.MaxQuota, EnabledOr(d.Enabled)); err != nil {
+			return report, fmt.Errorf("failed to create domain %s: %w", d.Name, err)
+		}
+	}
+	for i, u := range ds.Users {
+		if err := exec(`INSERT INTO users (email, password_hash, display_name, quota_bytes, enabled,
+				enable_imap, enable_pop, global_admin, force_password_change)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			u.Email, hashes[i], StringOr(u.DisplayName), quotaOr(u.Quota), EnabledOr(u.Enabled),
+			EnabledOr(u.EnableIMAP), EnabledOr(u.EnablePOP), u.GlobalAdmin, u.ForcePasswordChange); err != nil {
+			return report, fmt.Errorf("failed to create user %s: %w", u.Email, err)
+		}
+	}
+	for _, a := range ds.Aliases {
+		_, wildcard, _ := checkAliasKey(a.Email)
+		if err := exec("INSERT INTO aliases (email, destination, wildcard, enabled, comment) VALUES (?, ?, ?, ?, ?)",
+			a.Email, a.Destination, wildcard, EnabledOr(a.Enabled), StringOr(a.Comment)); err != nil {
+			return report, fmt.Errorf("failed to create alias %s: %w", a.Email, err)
+		}
+	}
+	// Loops can only be seen once every alias is in place
+	scoped := *db
+	scoped.tx = tx.Tx
+	for _, a := range ds.Aliases {
+		if !EnabledOr(a.Enabled) {
+			continue
+		}
+		if err := scoped.checkAliasLoop(a.Email, a.Destination); err != nil {
+			return report, fmt.Errorf("alias %s: %w", a.Email, err)
+		}
+	}
+	for _, da := range ds.DomainAdmins {
+		if err := exec(`INSERT INTO domain_admins (user_id, domain_id)
+			SELECT u.id, d.id FROM users u, domains d WHERE u.email = ? AND d.name = ?`,
+			da.User, da.Domain); err != nil {
+			return report, fmt.Errorf("failed to grant %s admin of %s: %w", da.User, da.Domain, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return report, nil
+}
+
+// Export returns every domain, user, alias and domain admin grant
+func (db *DB) Export() (*Dataset, error) {
+	if err := db.requireGlobalAdmin("export accounts"); err != nil {
+		return nil, err
+	}
+
+	ds := &Dataset{}
+
+	collect := func(what, query string, scan func(rows *sql.Rows) error) error {
+		rows, err := db.query(query)
+		if err != nil {
+			return fmt.Errorf("failed to query %s: %w", what, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				return fmt.Errorf("failed to scan %s: %w", what, err)
+			}
+		}
+		return rows.Err()
+	}
+
+	err := collect("domains", `SELECT name, max_users, max_aliases, max_quota_bytes, enabled
+		FROM domains ORDER BY name`, func(rows *sql.Rows) error {
+		var d DomainRecord
+		var enabled bool
+		var maxUsers, maxAliases sql.NullInt64
+		var maxQuota sql.NullInt64
+		if err := rows.Scan(&d.Name, &maxUsers, &maxAliases, &maxQuota, &enabled); err != nil {
+			return err
+		}
+		d.MaxUsers, d.MaxAliases, d.MaxQuota = int(maxUsers.Int64), int(maxAliases.Int64), maxQuota.Int64
+		d.Enabled = Ptr(enabled)
+		ds.Domains = append(ds.Domains, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collect("users", `SELECT email, display_name, password_hash, quota_bytes, enabled,
+			enable_imap, enable_pop, global_admin, force_password_change
+		FROM users ORDER BY email`, func(rows *sql.Rows) error {
+		var u UserRecord
+		var displayName sql.NullString
+		var enabled, imap, pop bool
+		var quota int64
+		if err := rows.Scan(&u.Email, &displayName, &u.PasswordHash, &quota, &enabled,
+			&imap, &pop, &u.GlobalAdmin, &u.ForcePasswordChange); err != nil {
+			return err
+		}
+		u.Quota = &quota
+		if displayName.String != "" {
+			u.DisplayName = &displayName.String
+		}
+		u.Enabled, u.EnableIMAP, u.EnablePOP = Ptr(enabled), Ptr(imap), Ptr(pop)
+		ds.Users = append(ds.Users, u)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collect("aliases", "SELECT email, destination, enabled, comment FROM aliases ORDER BY email",
+		func(rows *sql.Rows) error {
+			var a AliasRecord
+			var enabled bool
+			var comment string
+			if err := rows.Scan(&a.Email, &a.Destination, &enabled, &comment); err != nil {
+				return err
+			}
+			a.Enabled = Ptr(enabled)
+			if comment != "" {
+				a.Comment = &comment
+			}
+			ds.Aliases = append(ds.Aliases, a)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collect("domain admins", `SELECT u.email, d.name
+		FROM domain_admins da
+		JOIN users u ON u.id = da.user_id
+		JOIN domains d ON d.id = da.domain_id
+		ORDER BY d.name, u.email`, func(rows *sql.Rows) error {
+		var da DomainAdminRecord
+		if err := rows.Scan(&da.User, &da.Domain); err != nil {
+			return err
+		}
+		ds.DomainAdmins = append(ds.DomainAdmins, da)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
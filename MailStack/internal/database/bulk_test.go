@@ -0,0 +1,94 @@
+package database_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/database/databasetest"
+)
+
+func TestImportExportRoundTrip(t *testing.T) {
+	source := databasetest.NewDB(t, databasetest.Dataset())
+	exported, err := source.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	target := databasetest.NewDB(t, nil)
+	report, err := target.Import(exported)
+	if err != nil {
+		t.Fatalf("Import of the export: %v", err)
+	}
+	want := database.ImportReport{Domains: 2, Users: 2, Aliases: 2, DomainAdmins: 1}
+	if !reflect.DeepEqual(*report, want) {
+		t.Errorf("report = %+v, want %+v", *report, want)
+	}
+
+	again, err := target.Export()
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if !reflect.DeepEqual(again, exported) {
+		t.Errorf("round trip changed the dataset:\n got %+v\nwant %+v", again, exported)
+	}
+
+	// The exported hash still checks the original password
+	if _, err := target.Authenticate("alice@example.com", databasetest.Password, "imap", "127.0.0.1"); err != nil {
+		t.Errorf("Authenticate after round trip: %v", err)
+	}
+}
+
+func TestValidateImportExistingDomain(t *testing.T) {
+	tests := []struct {
+		name      string
+		domain    database.DomainRecord
+		wantErr   string
+		wantNew   int
+		unchanged int
+	}{
+		{name: "new", domain: database.DomainRecord{Name: "example.org"}, wantNew: 1},
+		{name: "identical", domain: database.DomainRecord{Name: "example.com", MaxUsers: 10, MaxAliases: 20, MaxQuota: 1 << 30}, unchanged: 1},
+		{name: "identical and explicitly enabled", domain: database.DomainRecord{Name: "example.com", MaxUsers: 10, MaxAliases: 20, MaxQuota: 1 << 30, Enabled: database.Ptr(true)}, unchanged: 1},
+		{name: "other limits", domain: database.DomainRecord{Name: "example.com", MaxUsers: 11, MaxAliases: 20, MaxQuota: 1 << 30}, wantErr: "different settings"},
+		{name: "disabled", domain: database.DomainRecord{Name: "example.com", MaxUsers: 10, MaxAliases: 20, MaxQuota: 1 << 30, Enabled: database.Ptr(false)}, wantErr: "different settings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databasetest.NewDB(t, &database.Dataset{Domains: databasetest.Dataset().Domains[:1]})
+
+			ds := &database.Dataset{
+				Domains: []database.DomainRecord{tt.domain},
+				Users:   []database.UserRecord{{Email: "carol@" + tt.domain.Name, Password: databasetest.Password, Quota: database.Ptr(int64(1 << 20))}},
+			}
+			report, err := db.ValidateImport(ds)
+			if err != nil {
+				t.Fatalf("ValidateImport: %v", err)
+			}
+
+			if tt.wantErr != "" {
+				if err := report.Err(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("report error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err := report.Err(); err != nil {
+				t.Fatalf("report error = %v", err)
+			}
+			if report.Domains != tt.wantNew || report.Unchanged != tt.unchanged {
+				t.Errorf("report has %d new and %d unchanged domains, want %d and %d",
+					report.Domains, report.Unchanged, tt.wantNew, tt.unchanged)
+			}
+
+			// Applying the import leaves an identical domain as it is
+			if _, err := db.Import(ds); err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if _, err := db.GetUser(ds.Users[0].Email); err != nil {
+				t.Errorf("imported user: %v", err)
+			}
+		})
+	}
+}
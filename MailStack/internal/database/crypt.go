@@ -0,0 +1,154 @@
+package database
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// VerifyPassword reports whether password matches a hash stored in the
+// users table: bare bcrypt, {BLF-CRYPT} or {SHA512-CRYPT} prefixed
+func VerifyPassword(hash, password string) bool {
+	scheme := ""
+	if strings.HasPrefix(hash, "{") {
+		end := strings.Index(hash, "}")
+		if end < 0 {
+			return false
+		}
+		scheme, hash = strings.ToUpper(hash[1:end]), hash[end+1:]
+	}
+
+	switch {
+	case (scheme == "" || scheme == "BLF-CRYPT") && strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case (scheme == "" || scheme == "SHA512-CRYPT") && strings.HasPrefix(hash, "$6$"):
+		computed, ok := sha512Crypt(password, hash)
+		return ok && subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+	default:
+		return false
+	}
+}
+
+// dummyHash is checked against when there is no account to check, so that
+// a login takes as long whether or not the account exists
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte("mailstack"), bcrypt.DefaultCost)
+	if err != nil {
+		return ""
+	}
+	return string(hash)
+})
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha512Crypt hashes password with the salt and rounds of setting, a
+// crypt(3) "$6$[rounds=N$]salt[$hash]" string, as specified in
+// https://www.akkadia.org/drepper/SHA-crypt.txt
+func sha512Crypt(password, setting string) (string, bool) {
+	rest := strings.TrimPrefix(setting, "$6$")
+	rounds, customRounds := 5000, false
+	if r, ok := strings.CutPrefix(rest, "rounds="); ok {
+		n, after, found := strings.Cut(r, "$")
+		value, err := strconv.Atoi(n)
+		if !found || err != nil {
+			return "", false
+		}
+		rounds, customRounds, rest = min(max(value, 1000), 999999999), true, after
+	}
+	salt, _, _ := strings.Cut(rest, "$")
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	p, s := []byte(password), []byte(salt)
+
+	b := sha512.New()
+	b.Write(p)
+	b.Write(s)
+	b.Write(p)
+	digestB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(p)
+	a.Write(s)
+	i := len(p)
+	for ; i > 64; i -= 64 {
+		a.Write(digestB)
+	}
+	a.Write(digestB[:i])
+	for i := len(p); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(digestB)
+		} else {
+			a.Write(p)
+		}
+	}
+	digestA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range p {
+		dp.Write(p)
+	}
+	pSeq := repeatTo(dp.Sum(nil), len(p))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		ds.Write(s)
+	}
+	sSeq := repeatTo(ds.Sum(nil), len(s))
+
+	for r := 0; r < rounds; r++ {
+		c := sha512.New()
+		if r&1 != 0 {
+			c.Write(pSeq)
+		} else {
+			c.Write(digestA)
+		}
+		if r%3 != 0 {
+			c.Write(sSeq)
+		}
+		if r%7 != 0 {
+			c.Write(pSeq)
+		}
+		if r&1 != 0 {
+			c.Write(digestA)
+		} else {
+			c.Write(pSeq)
+		}
+		digestA = c.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if customRounds {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.WriteString(salt + "$")
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for ; n > 0; n-- {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	// Each group takes bytes i, i+21 and i+42, rotated by i%3
+	for i := 0; i < 21; i++ {
+		g := [3]byte{digestA[i], digestA[i+21], digestA[i+42]}
+		r := i % 3
+		encode(g[r], g[(r+1)%3], g[(r+2)%3], 4)
+	}
+	encode(0, 0, digestA[63], 2)
+	return out.String(), true
+}
+
+// repeatTo repeats digest to fill n bytes
+func repeatTo(digest []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, digest[:min(len(digest), n-len(out))]...)
+	}
+	return out
+}
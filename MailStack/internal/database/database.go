@@ -2,9 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 
@@ -13,60 +20,180 @@ import (
 
 // DB represents a database connection
 type DB struct {
-	config config.DatabaseConfig
-	conn   *sql.DB
+	config  config.DatabaseConfig
+	dialect dialect
+	conn    *sql.DB
+	tx      *sql.Tx         // set on the DB passed to a Transaction callback
+	hooks   *[]func() error // run by Transaction once it has committed
+	policy  config.PasswordPolicyConfig
+
+	principal *Principal // who changes are made for, nil when unrestricted
 }
 
 // User represents a mail user
 type User struct {
-	Email   string
-	Quota   int64
-	Enabled bool
+	Email               string    `json:"email"`
+	DisplayName         string    `json:"display_name"`
+	Quota               int64     `json:"quota_bytes"`      // bytes, 0 means unlimited
+	QuotaUsed           int64     `json:"quota_bytes_used"` // bytes, as last reported by dovecot
+	Enabled             bool      `json:"enabled"`
+	EnableIMAP          bool      `json:"enable_imap"`
+	EnablePOP           bool      `json:"enable_pop"`
+	GlobalAdmin         bool      `json:"global_admin"`
+	ForcePasswordChange bool      `json:"force_password_change"` // the password should be replaced; logins still work
+	ForwardEnabled      bool      `json:"forward_enabled"`
+	ForwardDestination  string    `json:"forward_destination"` // comma-separated addresses
+	ForwardKeep         bool      `json:"forward_keep"`        // keep a copy in the mailbox
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// UserUpdate lists the user attributes to change; nil fields are left as is
+type UserUpdate struct {
+	DisplayName         *string
+	Quota               *int64
+	Enabled             *bool
+	EnableIMAP          *bool
+	EnablePOP           *bool
+	GlobalAdmin         *bool
+	ForcePasswordChange *bool
+}
+
+// userColumns are selected by every user query, in scanUser order
+const userColumns = `email, display_name, quota_bytes, quota_bytes_used, enabled,
+		enable_imap, enable_pop, global_admin, force_password_change,
+		forward_enabled, COALESCE(forward_destination, ''), forward_keep, created_at, updated_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads one row selected with userColumns
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var displayName sql.NullString
+	var createdAt, updatedAt sql.NullTime
+	err := row.Scan(&user.Email, &displayName, &user.Quota, &user.QuotaUsed, &user.Enabled,
+		&user.EnableIMAP, &user.EnablePOP, &user.GlobalAdmin, &user.ForcePasswordChange,
+		&user.ForwardEnabled, &user.ForwardDestination, &user.ForwardKeep, &createdAt, &updatedAt)
+	user.DisplayName = displayName.String
+	user.CreatedAt = createdAt.Time
+	user.UpdatedAt = updatedAt.Time
+	return user, err
 }
 
 // Domain represents a mail domain
 type Domain struct {
-	Name      string
-	UserCount int
+	Name       string `json:"name"`
+	UserCount  int    `json:"user_count"`
+	AliasCount int    `json:"alias_count"`
+	MaxUsers   int    `json:"max_users"`       // 0 means unlimited
+	MaxAliases int    `json:"max_aliases"`     // 0 means unlimited
+	MaxQuota   int64  `json:"max_quota_bytes"` // largest quota of a user, 0 means unlimited
+	Enabled    bool   `json:"enabled"`
 }
 
 // Connect establishes a database connection
 func Connect(cfg config.DatabaseConfig) (*DB, error) {
-	var dbPath string
+	d, err := dialectFor(cfg.Type)
+	if err != nil {
+		return nil, err
+	}
 
-	// Parse DSN to get database path
-	if cfg.DSN != "" {
-		// DSN format: "sqlite:/path/to/db"
-		dsn := cfg.DSN
-		if strings.HasPrefix(dsn, "sqlite:") {
-			dbPath = strings.TrimPrefix(dsn, "sqlite:")
-		} else {
-			dbPath = dsn
-		}
-	} else if cfg.Path != "" {
-		dbPath = cfg.Path
-	} else {
-		return nil, fmt.Errorf("no database path specified")
+	dsn, err := driverDSN(d, cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	// Open SQLite connection
-	conn, err := sql.Open("sqlite3", dbPath)
+	// Open connection using the backend's driver
+	conn, err := sql.Open(d.driver, dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, errorf(ErrUnavailable, "failed to open database: %w", err)
 	}
 
 	// Test connection
 	if err := conn.Ping(); err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, errorf(ErrUnavailable, "failed to ping database: %w", err)
 	}
 
 	return &DB{
-		config: cfg,
-		conn:   conn,
+		config:  cfg,
+		dialect: d,
+		conn:    conn,
+		policy:  config.DefaultPasswordPolicy,
 	}, nil
 }
 
+// driverDSN builds the connection string understood by the Go driver.
+// The DSN in the config is PHP PDO style (it is shared with roundcube), so
+// for the network backends it is only used when given in native form.
+func driverDSN(d dialect, cfg config.DatabaseConfig) (string, error) {
+	switch d.name {
+	case "postgresql":
+		if strings.HasPrefix(cfg.DSN, "postgres://") || strings.HasPrefix(cfg.DSN, "postgresql://") {
+			return cfg.DSN, nil
+		}
+		host, port := cfg.Host, cfg.Port
+		if host == "" {
+			host = "localhost"
+		}
+		if port == 0 {
+			port = 5432
+		}
+		sslMode := "require"
+		if host == "localhost" || host == "127.0.0.1" || strings.HasPrefix(host, "/") {
+			sslMode = "disable"
+		}
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.User, cfg.Password),
+			Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+			Path:     "/" + cfg.Name,
+			RawQuery: "sslmode=" + sslMode,
+		}
+		return u.String(), nil
+
+	case "mysql":
+		if cfg.DSN != "" && !strings.HasPrefix(cfg.DSN, "mysql:") {
+			return cfg.DSN, nil
+		}
+		host, port := cfg.Host, cfg.Port
+		if host == "" {
+			host = "localhost"
+		}
+		if port == 0 {
+			port = 3306
+		}
+		mc := mysql.NewConfig()
+		mc.User = cfg.User
+		mc.Passwd = cfg.Password
+		mc.Net = "tcp"
+		mc.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+		mc.DBName = cfg.Name
+		mc.ParseTime = true
+		// Report matched rather than changed rows, like the other backends
+		mc.ClientFoundRows = true
+		return mc.FormatDSN(), nil
+
+	default:
+		// DSN format: "sqlite:/path/to/db"
+		if cfg.DSN != "" {
+			return strings.TrimPrefix(cfg.DSN, "sqlite:"), nil
+		}
+		if cfg.Path != "" {
+			return cfg.Path, nil
+		}
+		return "", fmt.Errorf("no database path specified")
+	}
+}
+
+// SetPasswordPolicy sets the policy enforced by AddUser and ChangePassword
+func (db *DB) SetPasswordPolicy(policy config.PasswordPolicyConfig) {
+	db.policy = policy
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	if db.conn != nil {
@@ -77,80 +204,130 @@ func (db *DB) Close() error {
 
 // AddUser adds a new mail user
 func (db *DB) AddUser(email, password string, quota int64) error {
+	if err := db.authorizeAddress(email); err != nil {
+		return err
+	}
+
+	if err := CheckPassword(db.policy, email, password); err != nil {
+		return err
+	}
+
 	// Hash password with bcrypt
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Extract domain from email
-	parts := strings.Split(email, "@")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid email format: %s", email)
+	return db.addUser(email, string(hashedPassword), quota)
+}
+
+// AddUserHash adds a new mail user whose password is already hashed, in
+// one of the schemes accepted by NormalizeHash
+func (db *DB) AddUserHash(email, hash string, quota int64) error {
+	if err := db.authorizeAddress(email); err != nil {
+		return err
 	}
-	domain := parts[1]
 
-	// Check if domain exists
-	var domainExists bool
-	err = db.conn.QueryRow("SELECT COUNT(*) > 0 FROM domains WHERE name = ?", domain).Scan(&domainExists)
+	hash, err := NormalizeHash(hash)
 	if err != nil {
-		return fmt.Errorf("failed to check domain: %w", err)
-	}
-	if !domainExists {
-		return fmt.Errorf("domain %s does not exist - add it first with 'mailstack domain add %s'", domain, domain)
+		return err
 	}
+	return db.addUser(email, hash, quota)
+}
 
-	// Insert user
-	_, err = db.conn.Exec(`
-		INSERT INTO users (email, password_hash, quota_bytes, enabled, global_admin)
-		VALUES (?, ?, ?, 1, 0)
-	`, email, string(hashedPassword), quota)
+// addUser inserts a user with a hashed password, within the limits of
+// the user's domain
+func (db *DB) addUser(email, hash string, quota int64) error {
+	// Extract domain from email
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return errorf(ErrInvalid, "invalid email format: %s", email)
+	}
+	domain := parts[1]
 
-	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return fmt.Errorf("user %s already exists", email)
+	// The limits are checked and the user inserted in one transaction
+	return db.Transaction(func(tx *DB) error {
+		d, err := tx.GetDomain(domain)
+		if errors.Is(err, ErrNotFound) {
+			return errorf(ErrNotFound, "domain %s does not exist - add it first with 'mailstack domain add %s'", domain, domain)
+		}
+		if err != nil {
+			return err
+		}
+		if d.MaxUsers > 0 && d.UserCount >= d.MaxUsers {
+			return errorf(ErrLimit, "domain %s has reached its limit of %d users", domain, d.MaxUsers)
+		}
+		if err := d.checkQuota(quota); err != nil {
+			return err
 		}
-		return fmt.Errorf("failed to create user: %w", err)
-	}
 
-	return nil
+		// Insert user
+		_, err = tx.exec(`
+			INSERT INTO users (email, password_hash, quota_bytes, enabled, global_admin)
+			VALUES (?, ?, ?, ?, ?)
+		`, email, hash, quota, true, false)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return errorf(ErrExists, "user %s already exists", email)
+			}
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return nil
+	})
 }
 
-// DeleteUser removes a mail user
-func (db *DB) DeleteUser(email string, removeMailbox bool) error {
-	// Check if user exists
-	var exists bool
-	err := db.conn.QueryRow("SELECT COUNT(*) > 0 FROM users WHERE email = ?", email).Scan(&exists)
+// DeleteUser removes a mail user. cleanup, if not nil, runs once the
+// deletion is committed (e.g. to remove the mailbox), so files are never
+// lost for a user that is kept.
+func (db *DB) DeleteUser(email string, cleanup func() error) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
+	tx, err := db.begin()
 	if err != nil {
-		return fmt.Errorf("failed to check user: %w", err)
+		return err
 	}
-	if !exists {
-		return fmt.Errorf("user %s does not exist", email)
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(db.dialect.rebind(
+		"DELETE FROM domain_admins WHERE user_id IN (SELECT id FROM users WHERE email = ?)"), email); err != nil {
+		return fmt.Errorf("failed to delete domain admin rights: %w", err)
+	}
+	if _, err := tx.Exec(db.dialect.rebind(
+		"DELETE FROM tokens WHERE user_id IN (SELECT id FROM users WHERE email = ?)"), email); err != nil {
+		return fmt.Errorf("failed to delete tokens: %w", err)
 	}
 
-	// Delete user from database
-	_, err = db.conn.Exec("DELETE FROM users WHERE email = ?", email)
+	result, err := tx.Exec(db.dialect.rebind("DELETE FROM users WHERE email = ?"), email)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
-
-	// TODO: If removeMailbox is true, delete /var/mail/<domain>/<user>
-	if removeMailbox {
-		// This would require os.RemoveAll() but we need to be careful
-		// For now, just note that mailbox removal should be done manually
-		fmt.Printf("Note: Mailbox data not removed. Manually delete if needed.\n")
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "user %s does not exist", email)
 	}
 
-	return nil
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if cleanup == nil {
+		return nil
+	}
+	return db.onCommit(func() error {
+		if err := cleanup(); err != nil {
+			return fmt.Errorf("user %s was deleted, but %w", email, err)
+		}
+		return nil
+	})
 }
 
 // ListUsers returns all mail users
 func (db *DB) ListUsers() ([]User, error) {
-	rows, err := db.conn.Query(`
-		SELECT email, quota_bytes, enabled 
-		FROM users 
-		ORDER BY email
-	`)
+	rows, err := db.query("SELECT " + userColumns + " FROM users ORDER BY email")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
@@ -158,11 +335,13 @@ func (db *DB) ListUsers() ([]User, error) {
 
 	var users []User
 	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.Email, &user.Quota, &user.Enabled); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
-		users = append(users, user)
+		if db.principal.CanManage(domainOf(user.Email)) {
+			users = append(users, user)
+		}
 	}
 
 	if err := rows.Err(); err != nil {
@@ -172,16 +351,131 @@ func (db *DB) ListUsers() ([]User, error) {
 	return users, nil
 }
 
+// GetUser returns a single mail user
+func (db *DB) GetUser(email string) (*User, error) {
+	if err := db.authorizeAddress(email); err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(db.queryRow("SELECT "+userColumns+" FROM users WHERE email = ?", email))
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "user %s does not exist", email)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// UpdateUser changes the attributes set in update
+func (db *DB) UpdateUser(email string, update UserUpdate) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
+	var sets []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+
+	if update.DisplayName != nil {
+		set("display_name", *update.DisplayName)
+	}
+	if update.Quota != nil {
+		if *update.Quota < 0 {
+			return errorf(ErrInvalid, "quota cannot be negative")
+		}
+		set("quota_bytes", *update.Quota)
+	}
+	if update.Enabled != nil {
+		set("enabled", *update.Enabled)
+	}
+	if update.EnableIMAP != nil {
+		set("enable_imap", *update.EnableIMAP)
+	}
+	if update.EnablePOP != nil {
+		set("enable_pop", *update.EnablePOP)
+	}
+	if update.GlobalAdmin != nil {
+		if err := db.requireGlobalAdmin("grant global admin rights"); err != nil {
+			return err
+		}
+		set("global_admin", *update.GlobalAdmin)
+	}
+	if update.ForcePasswordChange != nil {
+		set("force_password_change", *update.ForcePasswordChange)
+	}
+	if len(sets) == 0 {
+		return errorf(ErrInvalid, "nothing to update")
+	}
+
+	args = append(args, email)
+
+	// The quota is checked against the domain and set in one transaction
+	return db.Transaction(func(tx *DB) error {
+		if update.Quota != nil {
+			d, err := tx.GetDomain(domainOf(email))
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			if d != nil {
+				if err := d.checkQuota(*update.Quota); err != nil {
+					return err
+				}
+			}
+		}
+
+		result, err := tx.exec(
+			"UPDATE users SET "+strings.Join(sets, ", ")+", updated_at = CURRENT_TIMESTAMP WHERE email = ?",
+			args...)
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if affected == 0 {
+			return errorf(ErrNotFound, "user %s does not exist", email)
+		}
+		return nil
+	})
+}
+
+// SetQuotaUsed records the mailbox size last reported by dovecot
+func (db *DB) SetQuotaUsed(email string, used int64) error {
+	if err := db.authorizeAddress(email); err != nil {
+		return err
+	}
+
+	_, err := db.exec("UPDATE users SET quota_bytes_used = ? WHERE email = ?", used, email)
+	if err != nil {
+		return fmt.Errorf("failed to update quota usage: %w", err)
+	}
+	return nil
+}
+
 // ChangePassword changes a user's password
 func (db *DB) ChangePassword(email, password string) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
 	// Check if user exists
 	var exists bool
-	err := db.conn.QueryRow("SELECT COUNT(*) > 0 FROM users WHERE email = ?", email).Scan(&exists)
+	err := db.queryRow("SELECT COUNT(*) > 0 FROM users WHERE email = ?", email).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("failed to check user: %w", err)
 	}
 	if !exists {
-		return fmt.Errorf("user %s does not exist", email)
+		return errorf(ErrNotFound, "user %s does not exist", email)
+	}
+
+	if err := CheckPassword(db.policy, email, password); err != nil {
+		return err
 	}
 
 	// Hash new password
@@ -190,36 +484,84 @@ func (db *DB) ChangePassword(email, password string) error {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Update password
-	_, err = db.conn.Exec(`
+	// Update password; a new password clears force_password_change
+	_, err = db.exec(`
 		UPDATE users 
-		SET password_hash = ?, updated_at = CURRENT_TIMESTAMP 
+		SET password_hash = ?, force_password_change = ?, updated_at = CURRENT_TIMESTAMP 
 		WHERE email = ?
-	`, string(hashedPassword), email)
+	`, string(hashedPassword), false, email)
+
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	return nil
+}
+
+// SetPasswordHash stores an existing BLF-CRYPT or SHA512-CRYPT hash as a
+// user's password, e.g. when migrating from another server
+func (db *DB) SetPasswordHash(email, hash string) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
+	hash, err := NormalizeHash(hash)
+	if err != nil {
+		return err
+	}
 
+	result, err := db.exec(`
+		UPDATE users
+		SET password_hash = ?, force_password_change = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE email = ?
+	`, hash, false, email)
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return errorf(ErrNotFound, "user %s does not exist", email)
+	}
 
 	return nil
 }
 
 // AddDomain adds a new mail domain
 func (db *DB) AddDomain(domain string) error {
+	if err := db.requireGlobalAdmin("add domains"); err != nil {
+		return err
+	}
+
 	// Validate domain format (basic check)
 	if !strings.Contains(domain, ".") {
-		return fmt.Errorf("invalid domain format: %s", domain)
+		return errorf(ErrInvalid, "invalid domain format: %s", domain)
+	}
+
+	var isAlternative bool
+	err := db.queryRow("SELECT COUNT(*) > 0 FROM alternatives WHERE name = ?", domain).Scan(&isAlternative)
+	if err != nil {
+		return fmt.Errorf("failed to check alternative domains: %w", err)
+	}
+	if isAlternative {
+		return errorf(ErrConflict, "%s is already an alternative domain", domain)
+	}
+	var isRelay bool
+	err = db.queryRow("SELECT COUNT(*) > 0 FROM relays WHERE name = ?", domain).Scan(&isRelay)
+	if err != nil {
+		return fmt.Errorf("failed to check relay domains: %w", err)
+	}
+	if isRelay {
+		return errorf(ErrConflict, "%s is a relay domain", domain)
 	}
 
 	// Insert domain
-	_, err := db.conn.Exec(`
+	_, err = db.exec(`
 		INSERT INTO domains (name, enabled)
-		VALUES (?, 1)
-	`, domain)
+		VALUES (?, ?)
+	`, domain, true)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
-			return fmt.Errorf("domain %s already exists", domain)
+		if isUniqueViolation(err) {
+			return errorf(ErrExists, "domain %s already exists", domain)
 		}
 		return fmt.Errorf("failed to create domain: %w", err)
 	}
@@ -229,44 +571,201 @@ func (db *DB) AddDomain(domain string) error {
 
 // DeleteDomain removes a mail domain
 func (db *DB) DeleteDomain(domain string) error {
+	if err := db.requireGlobalAdmin("delete domains"); err != nil {
+		return err
+	}
+
 	// Check if domain exists
 	var exists bool
-	err := db.conn.QueryRow("SELECT COUNT(*) > 0 FROM domains WHERE name = ?", domain).Scan(&exists)
+	err := db.queryRow("SELECT COUNT(*) > 0 FROM domains WHERE name = ?", domain).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("failed to check domain: %w", err)
 	}
 	if !exists {
-		return fmt.Errorf("domain %s does not exist", domain)
+		return errorf(ErrNotFound, "domain %s does not exist", domain)
+	}
+
+	// Refuse while anything still refers to the domain; foreign keys are
+	// not enforced on every backend, so nothing else would stop orphans
+	var users, aliases, admins int
+	err = db.queryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM users WHERE email LIKE ?),
+			(SELECT COUNT(*) FROM aliases WHERE email LIKE ?),
+			(SELECT COUNT(*) FROM domain_admins WHERE domain_id IN (SELECT id FROM domains WHERE name = ?))
+	`, "%@"+domain, "%@"+domain, domain).Scan(&users, &aliases, &admins)
+	if err != nil {
+		return fmt.Errorf("failed to check domain contents: %w", err)
+	}
+	if users+aliases+admins > 0 {
+		return errorf(ErrConflict, "cannot delete domain %s: it has %d users, %d aliases and %d domain admins (remove them first or use --cascade)",
+			domain, users, aliases, admins)
 	}
 
-	// Check if domain has users
-	var userCount int
-	err = db.conn.QueryRow(`
-		SELECT COUNT(*) FROM users WHERE email LIKE ?
-	`, "%@"+domain).Scan(&userCount)
+	// Delete domain along with its alternative domains
+	return db.Transaction(func(tx *DB) error {
+		if _, err := tx.exec(`DELETE FROM alternatives
+			WHERE domain_id IN (SELECT id FROM domains WHERE name = ?)`, domain); err != nil {
+			return fmt.Errorf("failed to delete alternative domains: %w", err)
+		}
+		if _, err := tx.exec("DELETE FROM domains WHERE name = ?", domain); err != nil {
+			return fmt.Errorf("failed to delete domain: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteDomainCascade removes a domain together with its users, aliases
+// and domain admin rights in one transaction. cleanup, if not nil, runs
+// once the transaction is committed.
+func (db *DB) DeleteDomainCascade(domain string, cleanup func() error) error {
+	if err := db.requireGlobalAdmin("delete domains"); err != nil {
+		return err
+	}
+
+	tx, err := db.begin()
 	if err != nil {
-		return fmt.Errorf("failed to check users: %w", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	pattern := "%@" + domain
+	steps := []struct {
+		what  string
+		query string
+		args  []interface{}
+	}{
+		{"domain admin rights", `DELETE FROM domain_admins
+			WHERE domain_id IN (SELECT id FROM domains WHERE name = ?)
+			OR user_id IN (SELECT id FROM users WHERE email LIKE ?)`, []interface{}{domain, pattern}},
+		{"tokens", `DELETE FROM tokens
+			WHERE user_id IN (SELECT id FROM users WHERE email LIKE ?)`, []interface{}{pattern}},
+		{"alternative domains", `DELETE FROM alternatives
+			WHERE domain_id IN (SELECT id FROM domains WHERE name = ?)`, []interface{}{domain}},
+		{"aliases", "DELETE FROM aliases WHERE email LIKE ?", []interface{}{pattern}},
+		{"users", "DELETE FROM users WHERE email LIKE ?", []interface{}{pattern}},
 	}
-	if userCount > 0 {
-		return fmt.Errorf("cannot delete domain %s: it has %d users (delete users first)", domain, userCount)
+	for _, step := range steps {
+		if _, err := tx.Exec(db.dialect.rebind(step.query), step.args...); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", step.what, err)
+		}
 	}
 
-	// Delete domain
-	_, err = db.conn.Exec("DELETE FROM domains WHERE name = ?", domain)
+	result, err := tx.Exec(db.dialect.rebind("DELETE FROM domains WHERE name = ?"), domain)
 	if err != nil {
 		return fmt.Errorf("failed to delete domain: %w", err)
 	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "domain %s does not exist", domain)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if cleanup == nil {
+		return nil
+	}
+	return db.onCommit(func() error {
+		if err := cleanup(); err != nil {
+			return fmt.Errorf("domain %s was deleted, but %w", domain, err)
+		}
+		return nil
+	})
+}
+
+// GetDomain returns a single mail domain with its usage
+func (db *DB) GetDomain(domain string) (*Domain, error) {
+	if err := db.authorize(domain); err != nil {
+		return nil, err
+	}
+
+	var d Domain
+	err := db.queryRow(`
+		SELECT name,
+			(SELECT COUNT(*) FROM users WHERE email LIKE ?),
+			(SELECT COUNT(*) FROM aliases WHERE email LIKE ?),
+			`+domainLimitColumns+`
+		FROM domains
+		WHERE name = ?
+	`, "%@"+domain, "%@"+domain, domain).Scan(&d.Name, &d.UserCount, &d.AliasCount,
+		&d.MaxUsers, &d.MaxAliases, &d.MaxQuota, &d.Enabled)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "domain %s does not exist", domain)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain: %w", err)
+	}
+	return &d, nil
+}
+
+// DomainUpdate lists the domain settings to change; nil fields are left as is
+type DomainUpdate struct {
+	MaxUsers   *int
+	MaxAliases *int
+	MaxQuota   *int64
+	Enabled    *bool
+}
+
+// UpdateDomain changes the settings set in update
+func (db *DB) UpdateDomain(domain string, update DomainUpdate) error {
+	if err := db.requireGlobalAdmin("change domain limits"); err != nil {
+		return err
+	}
+
+	var sets []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+
+	if update.MaxUsers != nil {
+		set("max_users", *update.MaxUsers)
+	}
+	if update.MaxAliases != nil {
+		set("max_aliases", *update.MaxAliases)
+	}
+	if update.MaxQuota != nil {
+		set("max_quota_bytes", *update.MaxQuota)
+	}
+	if update.Enabled != nil {
+		set("enabled", *update.Enabled)
+	}
+	if len(sets) == 0 {
+		return errorf(ErrInvalid, "nothing to update")
+	}
+	if err := db.checkNewLimits(domain, update); err != nil {
+		return err
+	}
+
+	args = append(args, domain)
+	result, err := db.exec("UPDATE domains SET "+strings.Join(sets, ", ")+" WHERE name = ?", args...)
+	if err != nil {
+		return fmt.Errorf("failed to update domain: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update domain: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "domain %s does not exist", domain)
+	}
 
 	return nil
 }
 
 // ListDomains returns all mail domains
 func (db *DB) ListDomains() ([]Domain, error) {
-	rows, err := db.conn.Query(`
-		SELECT d.name, COUNT(u.id) as user_count
+	rows, err := db.query(`
+		SELECT d.name,
+			(SELECT COUNT(*) FROM users u WHERE u.email LIKE ` + db.dialect.concat("'%@'", "d.name") + `),
+			(SELECT COUNT(*) FROM aliases a WHERE a.email LIKE ` + db.dialect.concat("'%@'", "d.name") + `),
+			` + domainLimitColumns + `
 		FROM domains d
-		LEFT JOIN users u ON u.email LIKE '%@' || d.name
-		GROUP BY d.name
 		ORDER BY d.name
 	`)
 	if err != nil {
@@ -277,10 +776,13 @@ func (db *DB) ListDomains() ([]Domain, error) {
 	var domains []Domain
 	for rows.Next() {
 		var domain Domain
-		if err := rows.Scan(&domain.Name, &domain.UserCount); err != nil {
+		if err := rows.Scan(&domain.Name, &domain.UserCount, &domain.AliasCount,
+			&domain.MaxUsers, &domain.MaxAliases, &domain.MaxQuota, &domain.Enabled); err != nil {
 			return nil, fmt.Errorf("failed to scan domain: %w", err)
 		}
-		domains = append(domains, domain)
+		if db.principal.CanManage(domain.Name) {
+			domains = append(domains, domain)
+		}
 	}
 
 	if err := rows.Err(); err != nil {
@@ -290,154 +792,281 @@ func (db *DB) ListDomains() ([]Domain, error) {
 	return domains, nil
 }
 
-// InitSchema initializes the database schema
-func (db *DB) InitSchema() error {
-	schema := `
--- Users table
-CREATE TABLE IF NOT EXISTS users (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    email VARCHAR(255) UNIQUE NOT NULL,
-    password_hash VARCHAR(255) NOT NULL,
-    display_name VARCHAR(255),
-    quota_bytes BIGINT DEFAULT 0,
-    enabled BOOLEAN DEFAULT 1,
-    global_admin BOOLEAN DEFAULT 0,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
-
--- Domains table
-CREATE TABLE IF NOT EXISTS domains (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name VARCHAR(255) UNIQUE NOT NULL,
-    max_users INTEGER DEFAULT 0,
-    max_aliases INTEGER DEFAULT 0,
-    max_quota_bytes BIGINT DEFAULT 0,
-    enabled BOOLEAN DEFAULT 1,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
-
--- Aliases table
-CREATE TABLE IF NOT EXISTS aliases (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    email VARCHAR(255) UNIQUE NOT NULL,
-    destination TEXT NOT NULL,
-    wildcard BOOLEAN DEFAULT 0,
-    enabled BOOLEAN DEFAULT 1,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
-
--- Domain admins table
-CREATE TABLE IF NOT EXISTS domain_admins (
-    user_id INTEGER,
-    domain_id INTEGER,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    FOREIGN KEY (domain_id) REFERENCES domains(id) ON DELETE CASCADE,
-    PRIMARY KEY (user_id, domain_id)
-);
-
--- Create indexes
-CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-CREATE INDEX IF NOT EXISTS idx_domains_name ON domains(name);
-CREATE INDEX IF NOT EXISTS idx_aliases_email ON aliases(email);
-`
-
-	// Execute schema creation
-	_, err := db.conn.Exec(schema)
-	if err != nil {
-		return fmt.Errorf("failed to create schema: %w", err)
+// EnsureDomain adds a domain if it does not already exist
+func (db *DB) EnsureDomain(domain string) error {
+	if err := db.requireGlobalAdmin("add domains"); err != nil {
+		return err
 	}
 
+	_, err := db.exec(db.dialect.insertIgnore("INSERT INTO domains (name, enabled) VALUES (?, ?)"), domain, true)
+	if err != nil {
+		return fmt.Errorf("failed to create domain: %w", err)
+	}
 	return nil
 }
 
-// Alias represents an email alias
-type Alias struct {
-	Email       string
-	Destination string
-	Enabled     bool
+// Type returns the normalized backend name (sqlite, postgresql or mysql)
+func (db *DB) Type() string {
+	return db.dialect.name
 }
 
-// AddAlias creates a new email alias
-func (db *DB) AddAlias(email, destination string) error {
-	// Validate email format
-	parts := strings.Split(email, "@")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid email format: %s", email)
+// Transaction runs fn with a DB whose every method works inside one
+// transaction, committed if fn returns nil and rolled back otherwise. Work
+// queued with onCommit runs after the commit.
+func (db *DB) Transaction(fn func(tx *DB) error) error {
+	t, err := db.begin()
+	if err != nil {
+		return err
 	}
-	domain := parts[1]
+	defer t.Rollback()
 
-	// Check if domain exists
-	var domainExists bool
-	err := db.conn.QueryRow("SELECT COUNT(*) > 0 FROM domains WHERE name = ?", domain).Scan(&domainExists)
-	if err != nil {
-		return fmt.Errorf("failed to check domain: %w", err)
+	scoped := *db
+	scoped.tx = t.Tx
+	var hooks []func() error
+	if !t.nested {
+		scoped.hooks = &hooks
 	}
-	if !domainExists {
-		return fmt.Errorf("domain %s does not exist - add it first with 'mailstack domain add %s'", domain, domain)
+	if err := fn(&scoped); err != nil {
+		return err
 	}
 
-	// Check if alias already exists
-	var exists bool
-	err = db.conn.QueryRow("SELECT COUNT(*) > 0 FROM aliases WHERE email = ?", email).Scan(&exists)
-	if err != nil {
-		return fmt.Errorf("failed to check alias: %w", err)
+	if err := t.Commit(); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if err := hook(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onCommit runs fn once the changes made so far are committed: when the
+// enclosing Transaction commits, or right away outside of one
+func (db *DB) onCommit(fn func() error) error {
+	if db.hooks != nil {
+		*db.hooks = append(*db.hooks, fn)
+		return nil
 	}
-	if exists {
-		return fmt.Errorf("alias %s already exists", email)
+	return fn()
+}
+
+// txn is a transaction, or the enclosing one when already inside
+// Transaction, in which case committing is left to the outer caller
+type txn struct {
+	*sql.Tx
+	nested bool
+}
+
+func (t *txn) Commit() error {
+	if t.nested {
+		return nil
 	}
+	return t.Tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if t.nested {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
 
-	// Check if it conflicts with an actual user
-	var userExists bool
-	err = db.conn.QueryRow("SELECT COUNT(*) > 0 FROM users WHERE email = ?", email).Scan(&userExists)
+// begin starts a transaction unless one is already running
+func (db *DB) begin() (*txn, error) {
+	if db.tx != nil {
+		return &txn{Tx: db.tx, nested: true}, nil
+	}
+	tx, err := db.conn.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to check user: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &txn{Tx: tx}, nil
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// q returns the current transaction, if any, or the connection pool
+func (db *DB) q() querier {
+	if db.tx != nil {
+		return db.tx
+	}
+	return db.conn
+}
+
+// exec runs a statement after rebinding its placeholders
+func (db *DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.q().Exec(db.dialect.rebind(query), args...)
+}
+
+// query runs a query after rebinding its placeholders
+func (db *DB) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.q().Query(db.dialect.rebind(query), args...)
+}
+
+// queryRow runs a single-row query after rebinding its placeholders
+func (db *DB) queryRow(query string, args ...interface{}) *sql.Row {
+	return db.q().QueryRow(db.dialect.rebind(query), args...)
+}
+
+// Alias represents an email alias. Wildcard aliases have a "%" pattern
+// in the local part, such as "sales-%@example.com" or the catch-all
+// "%@example.com".
+type Alias struct {
+	Email       string `json:"email"`
+	Destination string `json:"destination"`
+	Wildcard    bool   `json:"wildcard"`
+	Enabled     bool   `json:"enabled"`
+	Comment     string `json:"comment"`
+}
+
+// AliasKey returns the stored form of an alias address: the catch-all
+// "@domain" is the pattern "%@domain"
+func AliasKey(email string) string {
+	if strings.HasPrefix(email, "@") {
+		return "%" + email
 	}
-	if userExists {
-		return fmt.Errorf("cannot create alias: %s is already a real user", email)
+	return email
+}
+
+// checkAliasKey validates an alias address or pattern and returns its
+// domain and whether it is a wildcard
+func checkAliasKey(key string) (string, bool, error) {
+	parts := strings.Split(key, "@")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false, errorf(ErrInvalid, "invalid email format: %s", key)
 	}
+	if strings.ContainsAny(parts[1], "%_") {
+		return "", false, errorf(ErrInvalid, "invalid alias %s: wildcards are only allowed before the @", key)
+	}
+	return parts[1], strings.Contains(parts[0], "%"), nil
+}
 
-	// Validate destination addresses
-	destinations := strings.Split(destination, ",")
-	for i, dest := range destinations {
-		destinations[i] = strings.TrimSpace(dest)
-		if destinations[i] == "" {
-			return fmt.Errorf("empty destination address")
+// NormalizeDestinations validates a comma-separated list of destination
+// addresses and returns it trimmed, without empty entries or duplicates
+func NormalizeDestinations(destination string) (string, error) {
+	var list []string
+	seen := make(map[string]bool)
+	for _, dest := range strings.Split(destination, ",") {
+		dest = strings.TrimSpace(dest)
+		if dest == "" {
+			continue
 		}
-		// Basic validation
-		if !strings.Contains(destinations[i], "@") {
-			return fmt.Errorf("invalid destination address: %s", destinations[i])
+		parts := strings.Split(dest, "@")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(dest, "% \t") {
+			return "", errorf(ErrInvalid, "invalid destination address: %s", dest)
 		}
+		if seen[strings.ToLower(dest)] {
+			continue
+		}
+		seen[strings.ToLower(dest)] = true
+		list = append(list, dest)
+	}
+	if len(list) == 0 {
+		return "", errorf(ErrInvalid, "empty destination address")
+	}
+	return strings.Join(list, ","), nil
+}
+
+// splitDestinations splits a normalized destination list
+func splitDestinations(destination string) []string {
+	if destination == "" {
+		return nil
 	}
+	return strings.Split(destination, ",")
+}
 
-	// Insert alias
-	_, err = db.conn.Exec(`
-		INSERT INTO aliases (email, destination, enabled)
-		VALUES (?, ?, 1)
-	`, email, destination)
+// AddAlias creates a new email alias. email may be a "%" pattern or a
+// catch-all "@domain".
+func (db *DB) AddAlias(email, destination, comment string) error {
+	email = AliasKey(email)
+	domain, wildcard, err := checkAliasKey(email)
+	if err != nil {
+		return err
+	}
+	if err := db.authorize(domain); err != nil {
+		return err
+	}
 
+	destination, err = NormalizeDestinations(destination)
 	if err != nil {
-		return fmt.Errorf("failed to create alias: %w", err)
+		return err
 	}
 
-	return nil
+	// The limit is checked and the alias inserted in one transaction; the
+	// loop check needs it in place to follow paths that come back to it
+	return db.Transaction(func(tx *DB) error {
+		// Check if domain exists and has room for another alias
+		d, err := tx.GetDomain(domain)
+		if errors.Is(err, ErrNotFound) {
+			return errorf(ErrNotFound, "domain %s does not exist - add it first with 'mailstack domain add %s'", domain, domain)
+		}
+		if err != nil {
+			return err
+		}
+		if d.MaxAliases > 0 && d.AliasCount >= d.MaxAliases {
+			return errorf(ErrLimit, "domain %s has reached its limit of %d aliases", domain, d.MaxAliases)
+		}
+
+		// Check if alias already exists
+		var exists bool
+		err = tx.queryRow("SELECT COUNT(*) > 0 FROM aliases WHERE email = ?", email).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check alias: %w", err)
+		}
+		if exists {
+			return errorf(ErrExists, "alias %s already exists", email)
+		}
+
+		// Check if it conflicts with an actual user
+		var userExists bool
+		err = tx.queryRow("SELECT COUNT(*) > 0 FROM users WHERE email = ?", email).Scan(&userExists)
+		if err != nil {
+			return fmt.Errorf("failed to check user: %w", err)
+		}
+		if userExists {
+			return errorf(ErrConflict, "cannot create alias: %s is already a real user", email)
+		}
+
+		_, err = tx.exec(`
+			INSERT INTO aliases (email, destination, wildcard, enabled, comment)
+			VALUES (?, ?, ?, ?, ?)
+		`, email, destination, wildcard, true, comment)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return errorf(ErrExists, "alias %s already exists", email)
+			}
+			return fmt.Errorf("failed to create alias: %w", err)
+		}
+
+		return tx.checkAliasLoop(email, destination)
+	})
 }
 
 // DeleteAlias removes an email alias
 func (db *DB) DeleteAlias(email string) error {
+	email = AliasKey(email)
+	if err := db.authorizeAddress(email); err != nil {
+		return err
+	}
+
 	// Check if alias exists
 	var exists bool
-	err := db.conn.QueryRow("SELECT COUNT(*) > 0 FROM aliases WHERE email = ?", email).Scan(&exists)
+	err := db.queryRow("SELECT COUNT(*) > 0 FROM aliases WHERE email = ?", email).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("failed to check alias: %w", err)
 	}
 	if !exists {
-		return fmt.Errorf("alias %s does not exist", email)
+		return errorf(ErrNotFound, "alias %s does not exist", email)
 	}
 
 	// Delete alias
-	_, err = db.conn.Exec("DELETE FROM aliases WHERE email = ?", email)
+	_, err = db.exec("DELETE FROM aliases WHERE email = ?", email)
 	if err != nil {
 		return fmt.Errorf("failed to delete alias: %w", err)
 	}
@@ -447,9 +1076,9 @@ func (db *DB) DeleteAlias(email string) error {
 
 // ListAliases returns all email aliases
 func (db *DB) ListAliases() ([]Alias, error) {
-	rows, err := db.conn.Query(`
-		SELECT email, destination, enabled 
-		FROM aliases 
+	rows, err := db.query(`
+		SELECT email, destination, wildcard, enabled, comment
+		FROM aliases
 		ORDER BY email
 	`)
 	if err != nil {
@@ -460,10 +1089,12 @@ func (db *DB) ListAliases() ([]Alias, error) {
 	var aliases []Alias
 	for rows.Next() {
 		var alias Alias
-		if err := rows.Scan(&alias.Email, &alias.Destination, &alias.Enabled); err != nil {
+		if err := rows.Scan(&alias.Email, &alias.Destination, &alias.Wildcard, &alias.Enabled, &alias.Comment); err != nil {
 			return nil, fmt.Errorf("failed to scan alias: %w", err)
 		}
-		aliases = append(aliases, alias)
+		if db.principal.CanManage(domainOf(alias.Email)) {
+			aliases = append(aliases, alias)
+		}
 	}
 
 	if err := rows.Err(); err != nil {
@@ -475,15 +1106,20 @@ func (db *DB) ListAliases() ([]Alias, error) {
 
 // GetAlias returns details for a specific alias
 func (db *DB) GetAlias(email string) (*Alias, error) {
+	email = AliasKey(email)
+	if err := db.authorizeAddress(email); err != nil {
+		return nil, err
+	}
+
 	var alias Alias
-	err := db.conn.QueryRow(`
-		SELECT email, destination, enabled 
-		FROM aliases 
+	err := db.queryRow(`
+		SELECT email, destination, wildcard, enabled, comment
+		FROM aliases
 		WHERE email = ?
-	`, email).Scan(&alias.Email, &alias.Destination, &alias.Enabled)
+	`, email).Scan(&alias.Email, &alias.Destination, &alias.Wildcard, &alias.Enabled, &alias.Comment)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("alias %s not found", email)
+		return nil, errorf(ErrNotFound, "alias %s not found", email)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get alias: %w", err)
@@ -492,25 +1128,98 @@ func (db *DB) GetAlias(email string) (*Alias, error) {
 	return &alias, nil
 }
 
-// Migrate runs database migrations
-func (db *DB) Migrate() error {
-	// Check current schema version
-	var version int
-	err := db.conn.QueryRow("PRAGMA user_version").Scan(&version)
-	if err != nil {
-		return fmt.Errorf("failed to get schema version: %w", err)
+// AliasUpdate lists the alias settings to change; nil fields are left as
+// is. AddDestinations and RemoveDestinations apply to Destination when it
+// is set, and to the current destinations otherwise.
+type AliasUpdate struct {
+	Destination        *string
+	AddDestinations    []string
+	RemoveDestinations []string
+	Enabled            *bool
+	Comment            *string
+}
+
+// UpdateAlias changes the settings set in update. Changing destinations
+// or enabling the alias fails if it would create a forwarding loop.
+func (db *DB) UpdateAlias(email string, update AliasUpdate) error {
+	email = AliasKey(email)
+	if err := db.authorizeAddress(email); err != nil {
+		return err
 	}
 
-	// Currently at version 0 (initial schema)
-	// Future migrations would go here
-	if version < 1 {
-		// Migration example (none needed yet):
-		// _, err := db.conn.Exec("ALTER TABLE users ADD COLUMN new_field TEXT")
-		// if err != nil {
-		//     return err
-		// }
-		// _, err = db.conn.Exec("PRAGMA user_version = 1")
+	return db.Transaction(func(tx *DB) error {
+		alias, err := tx.GetAlias(email)
+		if err != nil {
+			return err
+		}
+
+		var sets []string
+		var args []interface{}
+
+		destination := alias.Destination
+		if update.Destination != nil {
+			destination = *update.Destination
+		}
+		if update.Destination != nil || len(update.AddDestinations) > 0 || len(update.RemoveDestinations) > 0 {
+			destination, err = editDestinations(destination, update.AddDestinations, update.RemoveDestinations)
+			if err != nil {
+				return fmt.Errorf("alias %s: %w", email, err)
+			}
+			if destination != alias.Destination {
+				sets = append(sets, "destination = ?")
+				args = append(args, destination)
+			}
+		}
+		if update.Enabled != nil {
+			sets = append(sets, "enabled = ?")
+			args = append(args, *update.Enabled)
+		}
+		if update.Comment != nil {
+			sets = append(sets, "comment = ?")
+			args = append(args, *update.Comment)
+		}
+		if len(sets) == 0 {
+			return errorf(ErrInvalid, "nothing to update")
+		}
+
+		args = append(args, email)
+		if _, err := tx.exec("UPDATE aliases SET "+strings.Join(sets, ", ")+" WHERE email = ?", args...); err != nil {
+			return fmt.Errorf("failed to update alias: %w", err)
+		}
+
+		// A disabled alias is skipped by postfix and cannot loop
+		enabled := alias.Enabled
+		if update.Enabled != nil {
+			enabled = *update.Enabled
+		}
+		if !enabled {
+			return nil
+		}
+		return tx.checkAliasLoop(email, destination)
+	})
+}
+
+// editDestinations adds and removes addresses from a destination list
+func editDestinations(destination string, add, remove []string) (string, error) {
+	list := splitDestinations(destination)
+	for _, dest := range remove {
+		dest = strings.TrimSpace(dest)
+		found := false
+		for i := 0; i < len(list); i++ {
+			if strings.EqualFold(strings.TrimSpace(list[i]), dest) {
+				list = append(list[:i], list[i+1:]...)
+				found = true
+				i--
+			}
+		}
+		if !found {
+			return "", errorf(ErrNotFound, "%s is not a destination", dest)
+		}
 	}
+	list = append(list, add...)
 
-	return nil
+	if len(list) == 0 {
+		return "", errorf(ErrInvalid, "cannot remove every destination, delete the alias instead")
+	}
+	return NormalizeDestinations(strings.Join(list, ","))
 }
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/config"
+)
+
+// testPassword satisfies the default password policy
+const testPassword = "Tr0ub4dor&3x"
+
+// newTestDB returns a migrated SQLite database in a temporary directory,
+// like databasetest.NewDB, which tests inside this package cannot import
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := Connect(config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "mailstack.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+// mustRun fails the test on the first setup step that returns an error
+func mustRun(t *testing.T, steps ...error) {
+	t.Helper()
+	for _, err := range steps {
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+
+	applied, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if applied != 0 {
+		t.Errorf("second Migrate applied %d migrations, want 0", applied)
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if len(status) != len(migrations) {
+		t.Fatalf("MigrationStatus returned %d migrations, want %d", len(status), len(migrations))
+	}
+	for _, m := range status {
+		if !m.Applied {
+			t.Errorf("migration %d (%s) is not applied", m.Version, m.Name)
+		}
+	}
+
+	reverted, err := db.Rollback(1)
+	if err != nil || reverted != 1 {
+		t.Fatalf("Rollback(1) = %d, %v; want 1, nil", reverted, err)
+	}
+	applied, err = db.Migrate()
+	if err != nil || applied != 1 {
+		t.Fatalf("Migrate after rollback = %d, %v; want 1, nil", applied, err)
+	}
+}
+
+func TestDeleteDomain(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(db *DB) []error
+		want  error
+	}{
+		{
+			name:  "empty domain",
+			setup: func(db *DB) []error { return nil },
+		},
+		{
+			name: "with a user",
+			setup: func(db *DB) []error {
+				return []error{db.AddUser("alice@example.com", testPassword, 0)}
+			},
+			want: ErrConflict,
+		},
+		{
+			name: "with an alias",
+			setup: func(db *DB) []error {
+				return []error{db.AddAlias("info@example.com", "someone@example.net", "")}
+			},
+			want: ErrConflict,
+		},
+		{
+			name: "with a domain admin from another domain",
+			setup: func(db *DB) []error {
+				return []error{
+					db.AddDomain("example.net"),
+					db.AddUser("bob@example.net", testPassword, 0),
+					db.AddDomainAdmin("bob@example.net", "example.com"),
+				}
+			},
+			want: ErrConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			mustRun(t, db.AddDomain("example.com"))
+			mustRun(t, tt.setup(db)...)
+
+			err := db.DeleteDomain("example.com")
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("DeleteDomain: %v", err)
+				}
+				if _, err := db.GetDomain("example.com"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("GetDomain after delete = %v, want ErrNotFound", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("DeleteDomain = %v, want %v", err, tt.want)
+			}
+			if _, err := db.GetDomain("example.com"); err != nil {
+				t.Errorf("domain is gone after a refused delete: %v", err)
+			}
+		})
+	}
+
+	t.Run("missing domain", func(t *testing.T) {
+		db := newTestDB(t)
+		if err := db.DeleteDomain("example.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("DeleteDomain = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestDeleteUserCleanup(t *testing.T) {
+	errRollback := errors.New("rollback")
+	errCleanup := errors.New("disk full")
+
+	tests := []struct {
+		name        string
+		email       string
+		inTx        bool // delete inside a transaction that is rolled back
+		cleanupErr  error
+		wantErr     error
+		wantCleanup bool
+		wantGone    bool
+	}{
+		{name: "deleted", email: "alice@example.com", wantCleanup: true, wantGone: true},
+		{name: "missing user", email: "nobody@example.com", wantErr: ErrNotFound},
+		{name: "rolled back", email: "alice@example.com", inTx: true, wantErr: errRollback},
+		{name: "cleanup fails", email: "alice@example.com", cleanupErr: errCleanup, wantErr: errCleanup, wantCleanup: true, wantGone: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			mustRun(t, db.AddDomain("example.com"), db.AddUser("alice@example.com", testPassword, 0))
+
+			cleaned := false
+			cleanup := func() error {
+				// Files go only once the user is gone for good
+				if _, err := db.GetUser(tt.email); !errors.Is(err, ErrNotFound) {
+					t.Errorf("cleanup ran while the user still exists: %v", err)
+				}
+				cleaned = true
+				return tt.cleanupErr
+			}
+
+			var err error
+			if tt.inTx {
+				err = db.Transaction(func(tx *DB) error {
+					if err := tx.DeleteUser(tt.email, cleanup); err != nil {
+						return err
+					}
+					return errRollback
+				})
+			} else {
+				err = db.DeleteUser(tt.email, cleanup)
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteUser = %v, want %v", err, tt.wantErr)
+			}
+			if cleaned != tt.wantCleanup {
+				t.Errorf("cleanup ran = %t, want %t", cleaned, tt.wantCleanup)
+			}
+			_, err = db.GetUser("alice@example.com")
+			if gone := errors.Is(err, ErrNotFound); gone != tt.wantGone {
+				t.Errorf("user gone = %t, want %t", gone, tt.wantGone)
+			}
+		})
+	}
+}
+
+func TestDeleteDomainCascade(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddDomain("example.net"),
+		db.AddUser("alice@example.com", testPassword, 0),
+		db.AddUser("bob@example.net", testPassword, 0),
+		db.AddAlias("info@example.com", "alice@example.com", ""),
+		db.AddDomainAdmin("bob@example.net", "example.com"),
+	)
+
+	cleaned := false
+	err := db.DeleteDomainCascade("example.com", func() error {
+		if _, err := db.GetDomain("example.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("cleanup ran while the domain still exists: %v", err)
+		}
+		cleaned = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DeleteDomainCascade: %v", err)
+	}
+	if !cleaned {
+		t.Error("cleanup did not run")
+	}
+
+	if _, err := db.GetUser("alice@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("user of the deleted domain: %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetAlias("info@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("alias of the deleted domain: %v, want ErrNotFound", err)
+	}
+	if _, err := db.GetUser("bob@example.net"); err != nil {
+		t.Errorf("user of another domain: %v", err)
+	}
+}
+
+func TestSetQuotaUsed(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t, db.AddDomain("example.com"), db.AddUser("alice@example.com", testPassword, 0))
+
+	tests := []struct {
+		name  string
+		email string
+		used  int64
+	}{
+		{name: "recorded", email: "alice@example.com", used: 5 << 20},
+		{name: "updated", email: "alice@example.com", used: 7 << 20},
+		{name: "emptied", email: "alice@example.com", used: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mustRun(t, db.SetQuotaUsed(tt.email, tt.used))
+			user, err := db.GetUser(tt.email)
+			mustRun(t, err)
+			if user.QuotaUsed != tt.used {
+				t.Errorf("QuotaUsed = %d, want %d", user.QuotaUsed, tt.used)
+			}
+		})
+	}
+}
+
+func TestDomainLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func(db *DB) error
+		wantErr error
+	}{
+		{name: "alias within the limit", op: func(db *DB) error { return db.AddAlias("sales@example.com", "alice@example.com", "") }},
+		{name: "alias over the limit", op: func(db *DB) error {
+			mustRun(t, db.AddAlias("sales@example.com", "alice@example.com", ""))
+			return db.AddAlias("info@example.com", "alice@example.com", "")
+		}, wantErr: ErrLimit},
+		{name: "aliases over the limit in one transaction", op: func(db *DB) error {
+			return db.Transaction(func(tx *DB) error {
+				mustRun(t, tx.AddAlias("sales@example.com", "alice@example.com", ""))
+				return tx.AddAlias("info@example.com", "alice@example.com", "")
+			})
+		}, wantErr: ErrLimit},
+		{name: "user over the limit", op: func(db *DB) error { return db.AddUser("bob@example.com", testPassword, 1<<20) }, wantErr: ErrLimit},
+		{name: "quota within the limit", op: func(db *DB) error {
+			return db.UpdateUser("alice@example.com", UserUpdate{Quota: Ptr(int64(1 << 30))})
+		}},
+		{name: "quota over the limit", op: func(db *DB) error {
+			return db.UpdateUser("alice@example.com", UserUpdate{Quota: Ptr(int64(2 << 30))})
+		}, wantErr: ErrLimit},
+		{name: "unlimited quota over the limit", op: func(db *DB) error {
+			return db.UpdateUser("alice@example.com", UserUpdate{Quota: Ptr(int64(0))})
+		}, wantErr: ErrLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			mustRun(t,
+				db.AddDomain("example.com"),
+				db.AddUser("alice@example.com", testPassword, 1<<20),
+				db.UpdateDomain("example.com", DomainUpdate{MaxUsers: Ptr(1), MaxAliases: Ptr(1), MaxQuota: Ptr(int64(1 << 30))}),
+			)
+
+			if err := tt.op(db); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			// A refused change leaves nothing behind
+			if tt.wantErr != nil {
+				d, err := db.GetDomain("example.com")
+				mustRun(t, err)
+				if d.UserCount > 1 || d.AliasCount > 1 {
+					t.Errorf("domain has %d users and %d aliases after a refused change", d.UserCount, d.AliasCount)
+				}
+			}
+		})
+	}
+}
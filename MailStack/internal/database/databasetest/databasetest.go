@@ -0,0 +1,60 @@
+// Package databasetest provides fixtures for tests that work with the
+// account database
+package databasetest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// Password satisfies the default password policy
+const Password = "Tr0ub4dor&3x"
+
+// NewDB returns a migrated SQLite database in a temporary directory,
+// holding ds unless it is nil
+func NewDB(t testing.TB, ds *database.Dataset) *database.DB {
+	t.Helper()
+
+	db, err := database.Connect(config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "mailstack.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if ds != nil {
+		if _, err := db.Import(ds); err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+	}
+	return db
+}
+
+// Dataset covers every kind of record, shaped like an export: every
+// optional field is set, most to something other than the default
+func Dataset() *database.Dataset {
+	return &database.Dataset{
+		Domains: []database.DomainRecord{
+			{Name: "example.com", MaxUsers: 10, MaxAliases: 20, MaxQuota: 1 << 30, Enabled: database.Ptr(true)},
+			{Name: "example.net", Enabled: database.Ptr(false)},
+		},
+		Users: []database.UserRecord{
+			{Email: "alice@example.com", DisplayName: database.Ptr("Alice, \"the admin\""), Password: Password,
+				Quota: database.Ptr(int64(1 << 20)), Enabled: database.Ptr(true), EnableIMAP: database.Ptr(true), EnablePOP: database.Ptr(false), GlobalAdmin: true},
+			{Email: "bob@example.net", Password: Password,
+				Quota: database.Ptr(int64(0)), Enabled: database.Ptr(false), EnableIMAP: database.Ptr(false), EnablePOP: database.Ptr(true), ForcePasswordChange: true},
+		},
+		Aliases: []database.AliasRecord{
+			{Email: "info@example.com", Destination: "alice@example.com,bob@example.net", Enabled: database.Ptr(true), Comment: database.Ptr("front desk")},
+			{Email: "@example.net", Destination: "bob@example.net", Enabled: database.Ptr(false)},
+		},
+		DomainAdmins: []database.DomainAdminRecord{
+			{User: "bob@example.net", Domain: "example.com"},
+		},
+	}
+}
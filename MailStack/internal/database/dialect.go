@@ -0,0 +1,153 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// dialect describes the SQL differences between supported backends
+type dialect struct {
+	name   string // sqlite, postgresql, mysql
+	driver string // database/sql driver name
+
+	// DDL fragments used when building the schema
+	primaryKey string
+	boolTrue   string
+	boolFalse  string
+	timestamp  string
+
+	// MySQL has no CREATE INDEX IF NOT EXISTS
+	indexIfNotExists bool
+}
+
+var (
+	sqliteDialect = dialect{
+		name:             "sqlite",
+		driver:           "sqlite3",
+		primaryKey:       "INTEGER PRIMARY KEY AUTOINCREMENT",
+		boolTrue:         "1",
+		boolFalse:        "0",
+		timestamp:        "DATETIME",
+		indexIfNotExists: true,
+	}
+
+	postgresDialect = dialect{
+		name:             "postgresql",
+		driver:           "postgres",
+		primaryKey:       "SERIAL PRIMARY KEY",
+		boolTrue:         "TRUE",
+		boolFalse:        "FALSE",
+		timestamp:        "TIMESTAMP",
+		indexIfNotExists: true,
+	}
+
+	mysqlDialect = dialect{
+		name:       "mysql",
+		driver:     "mysql",
+		primaryKey: "INTEGER PRIMARY KEY AUTO_INCREMENT",
+		boolTrue:   "TRUE",
+		boolFalse:  "FALSE",
+		timestamp:  "DATETIME",
+	}
+)
+
+// dialectFor returns the dialect for a configured database type
+func dialectFor(dbType string) (dialect, error) {
+	switch dbType {
+	case "", "sqlite", "sqlite3":
+		return sqliteDialect, nil
+	case "postgresql", "postgres":
+		return postgresDialect, nil
+	case "mysql", "mariadb":
+		return mysqlDialect, nil
+	default:
+		return dialect{}, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+}
+
+// rebind converts '?' placeholders to the dialect's bind syntax. A '?'
+// inside a quoted string or identifier is left alone; a doubled quote
+// closes and reopens the quote, so it needs no special case.
+func (d dialect) rebind(query string) string {
+	if d.name != "postgresql" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// insertIgnore turns an INSERT statement into one that silently skips
+// rows that would violate a unique constraint
+func (d dialect) insertIgnore(query string) string {
+	switch d.name {
+	case "mysql":
+		return strings.Replace(query, "INSERT INTO", "INSERT IGNORE INTO", 1)
+	case "postgresql":
+		return query + " ON CONFLICT DO NOTHING"
+	default:
+		return strings.Replace(query, "INSERT INTO", "INSERT OR IGNORE INTO", 1)
+	}
+}
+
+// concat returns an expression concatenating the given SQL expressions
+func (d dialect) concat(parts ...string) string {
+	if d.name == "mysql" {
+		return "CONCAT(" + strings.Join(parts, ", ") + ")"
+	}
+	return strings.Join(parts, " || ")
+}
+
+// ddl expands the dialect placeholders in a schema statement
+func (d dialect) ddl(stmt string) string {
+	return strings.NewReplacer(
+		"{{pk}}", d.primaryKey,
+		"{{true}}", d.boolTrue,
+		"{{false}}", d.boolFalse,
+		"{{timestamp}}", d.timestamp,
+	).Replace(stmt)
+}
+
+// isUniqueViolation reports whether err is a unique/primary key violation
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+
+	return false
+}
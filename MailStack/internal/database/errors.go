@@ -0,0 +1,31 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds, for callers to test with errors.Is
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrExists      = errors.New("already exists")
+	ErrInvalid     = errors.New("invalid input")
+	ErrConflict    = errors.New("conflict")
+	ErrUnavailable = errors.New("database unavailable")
+	ErrLimit       = errors.New("limit exceeded")
+	ErrPermission  = errors.New("permission denied")
+)
+
+// kindError tags an error with one of the kinds above
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// errorf formats an error of the given kind; %w works as in fmt.Errorf
+func errorf(kind error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetForward forwards the mail delivered to a user to destination, a
+// comma-separated list of addresses. With keep, a copy also stays in the
+// user's mailbox.
+func (db *DB) SetForward(email, destination string, keep bool) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
+	destination, err := NormalizeDestinations(destination)
+	if err != nil {
+		return err
+	}
+	for _, dest := range splitDestinations(destination) {
+		if strings.EqualFold(dest, email) {
+			return errorf(ErrInvalid, "%s cannot forward to itself (keep a copy instead)", email)
+		}
+	}
+
+	return db.Transaction(func(tx *DB) error {
+		result, err := tx.exec(`
+			UPDATE users
+			SET forward_enabled = ?, forward_destination = ?, forward_keep = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE email = ?
+		`, true, destination, keep, email)
+		if err != nil {
+			return fmt.Errorf("failed to set forward: %w", err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			return errorf(ErrNotFound, "user %s does not exist", email)
+		}
+
+		// Checked after the update so that paths back to the user are seen
+		return tx.checkAliasLoop(email, destination)
+	})
+}
+
+// ClearForward stops forwarding a user's mail
+func (db *DB) ClearForward(email string) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
+	result, err := db.exec(`
+		UPDATE users
+		SET forward_enabled = ?, forward_destination = NULL, forward_keep = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE email = ?
+	`, false, true, email)
+	if err != nil {
+		return fmt.Errorf("failed to clear forward: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return errorf(ErrNotFound, "user %s does not exist", email)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetForward(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddUser("alice@example.com", testPassword, 0),
+	)
+
+	tests := []struct {
+		name        string
+		email       string
+		destination string
+		keep        bool
+		want        error
+		wantDest    string // the normalized forward
+		wantResolve string // what ResolveAlias delivers to
+	}{
+		{
+			name: "forward", email: "alice@example.com", destination: "alice@example.net",
+			wantDest: "alice@example.net", wantResolve: "alice@example.net",
+		},
+		{
+			name: "keep a copy", email: "alice@example.com", destination: " alice@example.net, ALICE@example.net,bob@example.org ", keep: true,
+			wantDest: "alice@example.net,bob@example.org", wantResolve: "alice@example.com,alice@example.net,bob@example.org",
+		},
+		{name: "to itself", email: "alice@example.com", destination: "alice@example.net,Alice@example.com", want: ErrInvalid},
+		{name: "invalid destination", email: "alice@example.com", destination: "alice", want: ErrInvalid},
+		{name: "empty destination", email: "alice@example.com", destination: " , ", want: ErrInvalid},
+		{name: "missing user", email: "bob@example.com", destination: "bob@example.net", want: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.SetForward(tt.email, tt.destination, tt.keep)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("SetForward(%q) = %v, want %v", tt.destination, err, tt.want)
+			}
+			if tt.want != nil {
+				return
+			}
+
+			user, err := db.GetUser(tt.email)
+			if err != nil {
+				t.Fatalf("GetUser: %v", err)
+			}
+			if !user.ForwardEnabled || user.ForwardDestination != tt.wantDest || user.ForwardKeep != tt.keep {
+				t.Errorf("forward = %t %q keep %t, want %q keep %t",
+					user.ForwardEnabled, user.ForwardDestination, user.ForwardKeep, tt.wantDest, tt.keep)
+			}
+			match, err := db.ResolveAlias(tt.email, "")
+			if err != nil {
+				t.Fatalf("ResolveAlias: %v", err)
+			}
+			if match.Kind != MatchForward || match.Destination != tt.wantResolve {
+				t.Errorf("ResolveAlias = %s to %q, want forward to %q", match.Kind, match.Destination, tt.wantResolve)
+			}
+		})
+	}
+}
+
+func TestClearForward(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddUser("alice@example.com", testPassword, 0),
+		db.SetForward("alice@example.com", "alice@example.net", false),
+		db.ClearForward("alice@example.com"),
+	)
+
+	user, err := db.GetUser("alice@example.com")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if user.ForwardEnabled || user.ForwardDestination != "" {
+		t.Errorf("forward = %t %q after clearing", user.ForwardEnabled, user.ForwardDestination)
+	}
+	match, err := db.ResolveAlias("alice@example.com", "")
+	if err != nil {
+		t.Fatalf("ResolveAlias: %v", err)
+	}
+	if match.Kind != MatchUser || match.Destination != "alice@example.com" {
+		t.Errorf("ResolveAlias = %s to %q, want the mailbox", match.Kind, match.Destination)
+	}
+
+	if err := db.ClearForward("bob@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ClearForward(missing user) = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// domainLimitColumns selects the limits of a domain, in the order they are
+// scanned into Domain
+const domainLimitColumns = `COALESCE(max_users, 0), COALESCE(max_aliases, 0),
+			COALESCE(max_quota_bytes, 0), enabled IS NOT FALSE`
+
+// checkQuota fails if a user quota is over the domain's largest quota. With
+// a largest quota set, users cannot be unlimited either.
+func (d *Domain) checkQuota(quota int64) error {
+	if d.MaxQuota <= 0 {
+		return nil
+	}
+	if quota == 0 {
+		return errorf(ErrLimit, "domain %s limits quotas to %d bytes, so a user cannot be unlimited", d.Name, d.MaxQuota)
+	}
+	if quota > d.MaxQuota {
+		return errorf(ErrLimit, "quota of %d bytes is over the limit of %d bytes for domain %s", quota, d.MaxQuota, d.Name)
+	}
+	return nil
+}
+
+// checkNewLimits fails if the new limits are negative or below what the
+// domain already uses
+func (db *DB) checkNewLimits(domain string, update DomainUpdate) error {
+	if (update.MaxUsers != nil && *update.MaxUsers < 0) ||
+		(update.MaxAliases != nil && *update.MaxAliases < 0) ||
+		(update.MaxQuota != nil && *update.MaxQuota < 0) {
+		return errorf(ErrInvalid, "limits cannot be negative (use 0 for unlimited)")
+	}
+
+	d, err := db.GetDomain(domain)
+	if errors.Is(err, ErrNotFound) {
+		return nil // reported by the update itself
+	}
+	if err != nil {
+		return err
+	}
+
+	if update.MaxUsers != nil && *update.MaxUsers > 0 && d.UserCount > *update.MaxUsers {
+		return errorf(ErrLimit, "domain %s already has %d users, more than the new limit of %d", domain, d.UserCount, *update.MaxUsers)
+	}
+	if update.MaxAliases != nil && *update.MaxAliases > 0 && d.AliasCount > *update.MaxAliases {
+		return errorf(ErrLimit, "domain %s already has %d aliases, more than the new limit of %d", domain, d.AliasCount, *update.MaxAliases)
+	}
+	if update.MaxQuota != nil && *update.MaxQuota > 0 {
+		var over int
+		err := db.queryRow(`SELECT COUNT(*) FROM users WHERE email LIKE ? AND (quota_bytes = 0 OR quota_bytes > ?)`,
+			"%@"+domain, *update.MaxQuota).Scan(&over)
+		if err != nil {
+			return fmt.Errorf("failed to check quotas: %w", err)
+		}
+		if over > 0 {
+			return errorf(ErrLimit, "%d users of domain %s have a quota over the new limit of %d bytes", over, domain, *update.MaxQuota)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a single versioned schema change. Statements may use the
+// dialect placeholders understood by dialect.ddl.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(d dialect) []string
+	Down    func(d dialect) []string // nil if the migration cannot be reverted
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// migrations is the ordered registry of schema changes. Append new entries
+// with the next version number; never edit a migration once released.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(d dialect) []string {
+			stmts := []string{
+				`CREATE TABLE IF NOT EXISTS users (
+    id {{pk}},
+    email VARCHAR(255) UNIQUE NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    display_name VARCHAR(255),
+    quota_bytes BIGINT DEFAULT 0,
+    enabled BOOLEAN DEFAULT {{true}},
+    global_admin BOOLEAN DEFAULT {{false}},
+    created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+    updated_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+)`,
+				`CREATE TABLE IF NOT EXISTS domains (
+    id {{pk}},
+    name VARCHAR(255) UNIQUE NOT NULL,
+    max_users INTEGER DEFAULT 0,
+    max_aliases INTEGER DEFAULT 0,
+    max_quota_bytes BIGINT DEFAULT 0,
+    enabled BOOLEAN DEFAULT {{true}},
+    created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+)`,
+				`CREATE TABLE IF NOT EXISTS aliases (
+    id {{pk}},
+    email VARCHAR(255) UNIQUE NOT NULL,
+    destination TEXT NOT NULL,
+    wildcard BOOLEAN DEFAULT {{false}},
+    enabled BOOLEAN DEFAULT {{true}},
+    created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+)`,
+				`CREATE TABLE IF NOT EXISTS domain_admins (
+    user_id INTEGER,
+    domain_id INTEGER,
+    created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (domain_id) REFERENCES domains(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, domain_id)
+)`,
+			}
+			// The UNIQUE constraints already index these columns on MySQL,
+			// which has no CREATE INDEX IF NOT EXISTS
+			if d.indexIfNotExists {
+				stmts = append(stmts,
+					"CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)",
+					"CREATE INDEX IF NOT EXISTS idx_domains_name ON domains(name)",
+					"CREATE INDEX IF NOT EXISTS idx_aliases_email ON aliases(email)",
+				)
+			}
+			return stmts
+		},
+		// Reverting the initial schema would drop every account
+		Down: nil,
+	},
+	{
+		Version: 2,
+		Name:    "user attributes",
+		Up: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE users ADD COLUMN enable_imap BOOLEAN DEFAULT {{true}}",
+				"ALTER TABLE users ADD COLUMN enable_pop BOOLEAN DEFAULT {{true}}",
+				"ALTER TABLE users ADD COLUMN force_password_change BOOLEAN DEFAULT {{false}}",
+				"ALTER TABLE users ADD COLUMN quota_bytes_used BIGINT DEFAULT 0",
+			}
+		},
+		Down: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE users DROP COLUMN quota_bytes_used",
+				"ALTER TABLE users DROP COLUMN force_password_change",
+				"ALTER TABLE users DROP COLUMN enable_pop",
+				"ALTER TABLE users DROP COLUMN enable_imap",
+			}
+		},
+	},
+	{
+		Version: 3,
+		Name:    "alias comments",
+		Up: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE aliases ADD COLUMN comment VARCHAR(255) DEFAULT ''",
+				// Destinations used to be stored as typed
+				"UPDATE aliases SET destination = REPLACE(destination, ' ', '')",
+			}
+		},
+		Down: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE aliases DROP COLUMN comment",
+			}
+		},
+	},
+	{
+		Version: 4,
+		Name:    "alternative domains",
+		Up: func(d dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS alternatives (
+    id {{pk}},
+    name VARCHAR(255) UNIQUE NOT NULL,
+    domain_id INTEGER NOT NULL,
+    created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (domain_id) REFERENCES domains(id) ON DELETE CASCADE
+)`,
+			}
+		},
+		Down: func(d dialect) []string {
+			return []string{"DROP TABLE IF EXISTS alternatives"}
+		},
+	},
+	{
+		Version: 5,
+		Name:    "user forwarding",
+		Up: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE users ADD COLUMN forward_enabled BOOLEAN DEFAULT {{false}}",
+				"ALTER TABLE users ADD COLUMN forward_destination TEXT",
+				"ALTER TABLE users ADD COLUMN forward_keep BOOLEAN DEFAULT {{true}}",
+			}
+		},
+		Down: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE users DROP COLUMN forward_keep",
+				"ALTER TABLE users DROP COLUMN forward_destination",
+				"ALTER TABLE users DROP COLUMN forward_enabled",
+			}
+		},
+	},
+	{
+		Version: 6,
+		Name:    "auto-reply",
+		Up: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE users ADD COLUMN reply_enabled BOOLEAN DEFAULT {{false}}",
+				"ALTER TABLE users ADD COLUMN reply_subject VARCHAR(255) DEFAULT ''",
+				"ALTER TABLE users ADD COLUMN reply_body TEXT",
+				"ALTER TABLE users ADD COLUMN reply_start DATE",
+				"ALTER TABLE users ADD COLUMN reply_end DATE",
+				"ALTER TABLE users ADD COLUMN reply_days INTEGER DEFAULT 1",
+			}
+		},
+		Down: func(d dialect) []string {
+			return []string{
+				"ALTER TABLE users DROP COLUMN reply_days",
+				"ALTER TABLE users DROP COLUMN reply_end",
+				"ALTER TABLE users DROP COLUMN reply_start",
+				"ALTER TABLE users DROP COLUMN reply_body",
+				"ALTER TABLE users DROP COLUMN reply_subject",
+				"ALTER TABLE users DROP COLUMN reply_enabled",
+			}
+		},
+	},
+	{
+		Version: 7,
+		Name:    "authentication tokens",
+		Up: func(d dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS tokens (
+    id {{pk}},
+    user_id INTEGER NOT NULL,
+    secret_hash VARCHAR(64) UNIQUE NOT NULL,
+    comment VARCHAR(255) DEFAULT '',
+    ip TEXT,
+    created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+)`,
+			}
+		},
+		Down: func(d dialect) []string {
+			return []string{"DROP TABLE IF EXISTS tokens"}
+		},
+	},
+	{
+		Version: 8,
+		Name:    "relays",
+		Up: func(d dialect) []string {
+			return []string{
+				`CREATE TABLE IF NOT EXISTS relays (
+    id {{pk}},
+    name VARCHAR(255) UNIQUE NOT NULL,
+    nexthop VARCHAR(255) DEFAULT '',
+    comment VARCHAR(255) DEFAULT '',
+    created_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+)`,
+			}
+		},
+		Down: func(d dialect) []string {
+			return []string{"DROP TABLE IF EXISTS relays"}
+		},
+	},
+}
+
+// ensureMigrationsTable creates the table that records applied versions
+func (db *DB) ensureMigrationsTable() error {
+	_, err := db.conn.Exec(db.dialect.ddl(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at {{timestamp}} DEFAULT CURRENT_TIMESTAMP
+)`))
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the applied versions and when they ran
+func (db *DB) appliedMigrations() (map[int]time.Time, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[version] = appliedAt.Time
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Migrate applies all pending migrations in order and returns how many ran
+func (db *DB) Migrate() (int, error) {
+	if err := db.requireGlobalAdmin("migrate the database"); err != nil {
+		return 0, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := db.runMigration(m, m.Up, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Rollback reverts the most recently applied migrations, newest first
+func (db *DB) Rollback(steps int) (int, error) {
+	if err := db.requireGlobalAdmin("roll back migrations"); err != nil {
+		return 0, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for idx := len(migrations) - 1; idx >= 0 && count < steps; idx-- {
+		m := migrations[idx]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return count, fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		if err := db.runMigration(m, m.Down, "DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+			return count, fmt.Errorf("rollback of migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrationStatus lists every known migration and whether it is applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		status = append(status, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return status, nil
+}
+
+// runMigration executes one direction of a migration and updates the
+// bookkeeping row in a single transaction. MySQL commits implicitly on DDL,
+// so there a failure part-way through can leave earlier statements applied.
+func (db *DB) runMigration(m migration, steps func(d dialect) []string, record string, args ...interface{}) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range steps(db.dialect) {
+		if _, err := tx.Exec(db.dialect.rebind(db.dialect.ddl(stmt))); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(db.dialect.rebind(record), args...); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mailstack/mailstack/internal/config"
+)
+
+// commonPasswords are rejected regardless of length and character classes
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true,
+	"123456": true, "12345678": true, "123456789": true, "1234567890": true,
+	"qwerty": true, "qwerty123": true, "qwertyuiop": true, "azerty": true,
+	"abc123": true, "letmein": true, "welcome": true, "welcome1": true,
+	"iloveyou": true, "admin": true, "admin123": true, "administrator": true,
+	"changeme": true, "secret": true, "monkey": true, "dragon": true,
+	"football": true, "baseball": true, "sunshine": true, "princess": true,
+	"trustno1": true, "master": true, "login": true, "starwars": true,
+	"mailstack": true, "postmaster": true, "p@ssw0rd": true, "p@ssword": true,
+}
+
+// CheckPassword reports why password does not satisfy policy for email
+func CheckPassword(policy config.PasswordPolicyConfig, email, password string) error {
+	if password == "" {
+		return errorf(ErrInvalid, "password cannot be empty")
+	}
+	// bcrypt only hashes the first 72 bytes
+	if len(password) > 72 {
+		return errorf(ErrInvalid, "password cannot be longer than 72 bytes")
+	}
+	if len([]rune(password)) < policy.MinLength {
+		return errorf(ErrInvalid, "password must be at least %d characters long", policy.MinLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < policy.MinClasses {
+		return errorf(ErrInvalid, "password must mix at least %d of lowercase, uppercase, digits and symbols", policy.MinClasses)
+	}
+
+	if policy.AllowCommon {
+		return nil
+	}
+
+	lowered := strings.ToLower(password)
+	if commonPasswords[lowered] || commonPasswords[strings.TrimRight(lowered, "0123456789!")] {
+		return errorf(ErrInvalid, "password is too common")
+	}
+	local, domain, _ := strings.Cut(strings.ToLower(email), "@")
+	label, _, _ := strings.Cut(domain, ".")
+	if (len(local) >= 3 && strings.Contains(lowered, local)) ||
+		(len(label) >= 4 && strings.Contains(lowered, label)) {
+		return errorf(ErrInvalid, "password must not contain the user or domain name")
+	}
+	if isRepetitive(lowered) {
+		return errorf(ErrInvalid, "password is too repetitive")
+	}
+
+	return nil
+}
+
+// isRepetitive catches passwords such as "aaaaaaaaaa" or "abcdefghij"
+func isRepetitive(password string) bool {
+	runes := []rune(password)
+	if len(runes) < 2 {
+		return false
+	}
+
+	same, sequence := true, true
+	for i := 1; i < len(runes); i++ {
+		if runes[i] != runes[0] {
+			same = false
+		}
+		if runes[i] != runes[i-1]+1 {
+			sequence = false
+		}
+	}
+	return same || sequence
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/config"
+)
+
+func TestCheckPassword(t *testing.T) {
+	lenient := config.PasswordPolicyConfig{MinLength: 0, MinClasses: 0, AllowCommon: true}
+
+	tests := []struct {
+		name     string
+		policy   config.PasswordPolicyConfig
+		password string
+		wantErr  string // substring of the error, empty when the password is accepted
+	}{
+		{name: "good", policy: config.DefaultPasswordPolicy, password: testPassword},
+		{name: "empty", policy: config.DefaultPasswordPolicy, password: "", wantErr: "cannot be empty"},
+		{name: "empty without a minimum length", policy: lenient, password: "", wantErr: "cannot be empty"},
+		{name: "72 bytes", policy: config.DefaultPasswordPolicy, password: "Aa1" + strings.Repeat("x", 69)},
+		{name: "73 bytes", policy: config.DefaultPasswordPolicy, password: "Aa1" + strings.Repeat("x", 70), wantErr: "longer than 72 bytes"},
+		{name: "multibyte over 72 bytes", policy: lenient, password: strings.Repeat("é", 37), wantErr: "longer than 72 bytes"},
+		{name: "too short", policy: config.DefaultPasswordPolicy, password: "Tr0ub4d", wantErr: "at least 10 characters"},
+		{name: "too few classes", policy: config.DefaultPasswordPolicy, password: "troubadorxyz", wantErr: "at least 2 of"},
+		{name: "common", policy: config.DefaultPasswordPolicy, password: "Password123", wantErr: "too common"},
+		{name: "common with a suffix", policy: config.DefaultPasswordPolicy, password: "Sunshine2024!", wantErr: "too common"},
+		{name: "contains the local part", policy: config.DefaultPasswordPolicy, password: "Alice-Rocks-42", wantErr: "user or domain name"},
+		{name: "contains the domain label", policy: config.DefaultPasswordPolicy, password: "Example-Rocks-42", wantErr: "user or domain name"},
+		{name: "repetitive", policy: config.PasswordPolicyConfig{MinLength: 10}, password: "aaaaaaaaaaaa", wantErr: "too repetitive"},
+		{name: "sequence", policy: config.PasswordPolicyConfig{MinLength: 10}, password: "abcdefghijkl", wantErr: "too repetitive"},
+		{name: "common allowed", policy: lenient, password: "password"},
+		{name: "no minimum length", policy: lenient, password: "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPassword(tt.policy, "alice@example.com", tt.password)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckPassword(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckPassword(%q) = %v, want an error containing %q", tt.password, err, tt.wantErr)
+			}
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("CheckPassword(%q) = %v, want ErrInvalid", tt.password, err)
+			}
+		})
+	}
+}
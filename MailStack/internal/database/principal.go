@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Principal is the user on whose behalf changes are made. Global admins
+// may do anything; domain admins only manage the users and aliases of
+// their own domains. A DB without a principal, as used by root on the
+// box, is not restricted.
+type Principal struct {
+	Email       string   `json:"email"`
+	GlobalAdmin bool     `json:"global_admin"`
+	Domains     []string `json:"domains"` // domains administered, for domain admins
+}
+
+// LoadPrincipal looks up the rights of an enabled user
+func (db *DB) LoadPrincipal(email string) (*Principal, error) {
+	p := Principal{Email: email}
+	var enabled bool
+	err := db.queryRow("SELECT enabled, global_admin FROM users WHERE email = ?", email).Scan(&enabled, &p.GlobalAdmin)
+	if err == sql.ErrNoRows || (err == nil && !enabled) {
+		return nil, errorf(ErrPermission, "%s is not an enabled user", email)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	rows, err := db.query(`SELECT d.name FROM domain_admins da
+		JOIN users u ON u.id = da.user_id
+		JOIN domains d ON d.id = da.domain_id
+		WHERE u.email = ?
+		ORDER BY d.name`, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query domain admins: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, fmt.Errorf("failed to scan domain admin: %w", err)
+		}
+		p.Domains = append(p.Domains, domain)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating domain admins: %w", err)
+	}
+
+	if !p.GlobalAdmin && len(p.Domains) == 0 {
+		return nil, errorf(ErrPermission, "%s is not an administrator", email)
+	}
+	return &p, nil
+}
+
+// As returns a DB that makes every change on behalf of p
+func (db *DB) As(p *Principal) *DB {
+	scoped := *db
+	scoped.principal = p
+	return &scoped
+}
+
+// Principal returns who changes are made for, or nil when unrestricted
+func (db *DB) Principal() *Principal {
+	return db.principal
+}
+
+// CanManage reports whether p may manage the users and aliases of domain
+func (p *Principal) CanManage(domain string) bool {
+	if p == nil || p.GlobalAdmin {
+		return true
+	}
+	for _, d := range p.Domains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize fails unless the principal may manage domain
+func (db *DB) authorize(domain string) error {
+	if !db.principal.CanManage(domain) {
+		return errorf(ErrPermission, "%s is not an administrator of %s", db.principal.Email, domain)
+	}
+	return nil
+}
+
+// authorizeAddress fails unless the principal may manage the domain of
+// a user or alias address
+func (db *DB) authorizeAddress(email string) error {
+	return db.authorize(domainOf(email))
+}
+
+// domainOf returns the domain part of an address
+func domainOf(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
+
+// authorizeUser fails unless the principal may change the user. Only global
+// admins may change other global admins, even in a domain they administer.
+func (db *DB) authorizeUser(email string) error {
+	if err := db.authorizeAddress(email); err != nil {
+		return err
+	}
+	if db.principal == nil || db.principal.GlobalAdmin {
+		return nil
+	}
+
+	var globalAdmin bool
+	err := db.queryRow("SELECT global_admin FROM users WHERE email = ?", email).Scan(&globalAdmin)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check user: %w", err)
+	}
+	if globalAdmin {
+		return errorf(ErrPermission, "only global administrators can change %s", email)
+	}
+	return nil
+}
+
+// requireGlobalAdmin fails unless the principal is a global admin
+func (db *DB) requireGlobalAdmin(action string) error {
+	if db.principal != nil && !db.principal.GlobalAdmin {
+		return errorf(ErrPermission, "only global administrators can %s", action)
+	}
+	return nil
+}
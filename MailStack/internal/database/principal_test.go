@@ -0,0 +1,219 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCanManage(t *testing.T) {
+	domainAdmin := &Principal{Email: "alice@example.com", Domains: []string{"example.com"}}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		domain    string
+		want      bool
+	}{
+		{name: "unrestricted", principal: nil, domain: "example.org", want: true},
+		{name: "global admin", principal: &Principal{Email: "root@example.com", GlobalAdmin: true}, domain: "example.org", want: true},
+		{name: "own domain", principal: domainAdmin, domain: "example.com", want: true},
+		{name: "own domain in capitals", principal: domainAdmin, domain: "EXAMPLE.COM", want: true},
+		{name: "other domain", principal: domainAdmin, domain: "example.org", want: false},
+		{name: "subdomain", principal: domainAdmin, domain: "sub.example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.CanManage(tt.domain); got != tt.want {
+				t.Errorf("CanManage(%q) = %v, want %v", tt.domain, got, tt.want)
+			}
+		})
+	}
+}
+
+// delegationDB has a domain admin of example.com, a global admin in that
+// same domain and users in example.org; it returns the unrestricted DB
+// and the DBs acting for the domain admin and for the global admin
+func delegationDB(t *testing.T) (db, domainAdmin, globalAdmin *DB) {
+	t.Helper()
+
+	db = newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddDomain("example.org"),
+		db.AddUser("alice@example.com", testPassword, 0),
+		db.AddUser("bob@example.com", testPassword, 0),
+		db.AddUser("root@example.com", testPassword, 0),
+		db.AddUser("carol@example.org", testPassword, 0),
+		db.AddAlias("info@example.com", "alice@example.com", ""),
+		db.AddAlias("info@example.org", "carol@example.org", ""),
+		db.AddDomainAdmin("alice@example.com", "example.com"),
+		db.UpdateUser("root@example.com", UserUpdate{GlobalAdmin: Ptr(true)}),
+	)
+
+	alice, err := db.LoadPrincipal("alice@example.com")
+	mustRun(t, err)
+	root, err := db.LoadPrincipal("root@example.com")
+	mustRun(t, err)
+	return db, db.As(alice), db.As(root)
+}
+
+func TestDelegationBoundary(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func(db *DB) error
+		wantErr error
+	}{
+		// The domain admin's own domain
+		{name: "add user in own domain", op: func(db *DB) error { return db.AddUser("dave@example.com", testPassword, 0) }},
+		{name: "update user in own domain", op: func(db *DB) error {
+			return db.UpdateUser("bob@example.com", UserUpdate{Enabled: Ptr(false)})
+		}},
+		{name: "add alias in own domain", op: func(db *DB) error { return db.AddAlias("sales@example.com", "bob@example.com", "") }},
+
+		// Another domain
+		{name: "add user in other domain", op: func(db *DB) error { return db.AddUser("dave@example.org", testPassword, 0) }, wantErr: ErrPermission},
+		{name: "get user in other domain", op: func(db *DB) error { _, err := db.GetUser("carol@example.org"); return err }, wantErr: ErrPermission},
+		{name: "update user in other domain", op: func(db *DB) error {
+			return db.UpdateUser("carol@example.org", UserUpdate{Enabled: Ptr(false)})
+		}, wantErr: ErrPermission},
+		{name: "change password in other domain", op: func(db *DB) error {
+			return db.ChangePassword("carol@example.org", "An0ther-Passw0rd")
+		}, wantErr: ErrPermission},
+		{name: "delete user in other domain", op: func(db *DB) error { return db.DeleteUser("carol@example.org", nil) }, wantErr: ErrPermission},
+		{name: "add alias in other domain", op: func(db *DB) error { return db.AddAlias("sales@example.org", "carol@example.org", "") }, wantErr: ErrPermission},
+		{name: "delete alias in other domain", op: func(db *DB) error { return db.DeleteAlias("info@example.org") }, wantErr: ErrPermission},
+
+		// Global admins, even in the domain admin's own domain
+		{name: "update global admin", op: func(db *DB) error {
+			return db.UpdateUser("root@example.com", UserUpdate{Enabled: Ptr(false)})
+		}, wantErr: ErrPermission},
+		{name: "change password of global admin", op: func(db *DB) error {
+			return db.ChangePassword("root@example.com", "An0ther-Passw0rd")
+		}, wantErr: ErrPermission},
+		{name: "delete global admin", op: func(db *DB) error { return db.DeleteUser("root@example.com", nil) }, wantErr: ErrPermission},
+		{name: "forward global admin", op: func(db *DB) error {
+			return db.SetForward("root@example.com", "alice@example.com", false)
+		}, wantErr: ErrPermission},
+		{name: "grant global admin", op: func(db *DB) error {
+			return db.UpdateUser("bob@example.com", UserUpdate{GlobalAdmin: Ptr(true)})
+		}, wantErr: ErrPermission},
+
+		// Global settings
+		{name: "add domain", op: func(db *DB) error { return db.AddDomain("example.net") }, wantErr: ErrPermission},
+		{name: "delete own domain", op: func(db *DB) error { return db.DeleteDomain("example.com") }, wantErr: ErrPermission},
+		{name: "change own domain limits", op: func(db *DB) error {
+			return db.UpdateDomain("example.com", DomainUpdate{MaxQuota: Ptr(int64(1 << 30))})
+		}, wantErr: ErrPermission},
+		{name: "grant domain admin", op: func(db *DB) error { return db.AddDomainAdmin("bob@example.com", "example.com") }, wantErr: ErrPermission},
+		{name: "add relay", op: func(db *DB) error { return db.AddRelay("backup.example.net", "", "") }, wantErr: ErrPermission},
+		{name: "add alternative", op: func(db *DB) error { return db.AddAlternative("example.net", "example.com") }, wantErr: ErrPermission},
+	}
+
+	// The allowed changes do not get in the way of the refused ones
+	_, domainAdmin, _ := delegationDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(domainAdmin); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGrantAndRevokeGlobalAdmin(t *testing.T) {
+	db, _, globalAdmin := delegationDB(t)
+
+	// bob has no admin rights yet
+	if _, err := db.LoadPrincipal("bob@example.com"); !errors.Is(err, ErrPermission) {
+		t.Fatalf("LoadPrincipal before the grant = %v, want ErrPermission", err)
+	}
+
+	mustRun(t, globalAdmin.UpdateUser("bob@example.com", UserUpdate{GlobalAdmin: Ptr(true)}))
+	bob, err := db.LoadPrincipal("bob@example.com")
+	if err != nil {
+		t.Fatalf("LoadPrincipal after the grant: %v", err)
+	}
+	if !bob.GlobalAdmin || !bob.CanManage("example.org") {
+		t.Errorf("granted principal = %+v, want a global admin", bob)
+	}
+
+	mustRun(t, globalAdmin.UpdateUser("bob@example.com", UserUpdate{GlobalAdmin: Ptr(false)}))
+	if _, err := db.LoadPrincipal("bob@example.com"); !errors.Is(err, ErrPermission) {
+		t.Errorf("LoadPrincipal after the revoke = %v, want ErrPermission", err)
+	}
+
+	// A revoked global admin that is also a domain admin keeps that
+	mustRun(t,
+		globalAdmin.UpdateUser("alice@example.com", UserUpdate{GlobalAdmin: Ptr(true)}),
+		globalAdmin.UpdateUser("alice@example.com", UserUpdate{GlobalAdmin: Ptr(false)}),
+	)
+	alice, err := db.LoadPrincipal("alice@example.com")
+	mustRun(t, err)
+	if alice.GlobalAdmin || !slices.Equal(alice.Domains, []string{"example.com"}) {
+		t.Errorf("alice = %+v, want a domain admin of example.com", alice)
+	}
+}
+
+func TestListFilteredByPrincipal(t *testing.T) {
+	db, domainAdmin, globalAdmin := delegationDB(t)
+
+	userEmails := func(db *DB) []string {
+		users, err := db.ListUsers()
+		mustRun(t, err)
+		var emails []string
+		for _, u := range users {
+			emails = append(emails, u.Email)
+		}
+		slices.Sort(emails)
+		return emails
+	}
+	aliasEmails := func(db *DB) []string {
+		aliases, err := db.ListAliases()
+		mustRun(t, err)
+		var emails []string
+		for _, a := range aliases {
+			emails = append(emails, a.Email)
+		}
+		slices.Sort(emails)
+		return emails
+	}
+	domainNames := func(db *DB) []string {
+		domains, err := db.ListDomains()
+		mustRun(t, err)
+		var names []string
+		for _, d := range domains {
+			names = append(names, d.Name)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	allUsers := []string{"alice@example.com", "bob@example.com", "carol@example.org", "root@example.com"}
+	tests := []struct {
+		name    string
+		db      *DB
+		users   []string
+		aliases []string
+		domains []string
+	}{
+		{name: "unrestricted", db: db, users: allUsers, aliases: []string{"info@example.com", "info@example.org"}, domains: []string{"example.com", "example.org"}},
+		{name: "global admin", db: globalAdmin, users: allUsers, aliases: []string{"info@example.com", "info@example.org"}, domains: []string{"example.com", "example.org"}},
+		{name: "domain admin", db: domainAdmin, users: []string{"alice@example.com", "bob@example.com", "root@example.com"}, aliases: []string{"info@example.com"}, domains: []string{"example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := userEmails(tt.db); !slices.Equal(got, tt.users) {
+				t.Errorf("users = %v, want %v", got, tt.users)
+			}
+			if got := aliasEmails(tt.db); !slices.Equal(got, tt.aliases) {
+				t.Errorf("aliases = %v, want %v", got, tt.aliases)
+			}
+			if got := domainNames(tt.db); !slices.Equal(got, tt.domains) {
+				t.Errorf("domains = %v, want %v", got, tt.domains)
+			}
+		})
+	}
+}
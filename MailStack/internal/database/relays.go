@@ -0,0 +1,232 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Relay is a domain postfix accepts mail for and forwards instead of
+// delivering it, e.g. as a backup MX or for split delivery
+type Relay struct {
+	Name      string    `json:"name"`
+	Nexthop   string    `json:"nexthop"` // "smtp:[host]:port", empty to deliver to the domain's MX hosts
+	Comment   string    `json:"comment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RelayUpdate holds the relay settings to change; nil fields are kept
+type RelayUpdate struct {
+	Nexthop *string
+	Comment *string
+}
+
+// NormalizeNexthop checks an upstream host given as host, host:port,
+// [host]:port or smtp:host:port and returns it as a postfix transport,
+// smtp:[host]:port with port 25 by default. The brackets turn off MX
+// lookups, so mail goes to exactly that host. An empty nexthop stays empty.
+func NormalizeNexthop(nexthop string) (string, error) {
+	raw := strings.TrimSpace(nexthop)
+	if raw == "" {
+		return "", nil
+	}
+
+	rest := strings.TrimPrefix(raw, "smtp:")
+	host, port := rest, "25"
+	if h, p, err := net.SplitHostPort(rest); err == nil {
+		host, port = h, p
+	} else {
+		host = strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]")
+	}
+	host = strings.TrimPrefix(strings.ToLower(host), "ipv6:")
+
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return "", errorf(ErrInvalid, "invalid nexthop %q, expected smtp:host:port", nexthop)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+		if ip.To4() == nil {
+			host = "ipv6:" + host
+		}
+	} else if !validHostname(host) {
+		return "", errorf(ErrInvalid, "invalid nexthop %q, expected smtp:host:port", nexthop)
+	}
+
+	return fmt.Sprintf("smtp:[%s]:%d", host, number), nil
+}
+
+// validHostname reports whether host is made of letter, digit and hyphen
+// labels
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// AddRelay makes postfix relay mail for name to nexthop, a transport from
+// NormalizeNexthop or empty for the domain's MX hosts
+func (db *DB) AddRelay(name, nexthop, comment string) error {
+	if err := db.requireGlobalAdmin("add relay domains"); err != nil {
+		return err
+	}
+
+	if !strings.Contains(name, ".") || strings.ContainsAny(name, "@/%_ ") {
+		return errorf(ErrInvalid, "invalid domain format: %s", name)
+	}
+	nexthop, err := NormalizeNexthop(nexthop)
+	if err != nil {
+		return err
+	}
+	if len(comment) > 255 {
+		return errorf(ErrInvalid, "relay comment cannot be longer than 255 characters")
+	}
+
+	var isLocal bool
+	err = db.queryRow(`
+		SELECT COUNT(*) > 0 FROM (
+			SELECT name FROM domains WHERE name = ?
+			UNION
+			SELECT name FROM alternatives WHERE name = ?
+		) local_domains
+	`, name, name).Scan(&isLocal)
+	if err != nil {
+		return fmt.Errorf("failed to check domains: %w", err)
+	}
+	if isLocal {
+		return errorf(ErrConflict, "%s is a mail domain and cannot be relayed", name)
+	}
+
+	_, err = db.exec("INSERT INTO relays (name, nexthop, comment) VALUES (?, ?, ?)", name, nexthop, comment)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return errorf(ErrExists, "relay domain %s already exists", name)
+		}
+		return fmt.Errorf("failed to create relay domain: %w", err)
+	}
+	return nil
+}
+
+// UpdateRelay changes the nexthop or comment of a relay domain
+func (db *DB) UpdateRelay(name string, update RelayUpdate) error {
+	if err := db.requireGlobalAdmin("change relay domains"); err != nil {
+		return err
+	}
+
+	var sets []string
+	var args []interface{}
+	if update.Nexthop != nil {
+		nexthop, err := NormalizeNexthop(*update.Nexthop)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, "nexthop = ?")
+		args = append(args, nexthop)
+	}
+	if update.Comment != nil {
+		if len(*update.Comment) > 255 {
+			return errorf(ErrInvalid, "relay comment cannot be longer than 255 characters")
+		}
+		sets = append(sets, "comment = ?")
+		args = append(args, *update.Comment)
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	args = append(args, name)
+	result, err := db.exec("UPDATE relays SET "+strings.Join(sets, ", ")+" WHERE name = ?", args...)
+	if err != nil {
+		return fmt.Errorf("failed to update relay domain: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update relay domain: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "relay domain %s does not exist", name)
+	}
+	return nil
+}
+
+// DeleteRelay stops relaying mail for name
+func (db *DB) DeleteRelay(name string) error {
+	if err := db.requireGlobalAdmin("remove relay domains"); err != nil {
+		return err
+	}
+
+	result, err := db.exec("DELETE FROM relays WHERE name = ?", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete relay domain: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete relay domain: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "relay domain %s does not exist", name)
+	}
+	return nil
+}
+
+// GetRelay returns a relay domain
+func (db *DB) GetRelay(name string) (*Relay, error) {
+	if err := db.authorize(name); err != nil {
+		return nil, err
+	}
+
+	var r Relay
+	err := db.queryRow(`
+		SELECT name, COALESCE(nexthop, ''), COALESCE(comment, ''), created_at
+		FROM relays WHERE name = ?
+	`, name).Scan(&r.Name, &r.Nexthop, &r.Comment, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errorf(ErrNotFound, "relay domain %s does not exist", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relay domain: %w", err)
+	}
+	return &r, nil
+}
+
+// ListRelays returns the relay domains the principal may manage
+func (db *DB) ListRelays() ([]Relay, error) {
+	rows, err := db.query(`
+		SELECT name, COALESCE(nexthop, ''), COALESCE(comment, ''), created_at
+		FROM relays ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relay domains: %w", err)
+	}
+	defer rows.Close()
+
+	var relays []Relay
+	for rows.Next() {
+		var r Relay
+		if err := rows.Scan(&r.Name, &r.Nexthop, &r.Comment, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan relay domain: %w", err)
+		}
+		if db.principal.CanManage(r.Name) {
+			relays = append(relays, r)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating relay domains: %w", err)
+	}
+
+	return relays, nil
+}
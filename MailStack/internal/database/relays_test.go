@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeNexthop(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "", want: ""},
+		{in: "  ", want: ""},
+		{in: "mx1.example.org", want: "smtp:[mx1.example.org]:25"},
+		{in: "MX1.Example.ORG:2525", want: "smtp:[mx1.example.org]:2525"},
+		{in: "smtp:mx1.example.org:25", want: "smtp:[mx1.example.org]:25"},
+		{in: "smtp:[mx1.example.org]:587", want: "smtp:[mx1.example.org]:587"},
+		{in: "[mx1.example.org]", want: "smtp:[mx1.example.org]:25"},
+		{in: " 192.0.2.10 ", want: "smtp:[192.0.2.10]:25"},
+		{in: "192.0.2.10:10025", want: "smtp:[192.0.2.10]:10025"},
+		{in: "[2001:db8::10]:25", want: "smtp:[ipv6:2001:db8::10]:25"},
+		{in: "smtp:[ipv6:2001:DB8::10]:25", want: "smtp:[ipv6:2001:db8::10]:25"},
+		{in: "mx1.example.org:0", wantErr: true},
+		{in: "mx1.example.org:65536", wantErr: true},
+		{in: "mx1.example.org:smtp", wantErr: true},
+		{in: "lmtp:mx1.example.org:24", wantErr: true},
+		{in: "mx1_example.org", wantErr: true},
+		{in: "-mx.example.org", wantErr: true},
+		{in: "mx..example.org", wantErr: true},
+		{in: "mx.example.org;reject", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := NormalizeNexthop(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("NormalizeNexthop(%q) = %q, %v; want ErrInvalid", tt.in, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizeNexthop(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddRelay(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddAlternative("example.org", "example.com"),
+		db.AddRelay("backup.example.net", "", ""),
+	)
+
+	tests := []struct {
+		name    string
+		domain  string
+		nexthop string
+		want    error
+	}{
+		{name: "relay", domain: "example.net", nexthop: "mx1.example.net"},
+		{name: "mail domain", domain: "example.com", want: ErrConflict},
+		{name: "alternative domain", domain: "example.org", want: ErrConflict},
+		{name: "existing relay", domain: "backup.example.net", want: ErrExists},
+		{name: "invalid domain", domain: "example_net", want: ErrInvalid},
+		{name: "invalid nexthop", domain: "example.info", nexthop: "mx1.example.info:99999", want: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.AddRelay(tt.domain, tt.nexthop, "")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AddRelay(%q) = %v, want %v", tt.domain, err, tt.want)
+			}
+		})
+	}
+
+	relays, err := db.ListRelays()
+	if err != nil {
+		t.Fatalf("ListRelays: %v", err)
+	}
+	if len(relays) != 2 || relays[0].Name != "backup.example.net" || relays[1].Nexthop != "smtp:[mx1.example.net]:25" {
+		t.Errorf("ListRelays = %+v, want backup.example.net and example.net via smtp:[mx1.example.net]:25", relays)
+	}
+
+	if err := db.AddDomain("example.net"); err == nil {
+		t.Error("AddDomain accepted a relay domain")
+	}
+}
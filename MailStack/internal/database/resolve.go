@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds of rule an address can resolve through, in priority order
+const (
+	MatchUser     = "user"
+	MatchForward  = "forward" // a user whose mail is forwarded
+	MatchAlias    = "alias"
+	MatchWildcard = "wildcard"
+)
+
+// AliasMatch is the rule that delivers mail for an address
+type AliasMatch struct {
+	Address     string `json:"address"`
+	Key         string `json:"key"`           // the address postfix looked up, without any extension
+	Via         string `json:"via,omitempty"` // alternative domain rewritten to its primary
+	Kind        string `json:"kind"`
+	Rule        string `json:"rule"`
+	Destination string `json:"destination"`
+}
+
+// resolveQuery mirrors the postfix virtual alias query: an enabled user
+// wins over an exact alias, which wins over the longest matching wildcard.
+// "_" is literal in patterns, only "%" is a wildcard. The last argument is
+// the address without its extension, so that user+tag@domain reaches the
+// user rather than a catch-all.
+const resolveQuery = `
+	SELECT kind, rule, destination FROM (
+		SELECT 0 AS priority, 0 AS specificity, 'user' AS kind, email AS rule, email AS destination
+		FROM users WHERE email = ? AND enabled = ?
+		UNION ALL
+		SELECT 1, 0, 'alias', email, destination
+		FROM aliases WHERE email = ? AND wildcard = ? AND enabled = ?
+		UNION ALL
+		SELECT 2, LENGTH(email), 'wildcard', email, destination
+		FROM aliases WHERE wildcard = ? AND enabled = ?
+			AND ? LIKE REPLACE(REPLACE(email, '!', '!!'), '_', '!_') ESCAPE '!'
+			AND ? NOT IN (SELECT email FROM users WHERE enabled = ?
+				UNION SELECT email FROM aliases WHERE wildcard = ? AND enabled = ?)
+	) matches
+	ORDER BY priority, specificity DESC, rule
+	LIMIT 1`
+
+// ResolveAlias reports which user or alias receives mail for address, the
+// way postfix looks it up: the full address first, then without the
+// extension after any of the delimiter characters.
+func (db *DB) ResolveAlias(address, delimiter string) (*AliasMatch, error) {
+	base := stripExtension(address, delimiter)
+
+	keys := []string{address}
+	if base != address {
+		keys = append(keys, base)
+	}
+	for _, key := range keys {
+		match := AliasMatch{Address: address, Key: key}
+		err := db.queryRow(resolveQuery,
+			key, true,
+			key, false, true,
+			true, true, key, base, true, false, true,
+		).Scan(&match.Kind, &match.Rule, &match.Destination)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", address, err)
+		}
+		if match.Kind == MatchUser {
+			if err := db.resolveForward(&match); err != nil {
+				return nil, err
+			}
+		}
+		return &match, nil
+	}
+
+	// Alternative domains are rewritten to their primary domain, but only
+	// for addresses that exist there
+	if at := strings.LastIndex(base, "@"); at > 0 {
+		var primary string
+		err := db.queryRow(`SELECT d.name FROM alternatives a JOIN domains d ON d.id = a.domain_id
+			WHERE a.name = ?`, base[at+1:]).Scan(&primary)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to resolve %s: %w", address, err)
+		}
+		if err == nil {
+			match, err := db.ResolveAlias(base[:at+1]+primary, delimiter)
+			if err != nil {
+				return nil, err
+			}
+			match.Address, match.Via = address, base[at+1:]
+			return match, nil
+		}
+	}
+
+	return nil, errorf(ErrNotFound, "no user or alias receives mail for %s", address)
+}
+
+// resolveForward turns a user match into a forward if the user forwards
+// their mail, as the postfix virtual forward query does
+func (db *DB) resolveForward(match *AliasMatch) error {
+	var destination string
+	var keep bool
+	err := db.queryRow(`SELECT forward_destination, forward_keep FROM users
+		WHERE email = ? AND forward_enabled = ? AND COALESCE(forward_destination, '') <> ''`,
+		match.Rule, true).Scan(&destination, &keep)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", match.Address, err)
+	}
+
+	match.Kind, match.Destination = MatchForward, destination
+	if keep {
+		match.Destination = match.Rule + "," + destination
+	}
+	return nil
+}
+
+// stripExtension removes an address extension such as "+tag" from the
+// local part
+func stripExtension(address, delimiter string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 || delimiter == "" {
+		return address
+	}
+	if i := strings.IndexAny(address[:at], delimiter); i > 0 {
+		return address[:i] + address[at:]
+	}
+	return address
+}
+
+// findAliasLoop follows destinations through other aliases and forwarding
+// users and returns the path back to the alias key, or nil if there is no
+// loop. Mailboxes and outside addresses end a path.
+func (db *DB) findAliasLoop(key string, destinations []string) ([]string, error) {
+	visited := make(map[string]bool)
+
+	var walk func(path, destinations []string) ([]string, error)
+	walk = func(path, destinations []string) ([]string, error) {
+		for _, dest := range destinations {
+			match, err := db.ResolveAlias(dest, "")
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if match.Kind == MatchUser {
+				continue
+			}
+
+			next := append(path[:len(path):len(path)], dest)
+			if match.Rule == key {
+				if dest != key {
+					next = append(next, key) // reached through a wildcard
+				}
+				return next, nil
+			}
+			if visited[match.Rule] {
+				continue
+			}
+			visited[match.Rule] = true
+
+			// The copy a forwarding user keeps is delivered, not followed
+			var onward []string
+			for _, d := range splitDestinations(match.Destination) {
+				if match.Kind != MatchForward || !strings.EqualFold(d, match.Rule) {
+					onward = append(onward, d)
+				}
+			}
+			loop, err := walk(next, onward)
+			if err != nil || loop != nil {
+				return loop, err
+			}
+		}
+		return nil, nil
+	}
+
+	return walk([]string{key}, destinations)
+}
+
+// checkAliasLoop fails if the alias key, forwarding to destination, is
+// part of a forwarding loop
+func (db *DB) checkAliasLoop(key, destination string) error {
+	loop, err := db.findAliasLoop(key, splitDestinations(destination))
+	if err != nil {
+		return err
+	}
+	if loop != nil {
+		return errorf(ErrConflict, "forwarding loop: %s", strings.Join(loop, " → "))
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveAlias(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddAlternative("example.org", "example.com"),
+		db.AddUser("alice@example.com", testPassword, 0),
+		db.AddUser("carol@example.com", testPassword, 0),
+		db.SetForward("carol@example.com", "carol@example.net", true),
+		db.AddUser("sales-alice@example.com", testPassword, 0),
+		db.AddUser("dave@example.com", testPassword, 0),
+		db.UpdateUser("dave@example.com", UserUpdate{Enabled: Ptr(false)}),
+		db.AddAlias("info@example.com", "alice@example.com", ""),
+		db.AddAlias("sales-%@example.com", "sales@example.net", ""),
+		db.AddAlias("sales-eu-%@example.com", "eu@example.net", ""),
+		db.AddAlias("a_b@example.com", "ab@example.net", ""),
+		db.AddAlias("old@example.com", "old@example.net", ""),
+		db.UpdateAlias("old@example.com", AliasUpdate{Enabled: Ptr(false)}),
+		db.AddAlias("@example.com", "catchall@example.net", ""),
+	)
+
+	tests := []struct {
+		name      string
+		address   string
+		delimiter string
+		wantKind  string
+		wantRule  string
+		wantDest  string
+		wantKey   string
+		wantVia   string
+	}{
+		{name: "user", address: "alice@example.com", wantKind: MatchUser, wantRule: "alice@example.com", wantDest: "alice@example.com"},
+		{name: "forwarding user keeps a copy", address: "carol@example.com", wantKind: MatchForward, wantRule: "carol@example.com", wantDest: "carol@example.com,carol@example.net"},
+		{name: "exact alias", address: "info@example.com", wantKind: MatchAlias, wantRule: "info@example.com", wantDest: "alice@example.com"},
+		{name: "user before a wildcard", address: "sales-alice@example.com", wantKind: MatchUser, wantRule: "sales-alice@example.com", wantDest: "sales-alice@example.com"},
+		{name: "wildcard", address: "sales-us@example.com", wantKind: MatchWildcard, wantRule: "sales-%@example.com", wantDest: "sales@example.net"},
+		{name: "longest wildcard", address: "sales-eu-fr@example.com", wantKind: MatchWildcard, wantRule: "sales-eu-%@example.com", wantDest: "eu@example.net"},
+		{name: "underscore is literal", address: "axb@example.com", wantKind: MatchWildcard, wantRule: "%@example.com", wantDest: "catchall@example.net"},
+		{name: "literal underscore", address: "a_b@example.com", wantKind: MatchAlias, wantRule: "a_b@example.com", wantDest: "ab@example.net"},
+		{name: "catch-all", address: "nobody@example.com", wantKind: MatchWildcard, wantRule: "%@example.com", wantDest: "catchall@example.net"},
+		{name: "disabled user falls to the catch-all", address: "dave@example.com", wantKind: MatchWildcard, wantRule: "%@example.com", wantDest: "catchall@example.net"},
+		{name: "disabled alias falls to the catch-all", address: "old@example.com", wantKind: MatchWildcard, wantRule: "%@example.com", wantDest: "catchall@example.net"},
+		{
+			name: "extension reaches the user, not the catch-all", address: "alice+news@example.com", delimiter: "+",
+			wantKind: MatchUser, wantRule: "alice@example.com", wantDest: "alice@example.com", wantKey: "alice@example.com",
+		},
+		{
+			name: "extension without a delimiter", address: "alice+news@example.com",
+			wantKind: MatchWildcard, wantRule: "%@example.com", wantDest: "catchall@example.net",
+		},
+		{
+			name: "any of several delimiters", address: "info-desk@example.com", delimiter: "+-",
+			wantKind: MatchAlias, wantRule: "info@example.com", wantDest: "alice@example.com", wantKey: "info@example.com",
+		},
+		{
+			name: "extension matching a wildcard", address: "sales-us+x@example.com", delimiter: "+",
+			wantKind: MatchWildcard, wantRule: "sales-%@example.com", wantDest: "sales@example.net",
+		},
+		{
+			name: "alternative domain", address: "alice@example.org",
+			wantKind: MatchUser, wantRule: "alice@example.com", wantDest: "alice@example.com", wantKey: "alice@example.com", wantVia: "example.org",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := db.ResolveAlias(tt.address, tt.delimiter)
+			if err != nil {
+				t.Fatalf("ResolveAlias(%q): %v", tt.address, err)
+			}
+
+			wantKey := tt.wantKey
+			if wantKey == "" {
+				wantKey = tt.address
+			}
+			want := AliasMatch{Address: tt.address, Key: wantKey, Via: tt.wantVia, Kind: tt.wantKind, Rule: tt.wantRule, Destination: tt.wantDest}
+			if *match != want {
+				t.Errorf("ResolveAlias(%q) = %+v, want %+v", tt.address, *match, want)
+			}
+		})
+	}
+
+	t.Run("no match", func(t *testing.T) {
+		if _, err := db.ResolveAlias("alice@example.net", "+"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ResolveAlias = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestCheckAliasLoop(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddUser("alice@example.com", testPassword, 0),
+		db.AddUser("bob@example.com", testPassword, 0),
+		db.AddAlias("b@example.com", "a@example.com", ""),
+		db.AddAlias("info@example.com", "sales@example.com", ""),
+		db.AddAlias("sales@example.com", "alice@example.com", ""),
+		db.AddAlias("team-%@example.com", "team@example.com", ""),
+	)
+
+	// The cases share the database and run in order; a refused change is
+	// rolled back
+	tests := []struct {
+		name     string
+		change   func() error
+		wantLoop string
+	}{
+		{
+			name:   "mailbox and outside address",
+			change: func() error { return db.AddAlias("support@example.com", "alice@example.com,carol@example.net", "") },
+		},
+		{
+			name:     "direct loop",
+			change:   func() error { return db.AddAlias("a@example.com", "b@example.com", "") },
+			wantLoop: "a@example.com → b@example.com → a@example.com",
+		},
+		{
+			name: "new destination",
+			change: func() error {
+				return db.UpdateAlias("sales@example.com", AliasUpdate{Destination: Ptr("info@example.com")})
+			},
+			wantLoop: "sales@example.com → info@example.com → sales@example.com",
+		},
+		{
+			name: "added destination",
+			change: func() error {
+				return db.UpdateAlias("sales@example.com", AliasUpdate{AddDestinations: []string{"info@example.com"}})
+			},
+			wantLoop: "sales@example.com → info@example.com → sales@example.com",
+		},
+		{
+			name:     "through a wildcard",
+			change:   func() error { return db.AddAlias("team@example.com", "team-x@example.com", "") },
+			wantLoop: "team@example.com → team-x@example.com → team@example.com",
+		},
+		{
+			name:     "wildcard matching its own destination",
+			change:   func() error { return db.AddAlias("ops-%@example.com", "ops-1@example.com", "") },
+			wantLoop: "ops-%@example.com → ops-1@example.com → ops-%@example.com",
+		},
+		{
+			name:     "forward back through aliases",
+			change:   func() error { return db.SetForward("alice@example.com", "info@example.com", false) },
+			wantLoop: "alice@example.com → info@example.com → sales@example.com → alice@example.com",
+		},
+		{
+			name:   "forwarding user keeping a copy",
+			change: func() error { return db.SetForward("bob@example.com", "alice@example.com", true) },
+		},
+		{
+			name:   "alias to a user keeping a copy",
+			change: func() error { return db.AddAlias("desk@example.com", "bob@example.com", "") },
+		},
+		{
+			name:     "forward to a user keeping a copy",
+			change:   func() error { return db.SetForward("alice@example.com", "bob@example.com", true) },
+			wantLoop: "alice@example.com → bob@example.com → alice@example.com",
+		},
+		{
+			name: "disabled alias",
+			change: func() error {
+				return db.UpdateAlias("sales@example.com", AliasUpdate{Destination: Ptr("info@example.com"), Enabled: Ptr(false)})
+			},
+		},
+		{
+			name: "bulk import",
+			change: func() error {
+				_, err := db.Import(&Dataset{
+					Domains: []DomainRecord{{Name: "example.com"}},
+					Aliases: []AliasRecord{
+						{Email: "loop1@example.com", Destination: "loop2@example.com"},
+						{Email: "loop2@example.com", Destination: "loop1@example.com"},
+					},
+				})
+				return err
+			},
+			wantLoop: "loop1@example.com → loop2@example.com → loop1@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.change()
+			if tt.wantLoop == "" {
+				if err != nil {
+					t.Fatalf("change refused: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrConflict) || !strings.Contains(err.Error(), tt.wantLoop) {
+				t.Errorf("error = %v, want ErrConflict with %q", err, tt.wantLoop)
+			}
+		})
+	}
+
+	t.Run("refused changes are rolled back", func(t *testing.T) {
+		for _, email := range []string{"a@example.com", "loop1@example.com"} {
+			if _, err := db.GetAlias(email); !errors.Is(err, ErrNotFound) {
+				t.Errorf("GetAlias(%s) = %v, want ErrNotFound", email, err)
+			}
+		}
+		alice, err := db.GetUser("alice@example.com")
+		if err != nil {
+			t.Fatalf("GetUser: %v", err)
+		}
+		if alice.ForwardEnabled {
+			t.Errorf("alice forwards to %q after a refused forward", alice.ForwardDestination)
+		}
+	})
+}
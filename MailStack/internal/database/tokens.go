@@ -0,0 +1,220 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Token is an application password of a user, e.g. for a phone or a
+// scanner, that can be revoked on its own. Only a hash of the secret is
+// stored.
+type Token struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Comment   string    `json:"comment"`
+	IP        string    `json:"ip"` // comma-separated addresses and networks it may be used from, empty for any
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// tokenBytes is the length of a token secret before hex encoding
+const tokenBytes = 16
+
+// TokenHash returns how a token secret is stored. Secrets are random, so
+// an unsalted SHA-256 is enough and lets dovecot look a token up by
+// %{sha256:password}.
+func TokenHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeNets checks a comma-separated list of IP addresses and CIDR
+// networks, returning it in canonical form
+func NormalizeNets(nets string) (string, error) {
+	var normalized []string
+	for _, n := range strings.Split(nets, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if ip := net.ParseIP(n); ip != nil {
+			normalized = append(normalized, ip.String())
+			continue
+		}
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return "", errorf(ErrInvalid, "invalid address or network %q", n)
+		}
+		normalized = append(normalized, network.String())
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+// allowedFrom reports whether ip is in nets, a list from NormalizeNets;
+// an empty list allows any address
+func allowedFrom(nets, ip string) bool {
+	if nets == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range strings.Split(nets, ",") {
+		if !strings.Contains(n, "/") {
+			if allowed := net.ParseIP(n); allowed != nil && allowed.Equal(addr) {
+				return true
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(n); err == nil && network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateToken adds a token for a user, usable only from the addresses and
+// networks in ip when it is not empty. The secret is returned once and
+// cannot be retrieved later.
+func (db *DB) CreateToken(email, comment, ip string) (*Token, string, error) {
+	if err := db.authorizeUser(email); err != nil {
+		return nil, "", err
+	}
+
+	ip, err := NormalizeNets(ip)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(comment) > 255 {
+		return nil, "", errorf(ErrInvalid, "token comment cannot be longer than 255 characters")
+	}
+
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := hex.EncodeToString(raw)
+
+	token := Token{Email: email, Comment: comment, IP: ip}
+	err = db.Transaction(func(tx *DB) error {
+		var userID int64
+		err := tx.queryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return errorf(ErrNotFound, "user %s does not exist", email)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		var nets interface{}
+		if ip != "" {
+			nets = ip
+		}
+		if _, err := tx.exec("INSERT INTO tokens (user_id, secret_hash, comment, ip) VALUES (?, ?, ?, ?)",
+			userID, TokenHash(secret), comment, nets); err != nil {
+			return fmt.Errorf("failed to create token: %w", err)
+		}
+
+		// LastInsertId is not supported by every driver
+		err = tx.queryRow("SELECT id, created_at FROM tokens WHERE secret_hash = ?", TokenHash(secret)).
+			Scan(&token.ID, &token.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to get token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &token, secret, nil
+}
+
+// ListTokens returns the tokens of a user, or of every user the principal
+// may manage when email is empty
+func (db *DB) ListTokens(email string) ([]Token, error) {
+	query := `
+		SELECT t.id, u.email, COALESCE(t.comment, ''), COALESCE(t.ip, ''), t.created_at
+		FROM tokens t
+		JOIN users u ON u.id = t.user_id`
+	var args []interface{}
+	if email != "" {
+		if err := db.authorizeAddress(email); err != nil {
+			return nil, err
+		}
+		var exists bool
+		err := db.queryRow("SELECT COUNT(*) > 0 FROM users WHERE email = ?", email).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check user: %w", err)
+		}
+		if !exists {
+			return nil, errorf(ErrNotFound, "user %s does not exist", email)
+		}
+		query += " WHERE u.email = ?"
+		args = append(args, email)
+	}
+
+	rows, err := db.query(query+" ORDER BY u.email, t.id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		var t Token
+		if err := rows.Scan(&t.ID, &t.Email, &t.Comment, &t.IP, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		if db.principal.CanManage(domainOf(t.Email)) {
+			tokens = append(tokens, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// RevokeToken deletes a token of a user
+func (db *DB) RevokeToken(email string, id int64) error {
+	if err := db.authorizeUser(email); err != nil {
+		return err
+	}
+
+	result, err := db.exec(`DELETE FROM tokens
+		WHERE id = ? AND user_id IN (SELECT id FROM users WHERE email = ?)`, id, email)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	if affected == 0 {
+		return errorf(ErrNotFound, "%s has no token %d", email, id)
+	}
+	return nil
+}
+
+// checkToken reports whether secret is a token of the user that may be
+// used from ip
+func (db *DB) checkToken(email, secret, ip string) (bool, error) {
+	var nets sql.NullString
+	err := db.queryRow(`SELECT t.ip FROM tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE u.email = ? AND t.secret_hash = ?`, email, TokenHash(secret)).Scan(&nets)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check token: %w", err)
+	}
+	return allowedFrom(nets.String, ip), nil
+}
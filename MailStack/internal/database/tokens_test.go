@@ -0,0 +1,138 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNormalizeNets(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "", want: ""},
+		{in: " , ", want: ""},
+		{in: "192.0.2.1", want: "192.0.2.1"},
+		{in: "192.0.2.1, 198.51.100.0/24", want: "192.0.2.1,198.51.100.0/24"},
+		{in: "198.51.100.7/24", want: "198.51.100.0/24"},
+		{in: "2001:DB8:0:0::1", want: "2001:db8::1"},
+		{in: "2001:db8::/32", want: "2001:db8::/32"},
+		{in: "example.com", wantErr: true},
+		{in: "192.0.2.1/33", wantErr: true},
+		{in: "192.0.2.1,192.0.2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := NormalizeNets(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("NormalizeNets(%q) = %q, %v; want ErrInvalid", tt.in, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizeNets(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedFrom(t *testing.T) {
+	tests := []struct {
+		nets, ip string
+		want     bool
+	}{
+		{nets: "", ip: "203.0.113.9", want: true},
+		{nets: "", ip: "", want: true},
+		{nets: "192.0.2.1", ip: "192.0.2.1", want: true},
+		{nets: "192.0.2.1", ip: "192.0.2.2", want: false},
+		{nets: "192.0.2.1", ip: "::ffff:192.0.2.1", want: true},
+		{nets: "192.0.2.1,198.51.100.0/24", ip: "198.51.100.200", want: true},
+		{nets: "198.51.100.0/24", ip: "198.51.101.1", want: false},
+		{nets: "2001:db8::/32", ip: "2001:db8:1::5", want: true},
+		{nets: "2001:db8::/32", ip: "192.0.2.1", want: false},
+		{nets: "192.0.2.1", ip: "", want: false},
+		{nets: "192.0.2.1", ip: "not an address", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := allowedFrom(tt.nets, tt.ip); got != tt.want {
+			t.Errorf("allowedFrom(%q, %q) = %t, want %t", tt.nets, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	db := newTestDB(t)
+	mustRun(t,
+		db.AddDomain("example.com"),
+		db.AddUser("alice@example.com", testPassword, 0),
+		db.AddUser("bob@example.com", testPassword, 0),
+		db.UpdateUser("alice@example.com", UserUpdate{EnablePOP: Ptr(false)}),
+		db.UpdateUser("bob@example.com", UserUpdate{ForcePasswordChange: Ptr(true)}),
+	)
+
+	_, anywhere, err := db.CreateToken("alice@example.com", "phone", "")
+	mustRun(t, err)
+	_, office, err := db.CreateToken("alice@example.com", "scanner", "192.0.2.0/24, 2001:db8::1")
+	mustRun(t, err)
+	revokedToken, revoked, err := db.CreateToken("alice@example.com", "old laptop", "")
+	mustRun(t, err, db.RevokeToken("alice@example.com", revokedToken.ID))
+
+	tests := []struct {
+		name     string
+		email    string
+		secret   string
+		protocol string
+		ip       string
+		wantErr  error
+	}{
+		{name: "password still works", email: "alice@example.com", secret: testPassword, protocol: "imap", ip: "203.0.113.9"},
+		{name: "token from anywhere", email: "alice@example.com", secret: anywhere, protocol: "smtp", ip: "203.0.113.9"},
+		{name: "token from an allowed network", email: "alice@example.com", secret: office, protocol: "imap", ip: "192.0.2.77"},
+		{name: "token from an allowed address", email: "alice@example.com", secret: office, protocol: "imap", ip: "2001:db8::1"},
+		{name: "token from elsewhere", email: "alice@example.com", secret: office, protocol: "imap", ip: "203.0.113.9", wantErr: ErrPermission},
+		{name: "token without a client address", email: "alice@example.com", secret: office, protocol: "imap", ip: "", wantErr: ErrPermission},
+		{name: "revoked token", email: "alice@example.com", secret: revoked, protocol: "imap", ip: "203.0.113.9", wantErr: ErrPermission},
+		{name: "token of another user", email: "bob@example.com", secret: anywhere, protocol: "imap", ip: "203.0.113.9", wantErr: ErrPermission},
+		{name: "token for a disabled protocol", email: "alice@example.com", secret: anywhere, protocol: "pop3", ip: "203.0.113.9", wantErr: ErrPermission},
+		{name: "password flagged for a change", email: "bob@example.com", secret: testPassword, protocol: "imap", ip: "203.0.113.9"},
+		{name: "unknown user", email: "carol@example.com", secret: testPassword, protocol: "imap", ip: "203.0.113.9", wantErr: ErrPermission},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := db.Authenticate(tt.email, tt.secret, tt.protocol, tt.ip)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate = %q, %v; want %v", email, err, tt.wantErr)
+			}
+			if tt.wantErr == nil && email != tt.email {
+				t.Errorf("Authenticate = %q, want %q", email, tt.email)
+			}
+		})
+	}
+
+	t.Run("tokens go with their user", func(t *testing.T) {
+		mustRun(t, db.DeleteUser("alice@example.com", nil), db.AddUser("alice@example.com", testPassword, 0))
+		if _, err := db.Authenticate("alice@example.com", anywhere, "imap", "203.0.113.9"); !errors.Is(err, ErrPermission) {
+			t.Errorf("token of a deleted user = %v, want ErrPermission", err)
+		}
+	})
+}
+
+// A login for an unknown account must cost a full bcrypt check too
+func TestDummyHash(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyHash()))
+	if err != nil {
+		t.Fatalf("dummy hash is not bcrypt: %v", err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("dummy hash cost = %d, want %d", cost, bcrypt.DefaultCost)
+	}
+	if VerifyPassword(dummyHash(), testPassword) {
+		t.Error("dummy hash accepts a password")
+	}
+}
@@ -137,3 +137,59 @@ func Verify(domain, selector, pathTemplate string) (bool, error) {
 
 	return true, nil
 }
+
+// Remove deletes the DKIM keys of a domain for every selector and returns
+// the files removed
+func Remove(domain, pathTemplate string) ([]string, error) {
+	if domain == "" || strings.ContainsAny(domain, "/*?[\\") {
+		return nil, fmt.Errorf("invalid domain: %s", domain)
+	}
+
+	pattern := strings.ReplaceAll(pathTemplate, "{domain}", domain)
+	pattern = strings.ReplaceAll(pattern, "{selector}", "*")
+
+	keyPaths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DKIM keys: %w", err)
+	}
+
+	var removed []string
+	for _, keyPath := range keyPaths {
+		if err := os.Remove(keyPath); err != nil {
+			return removed, fmt.Errorf("failed to remove DKIM key %s: %w", keyPath, err)
+		}
+		removed = append(removed, keyPath)
+	}
+
+	return removed, nil
+}
+
+// Selectors returns the selectors that have a key for domain
+func Selectors(domain, pathTemplate string) ([]string, error) {
+	if domain == "" || strings.ContainsAny(domain, "/*?[\\") {
+		return nil, fmt.Errorf("invalid domain: %s", domain)
+	}
+
+	pattern := strings.ReplaceAll(pathTemplate, "{domain}", domain)
+	prefix, suffix, found := strings.Cut(pattern, "{selector}")
+	if !found {
+		return nil, fmt.Errorf("DKIM path %s has no {selector} placeholder", pathTemplate)
+	}
+
+	keyPaths, err := filepath.Glob(prefix + "*" + suffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DKIM keys: %w", err)
+	}
+
+	var selectors []string
+	for _, keyPath := range keyPaths {
+		selectors = append(selectors, strings.TrimSuffix(strings.TrimPrefix(keyPath, prefix), suffix))
+	}
+	return selectors, nil
+}
+
+// KeyPath returns where the key of domain and selector is stored
+func KeyPath(domain, selector, pathTemplate string) string {
+	keyPath := strings.ReplaceAll(pathTemplate, "{domain}", domain)
+	return strings.ReplaceAll(keyPath, "{selector}", selector)
+}
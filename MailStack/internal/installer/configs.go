@@ -0,0 +1,315 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/backup"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/system"
+	"github.com/mailstack/mailstack/internal/templates"
+)
+
+// renderedFile is a manifest target together with its rendered content
+type renderedFile struct {
+	templates.Target
+	content []byte
+	source  *templates.Source
+}
+
+// RegenerateResult summarizes what a configuration regeneration touched
+type RegenerateResult struct {
+	Backup   string   // backup generation holding the previous files, if any
+	Changed  []string // files whose content changed
+	Reloaded []string // services reloaded because of those changes
+	Skipped  []string // services not checked because their checker is not installed
+}
+
+// stageConfigs renders every target into a temporary staging directory and
+// runs the pre-flight checks on it, so that a template error or a config
+// rejected by its daemon is reported before any installed file is touched.
+// It also returns the services whose check was skipped.
+func (i *Installer) stageConfigs(targets []templates.Target) ([]renderedFile, []string, error) {
+	stagingDir, err := os.MkdirTemp("", "mailstack-staging-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	staged, err := templates.NewRenderer(i.config).Stage(targets, stagingDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := i.Preflight(staged, stagingDir)
+	if err := checkFailures(results); err != nil {
+		return nil, nil, err
+	}
+
+	var files []renderedFile
+	for _, file := range staged {
+		content, err := os.ReadFile(file.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read staged file %s: %w", file.Path, err)
+		}
+		files = append(files, renderedFile{Target: file.Target, content: content, source: file.Source})
+	}
+
+	return files, skippedChecks(results), nil
+}
+
+// writeConfigs atomically writes the files whose content changed. The
+// previous versions are saved in a new backup generation first; if any
+// write fails, the files already written are restored from it.
+func (i *Installer) writeConfigs(files []renderedFile) (*RegenerateResult, error) {
+	gen, err := backup.Begin(i.config.Paths.Backups)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RegenerateResult{}
+	for _, file := range files {
+		current, err := os.ReadFile(file.Output)
+		if err == nil && bytes.Equal(current, file.content) {
+			continue
+		}
+
+		if i.verbose {
+			fmt.Fprintf(i.out, "    %s\n", file.Output)
+		}
+
+		err = gen.Save(file.Output)
+		if err == nil {
+			err = system.WriteFile(file.Output, file.content, templates.FileMode(file.Output))
+		}
+		if err != nil {
+			gen.Close()
+			if _, restoreErr := backup.Restore(i.config.Paths.Backups, gen.Timestamp); restoreErr != nil {
+				return nil, fmt.Errorf("%w (restoring backup %s also failed: %v)", err, gen.Timestamp, restoreErr)
+			}
+			return nil, fmt.Errorf("%w (previous files restored from backup %s)", err, gen.Timestamp)
+		}
+
+		result.Changed = append(result.Changed, file.Output)
+	}
+
+	if err := gen.Close(); err != nil {
+		return nil, err
+	}
+	if len(result.Changed) > 0 {
+		result.Backup = gen.Timestamp
+	}
+
+	// Record where every installed file came from
+	sources := make(map[string]*templates.Source)
+	for _, file := range files {
+		sources[file.Output] = file.source
+	}
+	if err := templates.SaveSources(templates.SourcesPath(i.config), sources); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Regenerate re-renders every enabled template, validates the result,
+// rebuilds the postfix LMDB maps and reloads only the services whose files
+// changed
+func (i *Installer) Regenerate() (*RegenerateResult, error) {
+	targets := templates.Manifest(i.config)
+
+	files, skipped, err := i.stageConfigs(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := i.writeConfigs(files)
+	if err != nil {
+		return nil, err
+	}
+	result.Skipped = skipped
+
+	// Rebuild LMDB maps so hand-edited sources are picked up
+	for _, mapFile := range templates.PostfixMaps(i.config) {
+		if _, err := os.Stat(mapFile); err != nil {
+			continue
+		}
+		if err := postmap(mapFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if templates.WebmailEnabled(i.config) {
+		if err := enableWebmailSite(); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Reloaded, err = i.reloadServices(targets, result.Changed)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Rollback restores a backup generation of configuration files and reloads
+// the affected services. An empty timestamp selects the latest generation.
+func (i *Installer) Rollback(timestamp string) (*RegenerateResult, error) {
+	if timestamp == "" {
+		generations, err := backup.List(i.config.Paths.Backups)
+		if err != nil {
+			return nil, err
+		}
+		if len(generations) == 0 {
+			return nil, fmt.Errorf("no configuration backups found in %s", i.config.Paths.Backups)
+		}
+		timestamp = generations[len(generations)-1]
+	}
+
+	entries, err := backup.Restore(i.config.Paths.Backups, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RegenerateResult{Backup: timestamp}
+	for _, entry := range entries {
+		result.Changed = append(result.Changed, entry.Path)
+	}
+
+	result.Reloaded, err = i.reloadServices(templates.Manifest(i.config), result.Changed)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// reloadServices reloads, once each, the services owning the changed files
+func (i *Installer) reloadServices(targets []templates.Target, changed []string) ([]string, error) {
+	changedSet := make(map[string]bool)
+	for _, path := range changed {
+		changedSet[path] = true
+	}
+
+	seen := make(map[string]bool)
+	var reloaded []string
+	for _, target := range targets {
+		if !changedSet[target.Output] || target.Service == "" || seen[target.Service] {
+			continue
+		}
+		seen[target.Service] = true
+
+		if i.verbose {
+			fmt.Fprintf(i.out, "  Reloading %s...\n", target.Service)
+		}
+		if err := system.ReloadService(target.Service); err != nil {
+			return reloaded, err
+		}
+		reloaded = append(reloaded, target.Service)
+	}
+
+	return reloaded, nil
+}
+
+// Plan renders every enabled template into stagingDir without touching the
+// installed files, reporting which of them would change
+func (i *Installer) Plan(stagingDir string) ([]templates.StagedFile, error) {
+	renderer := templates.NewRenderer(i.config)
+	return renderer.Stage(templates.Manifest(i.config), stagingDir)
+}
+
+// WriteTransportMap rewrites the postfix transport table from the relay
+// domains and compiles it. Relay domains without a nexthop are left out,
+// so postfix delivers them to their MX hosts. If postmap fails, the
+// previous table and its compiled form are put back.
+func (i *Installer) WriteTransportMap(relays []database.Relay) (err error) {
+	var b strings.Builder
+	b.WriteString("# Generated by mailstack from its relay domains, do not edit:\n")
+	b.WriteString("# changes are overwritten by \"mailstack relay\"\n")
+	for _, relay := range relays {
+		if relay.Nexthop == "" {
+			fmt.Fprintf(&b, "# %s is delivered to its MX hosts\n", relay.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", relay.Name, relay.Nexthop)
+	}
+
+	saved, err := saveFiles(templates.TransportMap, templates.TransportMap+".lmdb")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if restoreErr := restoreFiles(saved); restoreErr != nil {
+			err = fmt.Errorf("%w; restoring the previous transport map also failed: %v", err, restoreErr)
+		}
+	}()
+
+	if err := system.WriteFile(templates.TransportMap, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return postmap(templates.TransportMap)
+}
+
+// savedFile is the content of a file before it is rewritten; content is
+// nil when the file did not exist
+type savedFile struct {
+	path    string
+	content []byte
+}
+
+// saveFiles reads paths so restoreFiles can put them back
+func saveFiles(paths ...string) ([]savedFile, error) {
+	saved := make([]savedFile, 0, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		saved = append(saved, savedFile{path: path, content: content})
+	}
+	return saved, nil
+}
+
+// restoreFiles writes back the files saveFiles read, removing the ones
+// that did not exist then
+func restoreFiles(saved []savedFile) error {
+	for _, file := range saved {
+		if file.content == nil {
+			if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file.path, err)
+			}
+			continue
+		}
+		if err := system.WriteFile(file.path, file.content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postmap compiles a postfix lookup table source into its LMDB form
+func postmap(mapFile string) error {
+	cmd := exec.Command("postmap", "lmdb:"+mapFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run postmap on %s: %w\nOutput: %s", mapFile, err, output)
+	}
+	return nil
+}
+
+// enableWebmailSite links the webmail nginx site into sites-enabled
+func enableWebmailSite() error {
+	webmailLink := "/etc/nginx/sites-enabled/webmail.conf"
+	if _, err := os.Lstat(webmailLink); os.IsNotExist(err) {
+		if err := os.Symlink("/etc/nginx/sites-available/webmail.conf", webmailLink); err != nil {
+			return fmt.Errorf("failed to enable webmail site: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveRestoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "transport.map")
+	missing := filepath.Join(dir, "transport.map.lmdb")
+	if err := os.WriteFile(existing, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := saveFiles(existing, missing)
+	if err != nil {
+		t.Fatalf("saveFiles: %v", err)
+	}
+
+	// A failed update rewrote one file and created the other
+	for _, path := range []string{existing, missing} {
+		if err := os.WriteFile(path, []byte("new\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := restoreFiles(saved); err != nil {
+		t.Fatalf("restoreFiles: %v", err)
+	}
+
+	if content, err := os.ReadFile(existing); err != nil || string(content) != "old\n" {
+		t.Errorf("%s = %q, %v; want the old content", existing, content, err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("%s was not removed: %v", missing, err)
+	}
+
+	// Restoring again finds nothing left to remove
+	if err := restoreFiles(saved); err != nil {
+		t.Errorf("second restoreFiles: %v", err)
+	}
+}
+
+func TestSaveFilesEmpty(t *testing.T) {
+	// An empty file is kept as empty, not taken for a missing one
+	path := filepath.Join(t.TempDir(), "transport.map")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := saveFiles(path)
+	if err != nil {
+		t.Fatalf("saveFiles: %v", err)
+	}
+	if err := restoreFiles(saved); err != nil {
+		t.Fatalf("restoreFiles: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("empty file was removed: %v", err)
+	}
+}
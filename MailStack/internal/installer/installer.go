@@ -2,6 +2,7 @@ package installer
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
 	"github.com/mailstack/mailstack/internal/osdetect"
 	"github.com/mailstack/mailstack/internal/packages"
 	"github.com/mailstack/mailstack/internal/system"
@@ -19,6 +21,7 @@ import (
 type Installer struct {
 	config  *config.Config
 	verbose bool
+	out     io.Writer
 	osInfo  *osdetect.OSInfo
 	pkgMgr  *packages.Manager
 }
@@ -28,9 +31,15 @@ func New(cfg *config.Config, verbose bool) *Installer {
 	return &Installer{
 		config:  cfg,
 		verbose: verbose,
+		out:     os.Stdout,
 	}
 }
 
+// SetOutput sends progress messages to w instead of stdout
+func (i *Installer) SetOutput(w io.Writer) {
+	i.out = w
+}
+
 // Install performs the complete installation
 func (i *Installer) Install(force bool) error {
 	steps := []struct {
@@ -54,9 +63,9 @@ func (i *Installer) Install(force bool) error {
 
 	for idx, step := range steps {
 		if i.verbose {
-			fmt.Printf("[%d/%d] %s...\n", idx+1, len(steps), step.name)
+			fmt.Fprintf(i.out, "[%d/%d] %s...\n", idx+1, len(steps), step.name)
 		} else {
-			fmt.Printf("⏳ %s...\n", step.name)
+			fmt.Fprintf(i.out, "⏳ %s...\n", step.name)
 		}
 
 		if err := step.fn(); err != nil {
@@ -64,7 +73,7 @@ func (i *Installer) Install(force bool) error {
 		}
 
 		if !i.verbose {
-			fmt.Printf("✅ %s\n", step.name)
+			fmt.Fprintf(i.out, "✅ %s\n", step.name)
 		}
 	}
 
@@ -77,16 +86,15 @@ func (i *Installer) Update() error {
 		return err
 	}
 
-	fmt.Println("Updating package lists...")
+	fmt.Fprintln(i.out, "Updating package lists...")
 	if err := i.pkgMgr.Update(); err != nil {
 		return fmt.Errorf("failed to update package lists: %w", err)
 	}
 
-	fmt.Println("Upgrading packages...")
+	fmt.Fprintln(i.out, "Upgrading packages...")
 	requiredPkgs := packages.GetRequiredPackages(i.osInfo.Type)
-	webmailEnabled := (i.config.Webmail != "none" && i.config.Services.Webmail != "" && i.config.Services.Webmail != "none")
 	optionalPkgs := packages.GetOptionalPackages(i.osInfo.Type,
-		i.config.Services.Antivirus, webmailEnabled)
+		i.config.Services.Antivirus, templates.WebmailEnabled(i.config))
 
 	allPkgs := append(requiredPkgs, optionalPkgs...)
 
@@ -94,6 +102,21 @@ func (i *Installer) Update() error {
 		return fmt.Errorf("failed to upgrade packages: %w", err)
 	}
 
+	fmt.Fprintln(i.out, "Running database migrations...")
+	db, err := database.Connect(i.config.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	applied, err := db.Migrate()
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if i.verbose {
+		fmt.Fprintf(i.out, "  %d migrations applied\n", applied)
+	}
+
 	return nil
 }
 
@@ -111,7 +134,7 @@ func (i *Installer) detectOS() error {
 	i.pkgMgr = packages.NewManager(osInfo)
 
 	if i.verbose {
-		fmt.Printf("Detected: %s\n", osInfo.String())
+		fmt.Fprintf(i.out, "Detected: %s\n", osInfo.String())
 	}
 
 	return nil
@@ -134,7 +157,7 @@ func (i *Installer) checkPrerequisites() error {
 func (i *Installer) installPackages() error {
 	// Update package lists first
 	if i.verbose {
-		fmt.Println("  Updating package lists...")
+		fmt.Fprintln(i.out, "  Updating package lists...")
 	}
 	if err := i.pkgMgr.Update(); err != nil {
 		return fmt.Errorf("failed to update packages: %w", err)
@@ -144,7 +167,7 @@ func (i *Installer) installPackages() error {
 	requiredPkgs := packages.GetRequiredPackages(i.osInfo.Type)
 
 	if i.verbose {
-		fmt.Printf("  Installing %d required packages...\n", len(requiredPkgs))
+		fmt.Fprintf(i.out, "  Installing %d required packages...\n", len(requiredPkgs))
 	}
 
 	// Filter out already installed packages
@@ -153,7 +176,7 @@ func (i *Installer) installPackages() error {
 		if !i.pkgMgr.IsInstalled(pkg) {
 			toInstall = append(toInstall, pkg)
 		} else if i.verbose {
-			fmt.Printf("  ✓ %s (already installed)\n", pkg)
+			fmt.Fprintf(i.out, "  ✓ %s (already installed)\n", pkg)
 		}
 	}
 
@@ -164,13 +187,12 @@ func (i *Installer) installPackages() error {
 	}
 
 	// Install optional packages
-	webmailEnabled := (i.config.Webmail != "none" && i.config.Services.Webmail != "" && i.config.Services.Webmail != "none")
 	optionalPkgs := packages.GetOptionalPackages(i.osInfo.Type,
-		i.config.Services.Antivirus, webmailEnabled)
+		i.config.Services.Antivirus, templates.WebmailEnabled(i.config))
 
 	if len(optionalPkgs) > 0 {
 		if i.verbose {
-			fmt.Printf("  Installing %d optional packages...\n", len(optionalPkgs))
+			fmt.Fprintf(i.out, "  Installing %d optional packages...\n", len(optionalPkgs))
 		}
 
 		var toInstallOptional []string
@@ -182,7 +204,7 @@ func (i *Installer) installPackages() error {
 
 		if len(toInstallOptional) > 0 {
 			if err := i.pkgMgr.Install(toInstallOptional); err != nil {
-				fmt.Printf("  Warning: failed to install optional packages: %v\n", err)
+				fmt.Fprintf(i.out, "  Warning: failed to install optional packages: %v\n", err)
 			}
 		}
 	}
@@ -203,7 +225,7 @@ func (i *Installer) createSystemUsers() error {
 
 	for _, u := range users {
 		if i.verbose {
-			fmt.Printf("  Creating user: %s\n", u.name)
+			fmt.Fprintf(i.out, "  Creating user: %s\n", u.name)
 		}
 		if err := system.CreateUser(u.name, u.home, u.shell); err != nil {
 			return err
@@ -237,7 +259,7 @@ func (i *Installer) createDirectories() error {
 
 	for _, d := range dirs {
 		if i.verbose {
-			fmt.Printf("  Creating directory: %s\n", d.path)
+			fmt.Fprintf(i.out, "  Creating directory: %s\n", d.path)
 		}
 		if err := system.CreateDirectory(d.path, d.owner, d.mode); err != nil {
 			return err
@@ -248,132 +270,12 @@ func (i *Installer) createDirectories() error {
 }
 
 func (i *Installer) generateConfigs() error {
-	renderer := templates.NewRenderer(i.config)
-
-	// Generate Postfix configs
-	if i.verbose {
-		fmt.Println("  Generating Postfix configuration...")
-	}
-	postfixConfigs := map[string]string{
-		"templates/postfix/main.cf":                           "/etc/postfix/main.cf",
-		"templates/postfix/master.cf":                         "/etc/postfix/master.cf",
-		"templates/postfix/sasl_passwd":                       "/etc/postfix/sasl_passwd",
-		"templates/postfix/outclean_header_filter.cf":         "/etc/postfix/outclean_header_filter.cf",
-		"templates/postfix/mta-sts-daemon.yml":                "/etc/mta-sts-daemon.yml",
-		"templates/postfix/logrotate.conf":                    "/etc/logrotate.d/postfix",
-		"templates/postfix/sqlite-virtual-mailbox-domains.cf": "/etc/postfix/sqlite-virtual-mailbox-domains.cf",
-		"templates/postfix/sqlite-virtual-mailbox-maps.cf":    "/etc/postfix/sqlite-virtual-mailbox-maps.cf",
-		"templates/postfix/sqlite-virtual-alias-maps.cf":      "/etc/postfix/sqlite-virtual-alias-maps.cf",
-		"templates/postfix/sqlite-sender-login-maps.cf":       "/etc/postfix/sqlite-sender-login-maps.cf",
-	}
-
-	for template, output := range postfixConfigs {
-		if i.verbose {
-			fmt.Printf("    %s\n", output)
-		}
-		if err := renderer.RenderToFile(template, output); err != nil {
-			return fmt.Errorf("failed to render %s: %w", template, err)
-		}
-	}
-
-	// Create empty database maps that Postfix needs
-	emptyMaps := []string{
-		filepath.Join(i.config.Paths.Data, "virtual_alias_maps"),
-		filepath.Join(i.config.Paths.Data, "virtual_domains"),
-		filepath.Join(i.config.Paths.Data, "virtual_mailbox_maps"),
-		filepath.Join(i.config.Paths.Data, "sender_canonical_maps"),
-		filepath.Join(i.config.Paths.Data, "recipient_canonical_maps"),
-		filepath.Join(i.config.Paths.Data, "sender_login_maps"),
-		"/etc/postfix/transport.map",
-		"/etc/postfix/tls_policy.map",
-	}
-
-	for _, mapFile := range emptyMaps {
-		if _, err := os.Stat(mapFile); os.IsNotExist(err) {
-			if err := os.WriteFile(mapFile, []byte{}, 0644); err != nil {
-				return fmt.Errorf("failed to create map file %s: %w", mapFile, err)
-			}
-			cmd := exec.Command("postmap", "lmdb:"+mapFile)
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("failed to run postmap on %s: %w", mapFile, err)
-			}
-		}
-	}
-
-	// Generate Dovecot configs
-	if i.verbose {
-		fmt.Println("  Generating Dovecot configuration...")
-	}
-	dovecotConfigs := map[string]string{
-		"templates/dovecot/dovecot.conf":         "/etc/dovecot/dovecot.conf",
-		"templates/dovecot/auth.conf":            "/etc/dovecot/conf.d/auth.conf",
-		"templates/dovecot/dovecot-sql.conf.ext": "/etc/dovecot/dovecot-sql.conf.ext",
-		"templates/dovecot/report-spam.sieve":    "/etc/dovecot/report-spam.sieve",
-		"templates/dovecot/report-ham.sieve":     "/etc/dovecot/report-ham.sieve",
-		"templates/dovecot/spam.script":          "/etc/dovecot/spam.script",
-		"templates/dovecot/ham.script":           "/etc/dovecot/ham.script",
-	}
-
-	for template, output := range dovecotConfigs {
-		if i.verbose {
-			fmt.Printf("    %s\n", output)
-		}
-		if err := renderer.RenderToFile(template, output); err != nil {
-			return fmt.Errorf("failed to render %s: %w", template, err)
-		}
-	}
-
-	// Generate Rspamd configs
-	if i.verbose {
-		fmt.Println("  Generating Rspamd configuration...")
-	}
-	rspamdConfigs := map[string]string{
-		"templates/rspamd/antivirus.conf":               "/etc/rspamd/local.d/antivirus.conf",
-		"templates/rspamd/arc.conf":                     "/etc/rspamd/local.d/arc.conf",
-		"templates/rspamd/classifier-bayes.conf":        "/etc/rspamd/local.d/classifier-bayes.conf",
-		"templates/rspamd/composites.conf":              "/etc/rspamd/local.d/composites.conf",
-		"templates/rspamd/dkim_signing.conf":            "/etc/rspamd/local.d/dkim_signing.conf",
-		"templates/rspamd/external_services.conf":       "/etc/rspamd/local.d/external_services.conf",
-		"templates/rspamd/external_services_group.conf": "/etc/rspamd/local.d/external_services_group.conf",
-		"templates/rspamd/forbidden_file_extension.map": "/etc/rspamd/local.d/forbidden_file_extension.map",
-		"templates/rspamd/force_actions.conf":           "/etc/rspamd/local.d/force_actions.conf",
-		"templates/rspamd/fuzzy_check.conf":             "/etc/rspamd/local.d/fuzzy_check.conf",
-		"templates/rspamd/headers_group.conf":           "/etc/rspamd/local.d/headers_group.conf",
-		"templates/rspamd/history_redis.conf":           "/etc/rspamd/local.d/history_redis.conf",
-		"templates/rspamd/local_subnet.map":             "/etc/rspamd/local.d/local_subnet.map",
-		"templates/rspamd/metrics.conf":                 "/etc/rspamd/local.d/metrics.conf",
-		"templates/rspamd/milter_headers.conf":          "/etc/rspamd/local.d/milter_headers.conf",
-		"templates/rspamd/multimap.conf":                "/etc/rspamd/local.d/multimap.conf",
-		"templates/rspamd/redis.conf":                   "/etc/rspamd/local.d/redis.conf",
-		"templates/rspamd/whitelist.conf":               "/etc/rspamd/local.d/whitelist.conf",
-		"templates/rspamd/options.inc":                  "/etc/rspamd/local.d/options.inc",
-		"templates/rspamd/logging.inc":                  "/etc/rspamd/local.d/logging.inc",
-		"templates/rspamd/worker-controller.inc":        "/etc/rspamd/local.d/worker-controller.inc",
-		"templates/rspamd/worker-fuzzy.inc":             "/etc/rspamd/local.d/worker-fuzzy.inc",
-		"templates/rspamd/worker-normal.inc":            "/etc/rspamd/local.d/worker-normal.inc",
-		"templates/rspamd/worker-proxy.inc":             "/etc/rspamd/local.d/worker-proxy.inc",
-	}
-
-	for template, output := range rspamdConfigs {
-		if i.verbose {
-			fmt.Printf("    %s\n", output)
-		}
-		if err := renderer.RenderToFile(template, output); err != nil {
-			return fmt.Errorf("failed to render %s: %w", template, err)
-		}
-	}
-
-	// Generate Nginx configs
-	if i.verbose {
-		fmt.Println("  Generating Nginx configuration...")
-	}
-
-	// Copy dhparam.pem (it's not a template, just a static file)
+	// Generate dhparam.pem for nginx (it's not a template, just a static file)
 	dhparamSrc := filepath.Join(i.config.Paths.Data, "dhparam.pem")
 	if _, err := os.Stat(dhparamSrc); os.IsNotExist(err) {
 		// Generate dhparam if not exists (this takes a while)
 		if i.verbose {
-			fmt.Println("    Generating DH parameters (this may take several minutes)...")
+			fmt.Fprintln(i.out, "  Generating DH parameters (this may take several minutes)...")
 		}
 		cmd := exec.Command("openssl", "dhparam", "-out", dhparamSrc, "2048")
 		if err := cmd.Run(); err != nil {
@@ -381,83 +283,37 @@ func (i *Installer) generateConfigs() error {
 		}
 	}
 
-	nginxConfigs := map[string]string{
-		"templates/nginx/nginx.conf": "/etc/nginx/nginx.conf",
-		"templates/nginx/proxy.conf": "/etc/nginx/proxy.conf",
-		"templates/nginx/tls.conf":   "/etc/nginx/tls.conf",
+	files, skipped, err := i.stageConfigs(templates.Manifest(i.config))
+	if err != nil {
+		return err
 	}
-
-	for template, output := range nginxConfigs {
-		if i.verbose {
-			fmt.Printf("    %s\n", output)
-		}
-		if err := renderer.RenderToFile(template, output); err != nil {
-			return fmt.Errorf("failed to render %s: %w", template, err)
-		}
+	for _, service := range skipped {
+		fmt.Fprintf(i.out, "  ⏭️  %s configuration check skipped (checker not installed)\n", service)
+	}
+	if _, err := i.writeConfigs(files); err != nil {
+		return err
 	}
 
-	// Generate Webmail configs if enabled
-	if i.config.Webmail != "none" && i.config.Services.Webmail != "" && i.config.Services.Webmail != "none" {
-		if i.verbose {
-			fmt.Printf("  Generating Webmail configuration (%s)...\n", i.config.Webmail)
-		}
-
-		webmailConfigs := map[string]string{
-			"templates/webmails/nginx-webmail.conf":  "/etc/nginx/sites-available/webmail.conf",
-			"templates/webmails/php-webmail.conf":    "/etc/php/8.1/fpm/pool.d/webmail.conf",
-			"templates/webmails/php.ini":             "/etc/php/8.1/fpm/conf.d/99-mailstack.ini",
-			"templates/webmails/snuffleupagus.rules": "/etc/snuffleupagus.rules",
-		}
-
-		for template, output := range webmailConfigs {
-			if i.verbose {
-				fmt.Printf("    %s\n", output)
-			}
-			if err := renderer.RenderToFile(template, output); err != nil {
-				return fmt.Errorf("failed to render %s: %w", template, err)
-			}
-		}
-
-		// Generate webmail-specific configs
-		if i.config.Webmail == "roundcube" {
-			roundcubeConfigs := map[string]string{
-				"templates/webmails/roundcube/config.inc.php":         "/var/www/roundcube/config/config.inc.php",
-				"templates/webmails/roundcube/config.inc.carddav.php": "/var/www/roundcube/config/config.inc.carddav.php",
-			}
-			for template, output := range roundcubeConfigs {
-				if i.verbose {
-					fmt.Printf("    %s\n", output)
-				}
-				if err := renderer.RenderToFile(template, output); err != nil {
-					return fmt.Errorf("failed to render %s: %w", template, err)
-				}
-			}
-		} else if i.config.Webmail == "snappymail" {
-			snappymailConfigs := map[string]string{
-				"templates/webmails/snappymail/application.ini": "/var/www/snappymail/data/_data_/_default_/configs/application.ini",
-				"templates/webmails/snappymail/default.json":    "/var/www/snappymail/data/_data_/_default_/domains/default.json",
+	// Create empty database maps that Postfix needs
+	for _, mapFile := range templates.PostfixMaps(i.config) {
+		if _, err := os.Stat(mapFile); os.IsNotExist(err) {
+			if err := os.WriteFile(mapFile, []byte{}, 0644); err != nil {
+				return fmt.Errorf("failed to create map file %s: %w", mapFile, err)
 			}
-			for template, output := range snappymailConfigs {
-				if i.verbose {
-					fmt.Printf("    %s\n", output)
-				}
-				if err := renderer.RenderToFile(template, output); err != nil {
-					return fmt.Errorf("failed to render %s: %w", template, err)
-				}
+			if err := postmap(mapFile); err != nil {
+				return err
 			}
 		}
+	}
 
-		// Enable webmail nginx site
-		webmailLink := "/etc/nginx/sites-enabled/webmail.conf"
-		if _, err := os.Stat(webmailLink); os.IsNotExist(err) {
-			if err := os.Symlink("/etc/nginx/sites-available/webmail.conf", webmailLink); err != nil {
-				return fmt.Errorf("failed to enable webmail site: %w", err)
-			}
+	if templates.WebmailEnabled(i.config) {
+		if err := enableWebmailSite(); err != nil {
+			return err
 		}
 	}
 
 	if i.verbose {
-		fmt.Println("  ✓ All configuration files generated")
+		fmt.Fprintln(i.out, "  ✓ All configuration files generated")
 	}
 
 	return nil
@@ -465,7 +321,7 @@ func (i *Installer) generateConfigs() error {
 
 func (i *Installer) initDatabase() error {
 	if i.verbose {
-		fmt.Println("Initializing database...")
+		fmt.Fprintln(i.out, "Initializing database...")
 	}
 
 	// Determine database type from config
@@ -483,7 +339,7 @@ func (i *Installer) initDatabase() error {
 		return i.initPostgreSQLDatabase()
 	default:
 		if i.verbose {
-			fmt.Printf("  Unknown database type '%s', using SQLite\n", dbType)
+			fmt.Fprintf(i.out, "  Unknown database type '%s', using SQLite\n", dbType)
 		}
 		return i.initSQLiteDatabase()
 	}
@@ -491,74 +347,13 @@ func (i *Installer) initDatabase() error {
 
 func (i *Installer) initSQLiteDatabase() error {
 	if i.verbose {
-		fmt.Println("  Setting up SQLite database...")
-	}
-
-	dbPath := filepath.Join(i.config.Paths.Data, "mailstack.db")
-
-	// Create database schema
-	schema := `
--- Users table
-CREATE TABLE IF NOT EXISTS users (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    email VARCHAR(255) UNIQUE NOT NULL,
-    password_hash VARCHAR(255) NOT NULL,
-    display_name VARCHAR(255),
-    quota_bytes BIGINT DEFAULT 0,
-    enabled BOOLEAN DEFAULT 1,
-    global_admin BOOLEAN DEFAULT 0,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
-
--- Domains table
-CREATE TABLE IF NOT EXISTS domains (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name VARCHAR(255) UNIQUE NOT NULL,
-    max_users INTEGER DEFAULT 0,
-    max_aliases INTEGER DEFAULT 0,
-    max_quota_bytes BIGINT DEFAULT 0,
-    enabled BOOLEAN DEFAULT 1,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
-
--- Aliases table
-CREATE TABLE IF NOT EXISTS aliases (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    email VARCHAR(255) UNIQUE NOT NULL,
-    destination TEXT NOT NULL,
-    wildcard BOOLEAN DEFAULT 0,
-    enabled BOOLEAN DEFAULT 1,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
-
--- Domain admins table
-CREATE TABLE IF NOT EXISTS domain_admins (
-    user_id INTEGER,
-    domain_id INTEGER,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    FOREIGN KEY (domain_id) REFERENCES domains(id) ON DELETE CASCADE,
-    PRIMARY KEY (user_id, domain_id)
-);
-
--- Create indexes
-CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-CREATE INDEX IF NOT EXISTS idx_domains_name ON domains(name);
-CREATE INDEX IF NOT EXISTS idx_aliases_email ON aliases(email);
-`
-
-	// Write schema to temp file
-	schemaFile := filepath.Join(i.config.Paths.Data, "schema.sql")
-	if err := os.WriteFile(schemaFile, []byte(schema), 0644); err != nil {
-		return fmt.Errorf("failed to write schema file: %w", err)
+		fmt.Fprintln(i.out, "  Setting up SQLite database...")
 	}
 
-	// Initialize database with schema
-	cmd := exec.Command("sqlite3", dbPath)
-	cmd.Stdin = strings.NewReader(schema)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to initialize SQLite database: %w\nOutput: %s", err, output)
+	dbPath := i.config.DatabasePath()
+
+	if err := i.createSchema(); err != nil {
+		return err
 	}
 
 	// Set proper permissions
@@ -570,56 +365,64 @@ CREATE INDEX IF NOT EXISTS idx_aliases_email ON aliases(email);
 	// For now, just ensure it's readable by the mail group
 	os.Chown(dbPath, 0, 0) // root:root for now
 
+	return nil
+}
+
+func (i *Installer) initMySQLDatabase() error {
 	if i.verbose {
-		fmt.Printf("  ✓ SQLite database initialized: %s\n", dbPath)
+		fmt.Fprintln(i.out, "  Setting up MySQL/MariaDB database...")
+		fmt.Fprintln(i.out, "  Note: the database and user must already exist, e.g.:")
+		fmt.Fprintf(i.out, "    CREATE DATABASE %s;\n", i.config.Database.Name)
+		fmt.Fprintf(i.out, "    CREATE USER '%s'@'localhost' IDENTIFIED BY '...';\n", i.config.Database.User)
+		fmt.Fprintf(i.out, "    GRANT ALL PRIVILEGES ON %s.* TO '%s'@'localhost';\n", i.config.Database.Name, i.config.Database.User)
 	}
 
-	// Insert default domain
-	insertDomain := fmt.Sprintf("INSERT OR IGNORE INTO domains (name, enabled) VALUES ('%s', 1);", i.config.Domain)
-	cmd = exec.Command("sqlite3", dbPath, insertDomain)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to insert default domain: %w\nOutput: %s", err, output)
-	}
+	return i.createSchema()
+}
 
+func (i *Installer) initPostgreSQLDatabase() error {
 	if i.verbose {
-		fmt.Printf("  ✓ Default domain '%s' added to database\n", i.config.Domain)
+		fmt.Fprintln(i.out, "  Setting up PostgreSQL database...")
+		fmt.Fprintln(i.out, "  Note: the database and user must already exist, e.g.:")
+		fmt.Fprintf(i.out, "    CREATE USER %s WITH PASSWORD '...';\n", i.config.Database.User)
+		fmt.Fprintf(i.out, "    CREATE DATABASE %s OWNER %s;\n", i.config.Database.Name, i.config.Database.User)
 	}
 
-	return nil
+	return i.createSchema()
 }
 
-func (i *Installer) initMySQLDatabase() error {
+// createSchema applies all schema migrations and adds the default domain
+func (i *Installer) createSchema() error {
+	db, err := database.Connect(i.config.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s database: %w", i.config.Database.Type, err)
+	}
+	defer db.Close()
+
+	applied, err := db.Migrate()
+	if err != nil {
+		return err
+	}
+
 	if i.verbose {
-		fmt.Println("  MySQL/MariaDB setup...")
-		fmt.Println("  Note: You need to manually create the database and user")
-		fmt.Println("  Example commands:")
-		fmt.Printf("    CREATE DATABASE mailstack;\n")
-		fmt.Printf("    CREATE USER 'mailstack'@'localhost' IDENTIFIED BY 'password';\n")
-		fmt.Printf("    GRANT ALL PRIVILEGES ON mailstack.* TO 'mailstack'@'localhost';\n")
-		fmt.Printf("    FLUSH PRIVILEGES;\n")
+		fmt.Fprintf(i.out, "  ✓ %s schema initialized (%d migrations applied)\n", db.Type(), applied)
 	}
 
-	// TODO: Implement MySQL schema initialization
-	return fmt.Errorf("MySQL database initialization not yet implemented - please create database manually")
-}
+	// Insert default domain
+	if err := db.EnsureDomain(i.config.Domain); err != nil {
+		return fmt.Errorf("failed to insert default domain: %w", err)
+	}
 
-func (i *Installer) initPostgreSQLDatabase() error {
 	if i.verbose {
-		fmt.Println("  PostgreSQL setup...")
-		fmt.Println("  Note: You need to manually create the database and user")
-		fmt.Println("  Example commands:")
-		fmt.Printf("    CREATE DATABASE mailstack;\n")
-		fmt.Printf("    CREATE USER mailstack WITH PASSWORD 'password';\n")
-		fmt.Printf("    GRANT ALL PRIVILEGES ON DATABASE mailstack TO mailstack;\n")
+		fmt.Fprintf(i.out, "  ✓ Default domain '%s' added to database\n", i.config.Domain)
 	}
 
-	// TODO: Implement PostgreSQL schema initialization
-	return fmt.Errorf("PostgreSQL database initialization not yet implemented - please create database manually")
+	return nil
 }
 
 func (i *Installer) generateDKIM() error {
 	if i.verbose {
-		fmt.Println("Generating DKIM keys...")
+		fmt.Fprintln(i.out, "Generating DKIM keys...")
 	}
 
 	// Generate DKIM key for main domain
@@ -636,13 +439,13 @@ func (i *Installer) generateDKIM() error {
 	// Check if key already exists
 	if _, err := os.Stat(privateKeyPath); err == nil {
 		if i.verbose {
-			fmt.Printf("  DKIM key already exists for %s, skipping...\n", domain)
+			fmt.Fprintf(i.out, "  DKIM key already exists for %s, skipping...\n", domain)
 		}
 		return nil
 	}
 
 	if i.verbose {
-		fmt.Printf("  Generating 2048-bit RSA key for %s...\n", domain)
+		fmt.Fprintf(i.out, "  Generating 2048-bit RSA key for %s...\n", domain)
 	}
 
 	// Generate RSA private key using openssl
@@ -699,12 +502,12 @@ func (i *Installer) generateDKIM() error {
 	}
 
 	if i.verbose {
-		fmt.Printf("  ✓ DKIM keys generated for %s\n", domain)
-		fmt.Printf("  Private key: %s\n", privateKeyPath)
-		fmt.Printf("  Public key:  %s\n", publicKeyPath)
-		fmt.Printf("  DNS record:  %s\n", dnsRecordPath)
-		fmt.Println("\n  Add this DNS TXT record to your domain:")
-		fmt.Printf("  %s\n", dnsRecord)
+		fmt.Fprintf(i.out, "  ✓ DKIM keys generated for %s\n", domain)
+		fmt.Fprintf(i.out, "  Private key: %s\n", privateKeyPath)
+		fmt.Fprintf(i.out, "  Public key:  %s\n", publicKeyPath)
+		fmt.Fprintf(i.out, "  DNS record:  %s\n", dnsRecordPath)
+		fmt.Fprintln(i.out, "\n  Add this DNS TXT record to your domain:")
+		fmt.Fprintf(i.out, "  %s\n", dnsRecord)
 	}
 
 	return nil
@@ -712,7 +515,7 @@ func (i *Installer) generateDKIM() error {
 
 func (i *Installer) setupTLS() error {
 	if i.verbose {
-		fmt.Println("Setting up TLS certificates...")
+		fmt.Fprintln(i.out, "Setting up TLS certificates...")
 	}
 
 	switch i.config.TLS.Flavor {
@@ -722,12 +525,12 @@ func (i *Installer) setupTLS() error {
 		return i.setupCustomCerts()
 	case "notls":
 		if i.verbose {
-			fmt.Println("  TLS disabled, skipping certificate setup")
+			fmt.Fprintln(i.out, "  TLS disabled, skipping certificate setup")
 		}
 		return nil
 	default:
 		if i.verbose {
-			fmt.Printf("  Unknown TLS flavor '%s', skipping certificate setup\n", i.config.TLS.Flavor)
+			fmt.Fprintf(i.out, "  Unknown TLS flavor '%s', skipping certificate setup\n", i.config.TLS.Flavor)
 		}
 		return nil
 	}
@@ -735,7 +538,7 @@ func (i *Installer) setupTLS() error {
 
 func (i *Installer) setupLetsEncrypt() error {
 	if i.verbose {
-		fmt.Println("  Configuring Let's Encrypt...")
+		fmt.Fprintln(i.out, "  Configuring Let's Encrypt...")
 	}
 
 	// Verify certbot is installed
@@ -773,13 +576,13 @@ func (i *Installer) setupLetsEncrypt() error {
 	}
 
 	if i.verbose {
-		fmt.Printf("  Requesting certificates for: %v\n", domains)
-		fmt.Println("  Note: Make sure ports 80 and 443 are accessible from the internet")
+		fmt.Fprintf(i.out, "  Requesting certificates for: %v\n", domains)
+		fmt.Fprintln(i.out, "  Note: Make sure ports 80 and 443 are accessible from the internet")
 	}
 
 	// Run certbot
 	cmd := exec.Command("certbot", args...)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = i.out
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
@@ -803,7 +606,7 @@ func (i *Installer) setupLetsEncrypt() error {
 
 	// Set up auto-renewal
 	if i.verbose {
-		fmt.Println("  Setting up certificate auto-renewal...")
+		fmt.Fprintln(i.out, "  Setting up certificate auto-renewal...")
 	}
 
 	// Create renewal hook script
@@ -820,8 +623,8 @@ systemctl reload dovecot
 	}
 
 	if i.verbose {
-		fmt.Println("  ✓ Let's Encrypt certificates configured")
-		fmt.Println("  Certificates will auto-renew via certbot timer")
+		fmt.Fprintln(i.out, "  ✓ Let's Encrypt certificates configured")
+		fmt.Fprintln(i.out, "  Certificates will auto-renew via certbot timer")
 	}
 
 	return nil
@@ -829,7 +632,7 @@ systemctl reload dovecot
 
 func (i *Installer) setupCustomCerts() error {
 	if i.verbose {
-		fmt.Println("  Configuring custom certificates...")
+		fmt.Fprintln(i.out, "  Configuring custom certificates...")
 	}
 
 	if i.config.TLS.CertPath == "" || i.config.TLS.KeyPath == "" {
@@ -867,9 +670,9 @@ func (i *Installer) setupCustomCerts() error {
 	}
 
 	if i.verbose {
-		fmt.Println("  ✓ Custom certificates configured")
-		fmt.Printf("  Certificate: %s\n", certDest)
-		fmt.Printf("  Private key: %s\n", keyDest)
+		fmt.Fprintln(i.out, "  ✓ Custom certificates configured")
+		fmt.Fprintf(i.out, "  Certificate: %s\n", certDest)
+		fmt.Fprintf(i.out, "  Private key: %s\n", keyDest)
 	}
 
 	return nil
@@ -877,7 +680,7 @@ func (i *Installer) setupCustomCerts() error {
 
 func (i *Installer) configureServices() error {
 	if i.verbose {
-		fmt.Println("Configuring systemd services...")
+		fmt.Fprintln(i.out, "Configuring systemd services...")
 	}
 
 	// Create systemd override directories
@@ -1014,7 +817,7 @@ RestartSec=10s
 
 	// Reload systemd daemon to pick up changes
 	if i.verbose {
-		fmt.Println("  Reloading systemd daemon...")
+		fmt.Fprintln(i.out, "  Reloading systemd daemon...")
 	}
 	cmd := exec.Command("systemctl", "daemon-reload")
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -1022,7 +825,7 @@ RestartSec=10s
 	}
 
 	if i.verbose {
-		fmt.Println("  ✓ Systemd services configured")
+		fmt.Fprintln(i.out, "  ✓ Systemd services configured")
 	}
 
 	return nil
@@ -1030,7 +833,7 @@ RestartSec=10s
 
 func (i *Installer) startServices() error {
 	if i.verbose {
-		fmt.Println("Starting mail services...")
+		fmt.Fprintln(i.out, "Starting mail services...")
 	}
 
 	// Define service start order (dependencies first)
@@ -1054,23 +857,23 @@ func (i *Installer) startServices() error {
 	// Enable and start each service
 	for _, service := range services {
 		if i.verbose {
-			fmt.Printf("  Enabling %s...\n", service)
+			fmt.Fprintf(i.out, "  Enabling %s...\n", service)
 		}
 
 		// Enable service to start on boot
 		if err := system.EnableService(service); err != nil {
-			fmt.Printf("  Warning: Failed to enable %s: %v\n", service, err)
+			fmt.Fprintf(i.out, "  Warning: Failed to enable %s: %v\n", service, err)
 			// Continue anyway - service might not exist on this system
 			continue
 		}
 
 		// Start the service
 		if i.verbose {
-			fmt.Printf("  Starting %s...\n", service)
+			fmt.Fprintf(i.out, "  Starting %s...\n", service)
 		}
 		if err := system.StartService(service); err != nil {
 			// Try to get service status for debugging
-			fmt.Printf("  Warning: Failed to start %s: %v\n", service, err)
+			fmt.Fprintf(i.out, "  Warning: Failed to start %s: %v\n", service, err)
 			continue
 		}
 
@@ -1080,22 +883,30 @@ func (i *Installer) startServices() error {
 
 	// Restart services that depend on configs we just created
 	if i.verbose {
-		fmt.Println("  Restarting services to apply new configurations...")
+		fmt.Fprintln(i.out, "  Restarting services to apply new configurations...")
 	}
 
+	// The configs passed pre-flight validation, so a failed restart is a
+	// real problem rather than something to warn about and move past
+	var failed []string
 	restartServices := []string{"postfix", "dovecot", "rspamd", "nginx"}
 	for _, service := range restartServices {
 		if i.verbose {
-			fmt.Printf("  Restarting %s...\n", service)
+			fmt.Fprintf(i.out, "  Restarting %s...\n", service)
 		}
 		if err := system.RestartService(service); err != nil {
-			fmt.Printf("  Warning: Failed to restart %s: %v\n", service, err)
+			fmt.Fprintf(i.out, "  ✗ Failed to restart %s: %v\n", service, err)
+			failed = append(failed, service)
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
 
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to restart %s (check 'journalctl -u <service>')", strings.Join(failed, ", "))
+	}
+
 	if i.verbose {
-		fmt.Println("  ✓ All services started")
+		fmt.Fprintln(i.out, "  ✓ All services started")
 	}
 
 	return nil
@@ -1103,7 +914,7 @@ func (i *Installer) startServices() error {
 
 func (i *Installer) createAdminUser() error {
 	if i.verbose {
-		fmt.Println("Creating admin user...")
+		fmt.Fprintln(i.out, "Creating admin user...")
 	}
 
 	// This will be implemented once we have database schema
@@ -1138,9 +949,9 @@ echo "  Password: (as provided)"
 	}
 
 	if i.verbose {
-		fmt.Println("  ✓ Admin user creation script installed")
-		fmt.Printf("  Run: mailstack-create-admin <email> <password>\n")
-		fmt.Printf("  Example: mailstack-create-admin admin@%s MySecurePassword\n", i.config.Domain)
+		fmt.Fprintln(i.out, "  ✓ Admin user creation script installed")
+		fmt.Fprintf(i.out, "  Run: mailstack-create-admin <email> <password>\n")
+		fmt.Fprintf(i.out, "  Example: mailstack-create-admin admin@%s MySecurePassword\n", i.config.Domain)
 	}
 
 	return nil
@@ -1148,7 +959,7 @@ echo "  Password: (as provided)"
 
 func (i *Installer) healthCheck() error {
 	if i.verbose {
-		fmt.Println("Performing health check...")
+		fmt.Fprintln(i.out, "Performing health check...")
 	}
 
 	services := []string{"redis", "rspamd", "postfix", "dovecot", "nginx"}
@@ -1169,12 +980,12 @@ func (i *Installer) healthCheck() error {
 
 		if err != nil || status != "active\n" {
 			if i.verbose {
-				fmt.Printf("  ✗ %s: NOT RUNNING\n", service)
+				fmt.Fprintf(i.out, "  ✗ %s: NOT RUNNING\n", service)
 			}
 			allHealthy = false
 		} else {
 			if i.verbose {
-				fmt.Printf("  ✓ %s: running\n", service)
+				fmt.Fprintf(i.out, "  ✓ %s: running\n", service)
 			}
 		}
 	}
@@ -1192,7 +1003,7 @@ func (i *Installer) healthCheck() error {
 	}
 
 	if i.verbose {
-		fmt.Println("\n  Checking ports...")
+		fmt.Fprintln(i.out, "\n  Checking ports...")
 	}
 
 	for name, port := range ports {
@@ -1200,7 +1011,7 @@ func (i *Installer) healthCheck() error {
 		output, err := cmd.Output()
 		if err != nil {
 			if i.verbose {
-				fmt.Printf("  Warning: Could not check port %d (%s)\n", port, name)
+				fmt.Fprintf(i.out, "  Warning: Could not check port %d (%s)\n", port, name)
 			}
 			continue
 		}
@@ -1216,27 +1027,27 @@ func (i *Installer) healthCheck() error {
 
 		if listening {
 			if i.verbose {
-				fmt.Printf("  ✓ Port %d (%s): listening\n", port, name)
+				fmt.Fprintf(i.out, "  ✓ Port %d (%s): listening\n", port, name)
 			}
 		} else {
 			if i.verbose {
-				fmt.Printf("  ✗ Port %d (%s): not listening\n", port, name)
+				fmt.Fprintf(i.out, "  ✗ Port %d (%s): not listening\n", port, name)
 			}
 			allHealthy = false
 		}
 	}
 
 	if !allHealthy {
-		fmt.Println("\n  ⚠ Warning: Some services or ports are not healthy")
-		fmt.Println("  You may need to check service logs:")
-		fmt.Println("    journalctl -u postfix -n 50")
-		fmt.Println("    journalctl -u dovecot -n 50")
-		fmt.Println("    journalctl -u rspamd -n 50")
+		fmt.Fprintln(i.out, "\n  ⚠ Warning: Some services or ports are not healthy")
+		fmt.Fprintln(i.out, "  You may need to check service logs:")
+		fmt.Fprintln(i.out, "    journalctl -u postfix -n 50")
+		fmt.Fprintln(i.out, "    journalctl -u dovecot -n 50")
+		fmt.Fprintln(i.out, "    journalctl -u rspamd -n 50")
 		return fmt.Errorf("health check failed - some services not running properly")
 	}
 
 	if i.verbose {
-		fmt.Println("\n  ✓ All health checks passed!")
+		fmt.Fprintln(i.out, "\n  ✓ All health checks passed!")
 	}
 
 	return nil
@@ -0,0 +1,219 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/templates"
+)
+
+// preflightCheck runs a daemon's own configuration checker
+type preflightCheck struct {
+	service string // manifest service whose files are checked
+	binary  string
+	args    func(stagingDir string) []string
+	prepare func(stagingDir string, staged []templates.StagedFile) error // optional, run before the checker
+}
+
+// CheckResult is the outcome of one pre-flight check
+type CheckResult struct {
+	Service string
+	Command string
+	Skipped bool // checker binary is not installed
+	Output  string
+	Err     error
+}
+
+// preflightChecks validate the staged files rather than the installed ones.
+// nginx includes rendered files by absolute path, so it checks a copy of
+// nginx.conf whose includes point into the staging directory; postfix
+// likewise checks copies of main.cf and master.cf whose database maps and
+// header filter point at their staged files. Files that are not rendered,
+// such as mime.types, conf.d and the lmdb maps built by postmap, and the
+// /overrides includes of dovecot and rspamd are still read from the system.
+var preflightChecks = []preflightCheck{
+	{
+		service: "postfix",
+		binary:  "postfix",
+		args: func(stagingDir string) []string {
+			return []string{"-c", filepath.Join(stagingDir, postfixCheckDir), "check"}
+		},
+		prepare: stagePostfixMaps,
+	},
+	{
+		service: "dovecot",
+		binary:  "doveconf",
+		args: func(stagingDir string) []string {
+			return []string{"-n", "-c", filepath.Join(stagingDir, "etc/dovecot/dovecot.conf")}
+		},
+	},
+	{
+		service: "nginx",
+		binary:  "nginx",
+		args: func(stagingDir string) []string {
+			return []string{"-t", "-c", filepath.Join(stagingDir, nginxCheckConf)}
+		},
+		prepare: stageNginxIncludes,
+	},
+	{
+		service: "rspamd",
+		binary:  "rspamadm",
+		args: func(stagingDir string) []string {
+			return []string{"--var=LOCAL_CONFDIR=" + filepath.Join(stagingDir, "etc/rspamd"), "configtest"}
+		},
+	},
+}
+
+// Preflight runs every daemon checker whose files are part of staged
+func (i *Installer) Preflight(staged []templates.StagedFile, stagingDir string) []CheckResult {
+	present := make(map[string]bool)
+	for _, file := range staged {
+		present[file.Service] = true
+	}
+
+	var results []CheckResult
+	for _, check := range preflightChecks {
+		if !present[check.service] {
+			continue
+		}
+
+		args := check.args(stagingDir)
+		result := CheckResult{
+			Service: check.service,
+			Command: check.binary + " " + strings.Join(args, " "),
+		}
+
+		if _, err := exec.LookPath(check.binary); err != nil {
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+
+		if i.verbose {
+			fmt.Fprintf(i.out, "  Checking %s configuration...\n", check.service)
+		}
+		if check.prepare != nil {
+			if err := check.prepare(stagingDir, staged); err != nil {
+				result.Err = err
+				results = append(results, result)
+				continue
+			}
+		}
+
+		output, err := exec.Command(check.binary, args...).CombinedOutput()
+		result.Output = strings.TrimSpace(string(output))
+		if err != nil {
+			result.Err = fmt.Errorf("%s configuration check failed: %w", check.service, err)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// nginxCheckConf is the copy of nginx.conf that nginx -t checks, relative
+// to the staging directory
+const nginxCheckConf = "preflight/nginx.conf"
+
+// stageNginxIncludes writes the staged nginx.conf to nginxCheckConf with
+// every include of a rendered file pointing at its staged copy
+func stageNginxIncludes(stagingDir string, staged []templates.StagedFile) error {
+	var main string
+	var pairs []string
+	for _, file := range staged {
+		if file.Output == "/etc/nginx/nginx.conf" {
+			main = file.Path
+		}
+		pairs = append(pairs, "include "+file.Output+";", "include "+file.Path+";")
+	}
+	if main == "" {
+		return fmt.Errorf("nginx.conf was not staged")
+	}
+
+	content, err := os.ReadFile(main)
+	if err != nil {
+		return fmt.Errorf("failed to read staged nginx.conf: %w", err)
+	}
+	checkConf := filepath.Join(stagingDir, nginxCheckConf)
+	if err := os.MkdirAll(filepath.Dir(checkConf), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(checkConf), err)
+	}
+	content = []byte(strings.NewReplacer(pairs...).Replace(string(content)))
+	if err := os.WriteFile(checkConf, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", checkConf, err)
+	}
+	return nil
+}
+
+// postfixCheckDir is the copy of the postfix configuration directory that
+// postfix check reads, relative to the staging directory
+const postfixCheckDir = "preflight/postfix"
+
+// stagePostfixMaps writes the staged main.cf and master.cf to
+// postfixCheckDir with every rendered file they name pointing at its
+// staged copy. lmdb maps keep their path: their database is built from the
+// installed source file and is not staged.
+func stagePostfixMaps(stagingDir string, staged []templates.StagedFile) error {
+	var configs []templates.StagedFile
+	var pairs []string
+	hasMain := false
+	for _, file := range staged {
+		switch file.Output {
+		case "/etc/postfix/main.cf":
+			hasMain = true
+			configs = append(configs, file)
+		case "/etc/postfix/master.cf":
+			configs = append(configs, file)
+		}
+		// The replacer matches "lmdb:" first, so the path after it is kept
+		pairs = append(pairs, "lmdb:"+file.Output, "lmdb:"+file.Output, file.Output, file.Path)
+	}
+	if !hasMain {
+		return fmt.Errorf("main.cf was not staged")
+	}
+
+	checkDir := filepath.Join(stagingDir, postfixCheckDir)
+	if err := os.MkdirAll(checkDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", checkDir, err)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	for _, file := range configs {
+		content, err := os.ReadFile(file.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read staged %s: %w", filepath.Base(file.Output), err)
+		}
+		checkConf := filepath.Join(checkDir, filepath.Base(file.Output))
+		if err := os.WriteFile(checkConf, []byte(replacer.Replace(string(content))), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", checkConf, err)
+		}
+	}
+	return nil
+}
+
+// skippedChecks returns the services whose checker is not installed
+func skippedChecks(results []CheckResult) []string {
+	var skipped []string
+	for _, result := range results {
+		if result.Skipped {
+			skipped = append(skipped, result.Service)
+		}
+	}
+	return skipped
+}
+
+// checkFailures turns failed pre-flight results into a single error
+func checkFailures(results []CheckResult) error {
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, fmt.Sprintf("%v\n  $ %s\n%s", result.Err, result.Command, result.Output))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pre-flight validation failed, nothing was installed:\n%s", strings.Join(failed, "\n"))
+}
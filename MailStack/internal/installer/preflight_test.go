@@ -0,0 +1,66 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/templates"
+)
+
+func TestStagePostfixMaps(t *testing.T) {
+	stagingDir := t.TempDir()
+	var staged []templates.StagedFile
+	for output, content := range map[string]string{
+		"/etc/postfix/main.cf": "virtual_alias_maps = mysql:/etc/postfix/sql-virtual-forward-maps.cf, mysql:/etc/postfix/sql-virtual-alias-maps.cf\n" +
+			"smtp_sasl_password_maps = lmdb:/etc/postfix/sasl_passwd\n" +
+			"transport_maps = lmdb:/etc/postfix/transport.map\n",
+		"/etc/postfix/master.cf":                   "outclean unix n - n - 0 cleanup\n  -o header_checks=pcre:/etc/postfix/outclean_header_filter.cf\n",
+		"/etc/postfix/sql-virtual-forward-maps.cf": "query = SELECT 1\n",
+		"/etc/postfix/sql-virtual-alias-maps.cf":   "query = SELECT 1\n",
+		"/etc/postfix/outclean_header_filter.cf":   "/^Received:/ IGNORE\n",
+		"/etc/postfix/sasl_passwd":                 "[mx.example.net]:587 user:secret\n",
+	} {
+		path := filepath.Join(stagingDir, output)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		staged = append(staged, templates.StagedFile{Target: templates.Target{Output: output}, Path: path})
+	}
+
+	if err := stagePostfixMaps(stagingDir, staged); err != nil {
+		t.Fatalf("stagePostfixMaps: %v", err)
+	}
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{name: "database maps", file: "main.cf", want: "mysql:" + filepath.Join(stagingDir, "etc/postfix/sql-virtual-forward-maps.cf") +
+			", mysql:" + filepath.Join(stagingDir, "etc/postfix/sql-virtual-alias-maps.cf")},
+		{name: "staged lmdb map", file: "main.cf", want: "lmdb:/etc/postfix/sasl_passwd\n"},
+		{name: "lmdb map that is not rendered", file: "main.cf", want: "lmdb:/etc/postfix/transport.map\n"},
+		{name: "header filter", file: "master.cf", want: "pcre:" + filepath.Join(stagingDir, "etc/postfix/outclean_header_filter.cf")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join(stagingDir, postfixCheckDir, tt.file))
+			if err != nil {
+				t.Fatalf("checked %s: %v", tt.file, err)
+			}
+			if !strings.Contains(string(content), tt.want) {
+				t.Errorf("checked %s does not contain %q:\n%s", tt.file, tt.want, content)
+			}
+		})
+	}
+
+	t.Run("main.cf not staged", func(t *testing.T) {
+		if err := stagePostfixMaps(t.TempDir(), staged[:0]); err == nil {
+			t.Error("stagePostfixMaps succeeded without main.cf")
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package mailbox
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Path returns the mailbox directory of email, Paths.Mail/<domain>/<user>.
+// It refuses addresses that would resolve outside root.
+func Path(root, email string) (string, error) {
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid email format: %s", email)
+	}
+
+	domainDir, err := DomainPath(root, parts[1])
+	if err != nil {
+		return "", err
+	}
+	if err := checkComponent(parts[0]); err != nil {
+		return "", fmt.Errorf("invalid mailbox name %q: %w", email, err)
+	}
+
+	return filepath.Join(domainDir, parts[0]), nil
+}
+
+// DomainPath returns the directory holding every mailbox of domain
+func DomainPath(root, domain string) (string, error) {
+	if err := checkComponent(domain); err != nil {
+		return "", fmt.Errorf("invalid domain %q: %w", domain, err)
+	}
+	return confined(root, filepath.Join(root, domain))
+}
+
+// Remove deletes a mailbox or domain directory returned by Path or
+// DomainPath. A directory that does not exist is not an error.
+func Remove(root, dir string) error {
+	dir, err := confined(root, dir)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	// Never follow a symlink out of the mail root
+	if !info.IsDir() {
+		return fmt.Errorf("refusing to remove %s: not a directory", dir)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", dir, err)
+	}
+	return nil
+}
+
+// Archive writes dir into a gzipped tarball in destDir and returns its path.
+// Nothing is written when dir does not exist.
+func Archive(root, dir, destDir, name string) (string, error) {
+	dir, err := confined(root, dir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(destDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	dest := filepath.Join(destDir, fmt.Sprintf("%s-%s.tar.gz", name, time.Now().UTC().Format("20060102-150405")))
+	tmp, err := os.CreateTemp(destDir, ".archive-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	if err := writeTree(tw, dir); err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+
+	return dest, nil
+}
+
+// writeTree adds dir to tw with paths relative to its parent, so that the
+// archive unpacks into a directory named after the mailbox
+func writeTree(tw *tar.Writer, dir string) error {
+	base := filepath.Dir(dir)
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// checkComponent rejects names that are not a single path element
+func checkComponent(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("empty or relative name")
+	}
+	if strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("contains a path separator")
+	}
+	return nil
+}
+
+// confined cleans dir and checks that it lies strictly below root
+func confined(root, dir string) (string, error) {
+	if root == "" {
+		return "", fmt.Errorf("mail root is not configured")
+	}
+	root = filepath.Clean(root)
+	dir = filepath.Clean(dir)
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to touch %s: outside of mail root %s", dir, root)
+	}
+	return dir, nil
+}
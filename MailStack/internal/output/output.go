@@ -0,0 +1,211 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format selects how command results are written
+type Format string
+
+// Supported output formats
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	YAML  Format = "yaml"
+	CSV   Format = "csv"
+)
+
+// Formats lists the accepted --output values
+var Formats = []Format{Table, JSON, YAML, CSV}
+
+// ParseFormat validates an --output value
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(s, string(f)) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q (must be table, json, yaml or csv)", s)
+}
+
+// Machine reports whether the format is meant for scripts rather than people
+func (f Format) Machine() bool {
+	return f == JSON || f == YAML || f == CSV
+}
+
+// View is the tabular form of a result, used for table and CSV output.
+// A record view (one row, Record set) is shown as "Column: value" lines
+// in a table instead of a single wide row.
+type View struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+	Record  bool
+	Empty   string // shown in a table when there are no rows
+}
+
+// List returns a view with one row per item
+func List(title string, columns ...string) *View {
+	return &View{Title: title, Columns: columns}
+}
+
+// Record returns a view of a single item
+func Record(title string) *View {
+	return &View{Title: title, Record: true, Rows: [][]string{nil}}
+}
+
+// Row appends a row to a list view
+func (v *View) Row(values ...string) *View {
+	v.Rows = append(v.Rows, values)
+	return v
+}
+
+// Field appends a column and its value to a record view
+func (v *View) Field(column, value string) *View {
+	v.Columns = append(v.Columns, column)
+	v.Rows[0] = append(v.Rows[0], value)
+	return v
+}
+
+// Printer writes results and messages in the selected format. Data goes to
+// Out; in machine formats, messages meant for people go to Err so that Out
+// stays parseable.
+type Printer struct {
+	Format Format
+	Out    io.Writer
+	Err    io.Writer
+}
+
+// Print writes data as JSON or YAML, or its view as a table or CSV
+func (p *Printer) Print(data interface{}, view *View) error {
+	// An empty list is [] rather than null
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice && v.IsNil() {
+		data = []interface{}{}
+	}
+
+	switch p.Format {
+	case JSON:
+		return writeJSON(p.Out, data)
+	case YAML:
+		return writeYAML(p.Out, data)
+	case CSV:
+		return writeCSV(p.Out, view)
+	default:
+		return writeTable(p.Out, view)
+	}
+}
+
+// Infof writes a message for people, such as "✅ User added"
+func (p *Printer) Infof(format string, args ...interface{}) {
+	fmt.Fprintf(p.Info(), format, args...)
+}
+
+// Info returns where messages for people go, for code that writes
+// progress itself
+func (p *Printer) Info() io.Writer {
+	if p.Format.Machine() {
+		return p.Err
+	}
+	return p.Out
+}
+
+func writeJSON(w io.Writer, data interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	return nil
+}
+
+// writeYAML goes through JSON so that both formats share the json field
+// names and order
+func writeYAML(w io.Writer, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	blockStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	return encoder.Close()
+}
+
+// blockStyle drops the flow style and quoting inherited from the JSON
+// source; the encoder quotes whatever still needs it
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+func writeCSV(w io.Writer, view *View) error {
+	cw := csv.NewWriter(w)
+	cw.Write(view.Columns)
+	cw.WriteAll(view.Rows)
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+func writeTable(w io.Writer, view *View) error {
+	var buf bytes.Buffer
+	if view.Title != "" {
+		buf.WriteString(view.Title + "\n")
+	}
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	switch {
+	case len(view.Rows) == 0:
+		if view.Empty != "" {
+			fmt.Fprintf(tw, "  %s\n", view.Empty)
+		}
+	case view.Record:
+		for i, column := range view.Columns {
+			fmt.Fprintf(tw, "  %s:\t%s\n", label(column), view.Rows[0][i])
+		}
+	default:
+		headers := make([]string, len(view.Columns))
+		for i, column := range view.Columns {
+			headers[i] = strings.ToUpper(label(column))
+		}
+		fmt.Fprintf(tw, "  %s\n", strings.Join(headers, "\t"))
+		for _, row := range view.Rows {
+			fmt.Fprintf(tw, "  %s\n", strings.Join(row, "\t"))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// label turns a CSV column such as "display_name" into "Display name"
+func label(column string) string {
+	s := strings.ReplaceAll(column, "_", " ")
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -114,6 +114,9 @@ func GetRequiredPackages(osType osdetect.OSType) []string {
 			// Mail Transfer Agent (MTA)
 			"postfix",
 			"postfix-pcre",
+			"postfix-mysql",
+			"postfix-pgsql",
+			"postfix-sqlite",
 
 			// IMAP/POP3 Server
 			"dovecot-core",
@@ -172,6 +175,8 @@ func GetRequiredPackages(osType osdetect.OSType) []string {
 			// Mail Transfer Agent (MTA)
 			"postfix",
 			"postfix-pcre",
+			"postfix-mysql",
+			"postfix-pgsql",
 
 			// IMAP/POP3 Server
 			"dovecot",
@@ -225,6 +230,8 @@ func GetRequiredPackages(osType osdetect.OSType) []string {
 			// Mail Transfer Agent (MTA)
 			"postfix",
 			"postfix-pcre",
+			"postfix-mysql",
+			"postfix-pgsql",
 
 			// IMAP/POP3 Server
 			"dovecot",
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// apiVersion follows the API path of the web config in every route
+const apiVersion = "/v1"
+
+// Pagination of list endpoints
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// maxBodySize bounds the JSON body of a request
+const maxBodySize = 1 << 20
+
+// endpoint is one operation of the REST API. The OpenAPI spec is built
+// from the same table, so it always documents what is served.
+type endpoint struct {
+	Method   string
+	Path     string // below the API root, with {name} path parameters
+	Tag      string
+	Summary  string
+	ID       string      // operationId, if the one made of the method and tag is taken
+	Query    []parameter // query parameters besides pagination
+	Request  interface{} // type of the JSON body, nil for none
+	Response interface{} // type of the result, or of the items of a page
+	Status   int         // status on success; 204 has no body
+	Paged    bool        // the handler returns a slice served in pages
+	Handle   func(r *http.Request) (interface{}, error)
+}
+
+// parameter is a query parameter of an endpoint
+type parameter struct {
+	Name        string
+	Type        string // "string", "integer" or "boolean"
+	Description string
+}
+
+// page is the result of a paged list
+type page struct {
+	Items   interface{} `json:"items"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int         `json:"total"`
+}
+
+// apiError is the body of every error response
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiRoot is the path the API is served under, e.g. /api/v1
+func (s *Server) apiRoot() string {
+	return strings.TrimSuffix(s.config.Web.WebAPI, "/") + apiVersion
+}
+
+// endpoints lists every operation of the API
+func (s *Server) endpoints() []endpoint {
+	var all []endpoint
+	all = append(all, s.domainEndpoints()...)
+	all = append(all, s.userEndpoints()...)
+	all = append(all, s.aliasEndpoints()...)
+	all = append(all, s.relayEndpoints()...)
+	all = append(all, s.tokenEndpoints()...)
+	return all
+}
+
+// mountAPI registers the API, which is only served when a token is set
+func (s *Server) mountAPI() {
+	if !s.config.API || s.config.APIToken == "" {
+		return
+	}
+
+	root := s.apiRoot()
+	for _, e := range s.endpoints() {
+		s.api.Handle(e.Method+" "+root+e.Path, s.apiHandler(e))
+	}
+	s.api.HandleFunc("GET "+root+"/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, s.openAPI())
+	})
+}
+
+// apiHandler checks the bearer token, runs the handler of e and writes
+// its result or error as JSON
+func (s *Server) apiHandler(e endpoint) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mailstack"`)
+			s.writeError(w, r, &httpError{http.StatusUnauthorized, "missing or invalid bearer token"})
+			return
+		}
+
+		var paging page
+		if e.Paged {
+			var err error
+			if paging, err = pageParams(r); err != nil {
+				s.writeError(w, r, err)
+				return
+			}
+		}
+
+		result, err := e.Handle(r)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		if e.Status == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if e.Paged {
+			result = paginate(result, paging)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(e.Status)
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			s.log.Printf("failed to write response: %v", err)
+		}
+	})
+}
+
+// authorized reports whether r carries the API token
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.APIToken)) == 1
+}
+
+// httpError is an error answered with its own status
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string { return e.message }
+
+// errorStatus maps the kinds of database errors to HTTP statuses
+var errorStatus = []struct {
+	kind   error
+	status int
+}{
+	{database.ErrNotFound, http.StatusNotFound},
+	{database.ErrExists, http.StatusConflict},
+	{database.ErrConflict, http.StatusConflict},
+	{database.ErrInvalid, http.StatusBadRequest},
+	{database.ErrLimit, http.StatusUnprocessableEntity},
+	{database.ErrPermission, http.StatusForbidden},
+	{database.ErrUnavailable, http.StatusServiceUnavailable},
+}
+
+// writeError answers with the status of err. Errors of no known kind are
+// logged and not shown to the client.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "internal error"
+	var he *httpError
+	if errors.As(err, &he) {
+		status, message = he.status, he.message
+	} else {
+		for _, e := range errorStatus {
+			if errors.Is(err, e.kind) {
+				status, message = e.status, err.Error()
+				break
+			}
+		}
+	}
+	if status == http.StatusInternalServerError {
+		s.log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Code: status, Message: message})
+}
+
+// decodeBody reads the JSON body of r into v, rejecting unknown fields
+func decodeBody(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &httpError{http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err)}
+	}
+	return nil
+}
+
+// pageParams reads the page and per_page query parameters
+func pageParams(r *http.Request) (page, error) {
+	p := page{Page: 1, PerPage: defaultPerPage}
+	for _, param := range []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"page", &p.Page, 0},
+		{"per_page", &p.PerPage, maxPerPage},
+	} {
+		raw := r.URL.Query().Get(param.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || (param.max > 0 && n > param.max) {
+			return p, &httpError{http.StatusBadRequest, fmt.Sprintf("invalid %s %q", param.name, raw)}
+		}
+		*param.value = n
+	}
+	return p, nil
+}
+
+// paginate cuts the page p out of items, a slice
+func paginate(items interface{}, p page) page {
+	v := reflect.ValueOf(items)
+	p.Total = v.Len()
+	start := p.Total
+	if p.Page-1 < p.Total/p.PerPage+1 {
+		start = min((p.Page-1)*p.PerPage, p.Total)
+	}
+	end := min(start+p.PerPage, p.Total)
+	if v.IsNil() {
+		v = reflect.MakeSlice(v.Type(), 0, 0)
+	}
+	p.Items = v.Slice(start, end).Interface()
+	return p
+}
+
+// domainFilter is the domain query parameter of lists
+var domainFilter = parameter{Name: "domain", Type: "string", Description: "only list the addresses of this domain"}
+
+// inDomain reports whether email matches the domain query parameter of r
+func inDomain(r *http.Request, email string) bool {
+	domain := r.URL.Query().Get("domain")
+	return domain == "" || strings.EqualFold(email[strings.LastIndex(email, "@")+1:], domain)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// aliasCreate is the body of POST /alias; "@domain" is a catch-all and
+// the destination a comma-separated list of addresses
+type aliasCreate struct {
+	Email       string `json:"email"`
+	Destination string `json:"destination"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+// aliasUpdate is the body of PATCH /alias/{email}. destination replaces
+// every destination; add_destinations and remove_destinations edit them.
+type aliasUpdate struct {
+	Destination        *string  `json:"destination,omitempty"`
+	AddDestinations    []string `json:"add_destinations,omitempty"`
+	RemoveDestinations []string `json:"remove_destinations,omitempty"`
+	Enabled            *bool    `json:"enabled,omitempty"`
+	Comment            *string  `json:"comment,omitempty"`
+}
+
+func (s *Server) aliasEndpoints() []endpoint {
+	return []endpoint{
+		{Method: "GET", Path: "/alias", Tag: "alias", Summary: "List aliases",
+			Query:    []parameter{domainFilter},
+			Response: database.Alias{}, Status: http.StatusOK, Paged: true,
+			Handle: s.listAliases},
+		{Method: "POST", Path: "/alias", Tag: "alias", Summary: "Create an alias",
+			Request: aliasCreate{}, Response: database.Alias{}, Status: http.StatusCreated,
+			Handle: s.createAlias},
+		{Method: "GET", Path: "/alias/{email}", Tag: "alias", Summary: "Get an alias",
+			Response: database.Alias{}, Status: http.StatusOK,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return s.db.GetAlias(r.PathValue("email"))
+			}},
+		{Method: "PATCH", Path: "/alias/{email}", Tag: "alias", Summary: "Change an alias",
+			Request: aliasUpdate{}, Response: database.Alias{}, Status: http.StatusOK,
+			Handle: s.updateAlias},
+		{Method: "DELETE", Path: "/alias/{email}", Tag: "alias", Summary: "Delete an alias",
+			Status: http.StatusNoContent,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return nil, s.db.DeleteAlias(r.PathValue("email"))
+			}},
+	}
+}
+
+func (s *Server) listAliases(r *http.Request) (interface{}, error) {
+	aliases, err := s.db.ListAliases()
+	if err != nil {
+		return nil, err
+	}
+	matched := []database.Alias{}
+	for _, a := range aliases {
+		if inDomain(r, a.Email) {
+			matched = append(matched, a)
+		}
+	}
+	return matched, nil
+}
+
+func (s *Server) createAlias(r *http.Request) (interface{}, error) {
+	var body aliasCreate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	var alias *database.Alias
+	err := s.db.Transaction(func(tx *database.DB) error {
+		if err := tx.AddAlias(body.Email, body.Destination, body.Comment); err != nil {
+			return err
+		}
+		var err error
+		alias, err = tx.GetAlias(body.Email)
+		return err
+	})
+	return alias, err
+}
+
+func (s *Server) updateAlias(r *http.Request) (interface{}, error) {
+	var body aliasUpdate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	email := r.PathValue("email")
+	update := database.AliasUpdate{
+		Destination:        body.Destination,
+		AddDestinations:    body.AddDestinations,
+		RemoveDestinations: body.RemoveDestinations,
+		Enabled:            body.Enabled,
+		Comment:            body.Comment,
+	}
+	if err := s.db.UpdateAlias(email, update); err != nil {
+		return nil, err
+	}
+	return s.db.GetAlias(email)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// domainCreate is the body of POST /domain
+type domainCreate struct {
+	Name string `json:"name"`
+	domainUpdate
+}
+
+// domainUpdate is the body of PATCH /domain/{domain}; limits of 0 mean
+// unlimited
+type domainUpdate struct {
+	MaxUsers   *int   `json:"max_users,omitempty"`
+	MaxAliases *int   `json:"max_aliases,omitempty"`
+	MaxQuota   *int64 `json:"max_quota_bytes,omitempty"`
+	Enabled    *bool  `json:"enabled,omitempty"`
+}
+
+func (u domainUpdate) update() database.DomainUpdate {
+	return database.DomainUpdate{MaxUsers: u.MaxUsers, MaxAliases: u.MaxAliases, MaxQuota: u.MaxQuota, Enabled: u.Enabled}
+}
+
+func (s *Server) domainEndpoints() []endpoint {
+	return []endpoint{
+		{Method: "GET", Path: "/domain", Tag: "domain", Summary: "List domains",
+			Response: database.Domain{}, Status: http.StatusOK, Paged: true,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return s.db.ListDomains()
+			}},
+		{Method: "POST", Path: "/domain", Tag: "domain", Summary: "Create a domain",
+			Request: domainCreate{}, Response: database.Domain{}, Status: http.StatusCreated,
+			Handle: s.createDomain},
+		{Method: "GET", Path: "/domain/{domain}", Tag: "domain", Summary: "Get a domain",
+			Response: database.Domain{}, Status: http.StatusOK,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return s.db.GetDomain(r.PathValue("domain"))
+			}},
+		{Method: "PATCH", Path: "/domain/{domain}", Tag: "domain", Summary: "Change the limits of a domain",
+			Request: domainUpdate{}, Response: database.Domain{}, Status: http.StatusOK,
+			Handle: s.updateDomain},
+		{Method: "DELETE", Path: "/domain/{domain}", Tag: "domain", Summary: "Delete a domain without users",
+			Status: http.StatusNoContent,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return nil, s.db.DeleteDomain(r.PathValue("domain"))
+			}},
+	}
+}
+
+func (s *Server) createDomain(r *http.Request) (interface{}, error) {
+	var body domainCreate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	var domain *database.Domain
+	err := s.db.Transaction(func(tx *database.DB) error {
+		if err := tx.AddDomain(body.Name); err != nil {
+			return err
+		}
+		if body.domainUpdate != (domainUpdate{}) {
+			if err := tx.UpdateDomain(body.Name, body.update()); err != nil {
+				return err
+			}
+		}
+		var err error
+		domain, err = tx.GetDomain(body.Name)
+		return err
+	})
+	return domain, err
+}
+
+func (s *Server) updateDomain(r *http.Request) (interface{}, error) {
+	var body domainUpdate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	name := r.PathValue("domain")
+	if err := s.db.UpdateDomain(name, body.update()); err != nil {
+		return nil, err
+	}
+	return s.db.GetDomain(name)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/installer"
+)
+
+// relayCreate is the body of POST /relay; without a nexthop, mail goes to
+// the MX hosts of the domain
+type relayCreate struct {
+	Name    string `json:"name"`
+	Nexthop string `json:"nexthop,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// relayUpdate is the body of PATCH /relay/{name}; an empty nexthop
+// delivers to the MX hosts again
+type relayUpdate struct {
+	Nexthop *string `json:"nexthop,omitempty"`
+	Comment *string `json:"comment,omitempty"`
+}
+
+func (s *Server) relayEndpoints() []endpoint {
+	return []endpoint{
+		{Method: "GET", Path: "/relay", Tag: "relay", Summary: "List relay domains",
+			Response: database.Relay{}, Status: http.StatusOK, Paged: true,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return s.db.ListRelays()
+			}},
+		{Method: "POST", Path: "/relay", Tag: "relay", Summary: "Relay mail for a domain to an upstream host",
+			Request: relayCreate{}, Response: database.Relay{}, Status: http.StatusCreated,
+			Handle: s.createRelay},
+		{Method: "GET", Path: "/relay/{name}", Tag: "relay", Summary: "Get a relay domain",
+			Response: database.Relay{}, Status: http.StatusOK,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return s.db.GetRelay(r.PathValue("name"))
+			}},
+		{Method: "PATCH", Path: "/relay/{name}", Tag: "relay", Summary: "Change the upstream host of a relay domain",
+			Request: relayUpdate{}, Response: database.Relay{}, Status: http.StatusOK,
+			Handle: s.updateRelay},
+		{Method: "DELETE", Path: "/relay/{name}", Tag: "relay", Summary: "Stop relaying mail for a domain",
+			Status: http.StatusNoContent,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return nil, s.changeRelays(func(tx *database.DB) error {
+					return tx.DeleteRelay(r.PathValue("name"))
+				})
+			}},
+	}
+}
+
+func (s *Server) createRelay(r *http.Request) (interface{}, error) {
+	var body relayCreate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	var relay *database.Relay
+	err := s.changeRelays(func(tx *database.DB) error {
+		if err := tx.AddRelay(body.Name, body.Nexthop, body.Comment); err != nil {
+			return err
+		}
+		var err error
+		relay, err = tx.GetRelay(body.Name)
+		return err
+	})
+	return relay, err
+}
+
+func (s *Server) updateRelay(r *http.Request) (interface{}, error) {
+	var body relayUpdate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	name := r.PathValue("name")
+	var relay *database.Relay
+	err := s.changeRelays(func(tx *database.DB) error {
+		if err := tx.UpdateRelay(name, database.RelayUpdate{Nexthop: body.Nexthop, Comment: body.Comment}); err != nil {
+			return err
+		}
+		var err error
+		relay, err = tx.GetRelay(name)
+		return err
+	})
+	return relay, err
+}
+
+// changeRelays runs change in a transaction and rewrites the postfix
+// transport map once it has committed
+func (s *Server) changeRelays(change func(tx *database.DB) error) error {
+	if err := s.db.Transaction(change); err != nil {
+		return err
+	}
+	relays, err := s.db.ListRelays()
+	if err != nil {
+		return err
+	}
+	if err := installer.New(s.config, false).WriteTransportMap(relays); err != nil {
+		return fmt.Errorf("relay domains were changed, but the transport map was kept as it was: %w", err)
+	}
+	return nil
+}
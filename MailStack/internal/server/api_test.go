@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	five := []string{"a", "b", "c", "d", "e"}
+
+	tests := []struct {
+		name    string
+		items   []string
+		page    int
+		perPage int
+		want    []string
+	}{
+		{name: "first page", items: five, page: 1, perPage: 2, want: []string{"a", "b"}},
+		{name: "middle page", items: five, page: 2, perPage: 2, want: []string{"c", "d"}},
+		{name: "last partial page", items: five, page: 3, perPage: 2, want: []string{"e"}},
+		{name: "past the end", items: five, page: 4, perPage: 2, want: []string{}},
+		{name: "past an exact multiple", items: five[:4], page: 3, perPage: 2, want: []string{}},
+		{name: "all on one page", items: five, page: 1, perPage: 500, want: five},
+		{name: "huge page number", items: five, page: math.MaxInt, perPage: 500, want: []string{}},
+		{name: "empty", items: []string{}, page: 1, perPage: 50, want: []string{}},
+		{name: "nil", items: nil, page: 1, perPage: 50, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paginate(tt.items, page{Page: tt.page, PerPage: tt.perPage})
+
+			if got.Total != len(tt.items) || got.Page != tt.page || got.PerPage != tt.perPage {
+				t.Errorf("page %d/%d of %d, want %d/%d of %d",
+					got.Page, got.PerPage, got.Total, tt.page, tt.perPage, len(tt.items))
+			}
+			if !reflect.DeepEqual(got.Items, tt.want) {
+				t.Errorf("items = %#v, want %#v", got.Items, tt.want)
+			}
+			// A page is never encoded as null
+			if data, _ := json.Marshal(got.Items); string(data) == "null" {
+				t.Error("items encode as null")
+			}
+		})
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    page
+		wantErr bool
+	}{
+		{query: "", want: page{Page: 1, PerPage: defaultPerPage}},
+		{query: "page=3&per_page=10", want: page{Page: 3, PerPage: 10}},
+		{query: "per_page=500", want: page{Page: 1, PerPage: maxPerPage}},
+		{query: "per_page=501", wantErr: true},
+		{query: "per_page=0", wantErr: true},
+		{query: "page=0", wantErr: true},
+		{query: "page=-1", wantErr: true},
+		{query: "page=two", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := pageParams(httptest.NewRequest("GET", "/api/v1/user?"+tt.query, nil))
+			if tt.wantErr {
+				var he *httpError
+				if err == nil || !errors.As(err, &he) || he.status != http.StatusBadRequest {
+					t.Errorf("pageParams(%q) = %v, want a 400 error", tt.query, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("pageParams(%q) = %+v, %v; want %+v", tt.query, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPI(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+		wantBody   string // substring of the response
+	}{
+		{name: "no token", method: "GET", path: "/api/v1/user", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", method: "GET", path: "/api/v1/user", token: strings.Repeat("x", 32), wantStatus: http.StatusUnauthorized},
+		{name: "list", method: "GET", path: "/api/v1/user", token: testAPIToken, wantStatus: http.StatusOK,
+			wantBody: `"page":1,"per_page":50,"total":1`},
+		{name: "list of another domain", method: "GET", path: "/api/v1/user?domain=example.net", token: testAPIToken, wantStatus: http.StatusOK,
+			wantBody: `{"items":[],"page":1,"per_page":50,"total":0}`},
+		{name: "bad page", method: "GET", path: "/api/v1/user?per_page=1000", token: testAPIToken, wantStatus: http.StatusBadRequest,
+			wantBody: `invalid per_page`},
+		{name: "get", method: "GET", path: "/api/v1/user/alice@example.com", token: testAPIToken, wantStatus: http.StatusOK,
+			wantBody: `"email":"alice@example.com"`},
+		{name: "missing", method: "GET", path: "/api/v1/user/bob@example.com", token: testAPIToken, wantStatus: http.StatusNotFound,
+			wantBody: `"code":404`},
+		{name: "create", method: "POST", path: "/api/v1/user", token: testAPIToken, wantStatus: http.StatusCreated,
+			body: `{"email":"bob@example.com","password":"Tr0ub4dor&3x","display_name":"Bob"}`, wantBody: `"display_name":"Bob"`},
+		{name: "create twice", method: "POST", path: "/api/v1/user", token: testAPIToken, wantStatus: http.StatusConflict,
+			body: `{"email":"alice@example.com","password":"Tr0ub4dor&3x"}`},
+		{name: "weak password", method: "POST", path: "/api/v1/user", token: testAPIToken, wantStatus: http.StatusBadRequest,
+			body: `{"email":"carol@example.com","password":"password"}`},
+		{name: "unknown field", method: "POST", path: "/api/v1/user", token: testAPIToken, wantStatus: http.StatusBadRequest,
+			body: `{"email":"carol@example.com","password":"Tr0ub4dor&3x","admin":true}`, wantBody: `invalid request body`},
+		{name: "delete", method: "DELETE", path: "/api/v1/user/bob@example.com", token: testAPIToken, wantStatus: http.StatusNoContent},
+		{name: "spec", method: "GET", path: "/api/v1/openapi.json", wantStatus: http.StatusOK, wantBody: `"openapi"`},
+	}
+
+	// The cases run in order, on the same database
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			s.API().ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+
+	// The internal listener does not serve the API
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/user", nil)
+	r.Header.Set("Authorization", "Bearer "+testAPIToken)
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("internal listener answered the API with %d, want 404", w.Code)
+	}
+}
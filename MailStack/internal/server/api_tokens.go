@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// tokenCreate is the body of POST /user/{email}/token; ip is a
+// comma-separated list of addresses and networks, empty for any
+type tokenCreate struct {
+	Comment string `json:"comment,omitempty"`
+	IP      string `json:"ip,omitempty"`
+}
+
+// tokenCreated is a new token with its secret, which is only shown once
+type tokenCreated struct {
+	database.Token
+	Secret string `json:"secret"`
+}
+
+func (s *Server) tokenEndpoints() []endpoint {
+	return []endpoint{
+		{Method: "GET", Path: "/token", Tag: "token", Summary: "List the tokens of every user",
+			Query:    []parameter{domainFilter},
+			Response: database.Token{}, Status: http.StatusOK, Paged: true,
+			Handle: s.listTokens},
+		{Method: "GET", Path: "/user/{email}/token", Tag: "token", Summary: "List the tokens of a user",
+			ID:       "listUserToken",
+			Response: database.Token{}, Status: http.StatusOK, Paged: true,
+			Handle: s.listTokens},
+		{Method: "POST", Path: "/user/{email}/token", Tag: "token", Summary: "Create a token; the secret is only returned here",
+			Request: tokenCreate{}, Response: tokenCreated{}, Status: http.StatusCreated,
+			Handle: s.createToken},
+		{Method: "DELETE", Path: "/user/{email}/token/{id}", Tag: "token", Summary: "Revoke a token",
+			Status: http.StatusNoContent,
+			Handle: s.revokeToken},
+	}
+}
+
+func (s *Server) listTokens(r *http.Request) (interface{}, error) {
+	tokens, err := s.db.ListTokens(r.PathValue("email"))
+	if err != nil {
+		return nil, err
+	}
+	matched := []database.Token{}
+	for _, t := range tokens {
+		if inDomain(r, t.Email) {
+			matched = append(matched, t)
+		}
+	}
+	return matched, nil
+}
+
+func (s *Server) createToken(r *http.Request) (interface{}, error) {
+	var body tokenCreate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+
+	token, secret, err := s.db.CreateToken(r.PathValue("email"), body.Comment, body.IP)
+	if err != nil {
+		return nil, err
+	}
+	return tokenCreated{Token: *token, Secret: secret}, nil
+}
+
+func (s *Server) revokeToken(r *http.Request) (interface{}, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, &httpError{http.StatusBadRequest, "invalid token id " + strconv.Quote(r.PathValue("id"))}
+	}
+	return nil, s.db.RevokeToken(r.PathValue("email"), id)
+}
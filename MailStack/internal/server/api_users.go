@@ -0,0 +1,216 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/mailbox"
+)
+
+// userAttributes are the user settings that can be given on creation and
+// changed later
+type userAttributes struct {
+	DisplayName         *string `json:"display_name,omitempty"`
+	Quota               *int64  `json:"quota_bytes,omitempty"`
+	Enabled             *bool   `json:"enabled,omitempty"`
+	EnableIMAP          *bool   `json:"enable_imap,omitempty"`
+	EnablePOP           *bool   `json:"enable_pop,omitempty"`
+	GlobalAdmin         *bool   `json:"global_admin,omitempty"`
+	ForcePasswordChange *bool   `json:"force_password_change,omitempty"`
+}
+
+func (a userAttributes) update() database.UserUpdate {
+	return database.UserUpdate{
+		DisplayName: a.DisplayName, Quota: a.Quota, Enabled: a.Enabled, EnableIMAP: a.EnableIMAP,
+		EnablePOP: a.EnablePOP, GlobalAdmin: a.GlobalAdmin, ForcePasswordChange: a.ForcePasswordChange,
+	}
+}
+
+// userCreate is the body of POST /user. Exactly one of password and
+// password_hash (BLF-CRYPT or SHA512-CRYPT) is required; the quota
+// defaults to the default_quota of the config.
+type userCreate struct {
+	Email        string `json:"email"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	userAttributes
+}
+
+// userUpdate is the body of PATCH /user/{email}. A forward is turned off
+// with forward_enabled false, and set with a forward_destination.
+type userUpdate struct {
+	Password           *string `json:"password,omitempty"`
+	PasswordHash       *string `json:"password_hash,omitempty"`
+	ForwardEnabled     *bool   `json:"forward_enabled,omitempty"`
+	ForwardDestination *string `json:"forward_destination,omitempty"`
+	ForwardKeep        *bool   `json:"forward_keep,omitempty"`
+	userAttributes
+}
+
+func (s *Server) userEndpoints() []endpoint {
+	return []endpoint{
+		{Method: "GET", Path: "/user", Tag: "user", Summary: "List users",
+			Query:    []parameter{domainFilter},
+			Response: database.User{}, Status: http.StatusOK, Paged: true,
+			Handle: s.listUsers},
+		{Method: "POST", Path: "/user", Tag: "user", Summary: "Create a user",
+			Request: userCreate{}, Response: database.User{}, Status: http.StatusCreated,
+			Handle: s.createUser},
+		{Method: "GET", Path: "/user/{email}", Tag: "user", Summary: "Get a user",
+			Response: database.User{}, Status: http.StatusOK,
+			Handle: func(r *http.Request) (interface{}, error) {
+				return s.db.GetUser(r.PathValue("email"))
+			}},
+		{Method: "PATCH", Path: "/user/{email}", Tag: "user", Summary: "Change a user's settings, password or forward",
+			Request: userUpdate{}, Response: database.User{}, Status: http.StatusOK,
+			Handle: s.updateUser},
+		{Method: "DELETE", Path: "/user/{email}", Tag: "user", Summary: "Delete a user",
+			Query: []parameter{{Name: "remove_mailbox", Type: "boolean",
+				Description: "also remove the mailbox, which is kept by default"}},
+			Status: http.StatusNoContent,
+			Handle: s.deleteUser},
+	}
+}
+
+func (s *Server) listUsers(r *http.Request) (interface{}, error) {
+	users, err := s.db.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	matched := []database.User{}
+	for _, u := range users {
+		if inDomain(r, u.Email) {
+			matched = append(matched, u)
+		}
+	}
+	return matched, nil
+}
+
+func (s *Server) createUser(r *http.Request) (interface{}, error) {
+	var body userCreate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	if (body.Password == "") == (body.PasswordHash == "") {
+		return nil, &httpError{http.StatusBadRequest, "give either password or password_hash"}
+	}
+	quota := s.config.Mail.DefaultQuota
+	if body.Quota != nil {
+		quota = *body.Quota
+	}
+
+	var user *database.User
+	err := s.db.Transaction(func(tx *database.DB) error {
+		var err error
+		if body.Password != "" {
+			err = tx.AddUser(body.Email, body.Password, quota)
+		} else {
+			err = tx.AddUserHash(body.Email, body.PasswordHash, quota)
+		}
+		if err != nil {
+			return err
+		}
+
+		attributes := body.userAttributes
+		attributes.Quota = nil
+		if attributes != (userAttributes{}) {
+			if err := tx.UpdateUser(body.Email, attributes.update()); err != nil {
+				return err
+			}
+		}
+		user, err = tx.GetUser(body.Email)
+		return err
+	})
+	return user, err
+}
+
+func (s *Server) updateUser(r *http.Request) (interface{}, error) {
+	var body userUpdate
+	if err := decodeBody(r, &body); err != nil {
+		return nil, err
+	}
+	if body == (userUpdate{}) {
+		return nil, &httpError{http.StatusBadRequest, "nothing to update"}
+	}
+	if body.Password != nil && body.PasswordHash != nil {
+		return nil, &httpError{http.StatusBadRequest, "give either password or password_hash"}
+	}
+
+	email := r.PathValue("email")
+	var user *database.User
+	err := s.db.Transaction(func(tx *database.DB) error {
+		// A new password clears force_password_change, so it goes first
+		if body.Password != nil {
+			if err := tx.ChangePassword(email, *body.Password); err != nil {
+				return err
+			}
+		}
+		if body.PasswordHash != nil {
+			if err := tx.SetPasswordHash(email, *body.PasswordHash); err != nil {
+				return err
+			}
+		}
+		if body.userAttributes != (userAttributes{}) {
+			if err := tx.UpdateUser(email, body.userAttributes.update()); err != nil {
+				return err
+			}
+		}
+		if err := updateForward(tx, email, body); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = tx.GetUser(email)
+		return err
+	})
+	return user, err
+}
+
+// updateForward applies the forward fields of body, keeping the current
+// destination or keep setting when only the other one is given
+func updateForward(tx *database.DB, email string, body userUpdate) error {
+	if body.ForwardEnabled == nil && body.ForwardDestination == nil && body.ForwardKeep == nil {
+		return nil
+	}
+	if body.ForwardEnabled != nil && !*body.ForwardEnabled {
+		return tx.ClearForward(email)
+	}
+
+	current, err := tx.GetUser(email)
+	if err != nil {
+		return err
+	}
+	destination, keep := current.ForwardDestination, current.ForwardKeep
+	if body.ForwardDestination != nil {
+		destination = *body.ForwardDestination
+	}
+	if body.ForwardKeep != nil {
+		keep = *body.ForwardKeep
+	}
+	if destination == "" {
+		return &httpError{http.StatusBadRequest, "forward_destination is required to forward"}
+	}
+	return tx.SetForward(email, destination, keep)
+}
+
+func (s *Server) deleteUser(r *http.Request) (interface{}, error) {
+	email := r.PathValue("email")
+	remove := false
+	if raw := r.URL.Query().Get("remove_mailbox"); raw != "" {
+		var err error
+		if remove, err = strconv.ParseBool(raw); err != nil {
+			return nil, &httpError{http.StatusBadRequest, "invalid remove_mailbox " + strconv.Quote(raw)}
+		}
+	}
+
+	var cleanup func() error
+	if remove {
+		dir, err := mailbox.Path(s.config.Paths.Mail, email)
+		if err != nil {
+			return nil, &httpError{http.StatusBadRequest, err.Error()}
+		}
+		cleanup = func() error { return mailbox.Remove(s.config.Paths.Mail, dir) }
+	}
+	return nil, s.db.DeleteUser(email, cleanup)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// backend is where nginx proxies mail connections to; every service runs
+// on this host
+const backend = "127.0.0.1"
+
+// backendPorts are the ports of the authenticated services, by the
+// Auth-Protocol nginx sends. Authenticated SMTP goes to the internal
+// smtpd on port 10025 of master.cf.
+var backendPorts = map[string]int{
+	"imap":  143,
+	"pop3":  110,
+	"smtp":  10025,
+	"sieve": 4190,
+}
+
+// failureWait is how long nginx makes a client wait after a failed login
+const failureWait = "3"
+
+// authEmail implements nginx's mail auth_http protocol. Unauthenticated
+// SMTP, i.e. incoming mail, is passed on to postfix; anything else needs
+// a user whose password matches.
+func (s *Server) authEmail(w http.ResponseWriter, r *http.Request) {
+	method := r.Header.Get("Auth-Method")
+	protocol := r.Header.Get("Auth-Protocol")
+	client := r.Header.Get("Client-Ip")
+
+	if method == "none" {
+		if protocol != "smtp" {
+			s.authFailed(w, protocol, "Authentication required")
+			return
+		}
+		port := r.Header.Get("Auth-Port")
+		if port == "" {
+			port = "25"
+		}
+		s.authOK(w, port, "")
+		return
+	}
+
+	port, ok := backendPorts[protocol]
+	if !ok || (method != "plain" && method != "login") {
+		s.authFailed(w, protocol, "Unsupported authentication method")
+		return
+	}
+
+	// nginx escapes the credentials it passes on
+	user, err1 := url.PathUnescape(r.Header.Get("Auth-User"))
+	password, err2 := url.PathUnescape(r.Header.Get("Auth-Pass"))
+	if err1 != nil || err2 != nil {
+		s.authFailed(w, protocol, "Authentication credentials invalid")
+		return
+	}
+
+	email, err := s.db.Authenticate(strings.ToLower(user), password, protocol, client)
+	if errors.Is(err, database.ErrPermission) {
+		s.log.Printf("auth: %s login failed for %s from %s", protocol, user, client)
+		s.authFailed(w, protocol, "Authentication credentials invalid")
+		return
+	}
+	if err != nil {
+		// nginx reports a temporary failure to the client
+		s.internalError(w, r, err)
+		return
+	}
+	s.authOK(w, strconv.Itoa(port), email)
+}
+
+// authOK tells nginx to proxy the connection to port, logged in as user
+// when it is not empty
+func (s *Server) authOK(w http.ResponseWriter, port, user string) {
+	w.Header().Set("Auth-Status", "OK")
+	w.Header().Set("Auth-Server", backend)
+	w.Header().Set("Auth-Port", port)
+	if user != "" {
+		w.Header().Set("Auth-User", user)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authFailed tells nginx to refuse the login with status
+func (s *Server) authFailed(w http.ResponseWriter, protocol, status string) {
+	w.Header().Set("Auth-Status", status)
+	w.Header().Set("Auth-Wait", failureWait)
+	if protocol == "smtp" {
+		w.Header().Set("Auth-Error-Code", "535 5.7.8")
+	}
+	w.WriteHeader(http.StatusOK)
+}
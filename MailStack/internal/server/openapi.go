@@ -0,0 +1,213 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pathParam matches the {name} parameters of an endpoint path
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// operationVerbs name the operations of the spec, by method
+var operationVerbs = map[string]string{
+	"GET": "get", "POST": "create", "PATCH": "update", "PUT": "replace", "DELETE": "delete",
+}
+
+// openAPI returns the OpenAPI 3 description of the API, built from the
+// endpoint table and the Go types of its bodies
+func (s *Server) openAPI() map[string]interface{} {
+	g := &schemaGen{schemas: map[string]interface{}{}}
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     jsonContent(g.schema(reflect.TypeOf(apiError{}))),
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, e := range s.endpoints() {
+		var params []interface{}
+		for _, m := range pathParam.FindAllStringSubmatch(e.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+			})
+		}
+		query := append([]parameter{}, e.Query...)
+		if e.Paged {
+			query = append(query,
+				parameter{Name: "page", Type: "integer", Description: "page number, from 1"},
+				parameter{Name: "per_page", Type: "integer", Description: "items per page, at most 500 (default 50)"})
+		}
+		for _, q := range query {
+			params = append(params, map[string]interface{}{
+				"name": q.Name, "in": "query", "description": q.Description, "schema": map[string]string{"type": q.Type},
+			})
+		}
+
+		id := e.ID
+		if id == "" {
+			verb := operationVerbs[e.Method]
+			if e.Paged {
+				verb = "list"
+			}
+			id = verb + capitalize(e.Tag)
+		}
+		op := map[string]interface{}{
+			"operationId": id,
+			"summary":     e.Summary,
+			"tags":        []string{e.Tag},
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if e.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(g.schema(reflect.TypeOf(e.Request))),
+			}
+		}
+
+		success := map[string]interface{}{"description": http.StatusText(e.Status)}
+		if e.Status != http.StatusNoContent {
+			result := g.schema(reflect.TypeOf(e.Response))
+			if e.Paged {
+				result = pageSchema(result)
+			}
+			success["content"] = jsonContent(result)
+		}
+		op["responses"] = map[string]interface{}{
+			strconv.Itoa(e.Status): success,
+			"default":              errorResponse,
+		}
+
+		if paths[e.Path] == nil {
+			paths[e.Path] = map[string]interface{}{}
+		}
+		paths[e.Path][strings.ToLower(e.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "MailStack API",
+			"version": strings.TrimPrefix(apiVersion, "/v"),
+		},
+		"servers":  []interface{}{map[string]string{"url": s.apiRoot()}},
+		"security": []interface{}{map[string][]string{"bearer": {}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]string{"type": "http", "scheme": "bearer"},
+			},
+			"schemas": g.schemas,
+		},
+	}
+}
+
+// capitalize upper-cases the first letter of s
+func capitalize(s string) string {
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// jsonContent is a JSON media type of schema
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// pageSchema is the schema of a page of items
+func pageSchema(items map[string]interface{}) map[string]interface{} {
+	integer := map[string]string{"type": "integer"}
+	return map[string]interface{}{
+		"type":     "object",
+		"required": []string{"items", "page", "per_page", "total"},
+		"properties": map[string]interface{}{
+			"items":    map[string]interface{}{"type": "array", "items": items},
+			"page":     integer,
+			"per_page": integer,
+			"total":    integer,
+		},
+	}
+}
+
+// schemaGen builds JSON schemas of Go types, collecting structs as named
+// components
+type schemaGen struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of t, a reference for structs
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Uint, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := capitalize(t.Name())
+		if _, done := g.schemas[name]; !done {
+			g.schemas[name] = nil // reserved while its fields are built
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of a struct. Fields without omitempty are
+// required; embedded structs are flattened as encoding/json does.
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			if f.Anonymous && tag == "" {
+				add(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = g.schema(f.Type)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
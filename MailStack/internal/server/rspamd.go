@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/dkim"
+)
+
+// dkimSelector is one signing key in a vault response
+type dkimSelector struct {
+	Domain   string `json:"domain"`
+	Key      string `json:"key"`
+	Selector string `json:"selector"`
+}
+
+// rspamdDKIM answers rspamd's vault lookup of the DKIM key for a domain
+// (dkim_signing.conf and arc.conf). Alternative domains sign with the key
+// of their primary domain. A domain without a key gets no selectors, so
+// its mail is sent unsigned. rspamd must send the vault token, as the
+// response holds the private key.
+func (s *Server) rspamdDKIM(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Vault-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.VaultToken())) != 1 {
+		http.Error(w, "invalid vault token", http.StatusForbidden)
+		return
+	}
+
+	domain := strings.ToLower(r.PathValue("domain"))
+	selectors := []dkimSelector{}
+
+	primary, err := s.db.PrimaryDomain(domain)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		s.internalError(w, r, err)
+		return
+	}
+	if err == nil {
+		selector := s.config.Mail.DKIMSelector
+		key, err := os.ReadFile(dkim.KeyPath(primary, selector, s.config.DKIMPath))
+		if err != nil && !os.IsNotExist(err) {
+			s.internalError(w, r, err)
+			return
+		}
+		if err == nil {
+			selectors = append(selectors, dkimSelector{Domain: domain, Key: string(key), Selector: selector})
+		}
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"data": map[string]interface{}{"selectors": selectors},
+	})
+}
+
+// rspamdLocalDomains lists the mail domains and their alternatives, one
+// per line, for rspamd's multimap and whitelist modules
+func (s *Server) rspamdLocalDomains(w http.ResponseWriter, r *http.Request) {
+	domains, err := s.db.ListDomains()
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	alternatives, err := s.db.ListAlternatives("")
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	var b strings.Builder
+	for _, d := range domains {
+		b.WriteString(d.Name + "\n")
+	}
+	for _, a := range alternatives {
+		b.WriteString(a.Name + "\n")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// Server answers the internal HTTP endpoints the other services call:
+// nginx's mail auth_http, rspamd's DKIM vault and domain map, and health
+// checks. They are served on a loopback address only, as most are not
+// authenticated. With an API token set, the REST API, which nginx
+// proxies under the API path, is served on its own listener.
+type Server struct {
+	config *config.Config
+	db     *database.DB
+	mux    *http.ServeMux // internal endpoints
+	api    *http.ServeMux // REST API
+	log    *log.Logger
+}
+
+// New creates a server reading from db
+func New(cfg *config.Config, db *database.DB, logger *log.Logger) *Server {
+	s := &Server{config: cfg, db: db, mux: http.NewServeMux(), api: http.NewServeMux(), log: logger}
+
+	s.mux.HandleFunc("GET /health", s.health)
+	s.mux.HandleFunc("GET /internal/auth/email", s.authEmail)
+	s.mux.HandleFunc("GET /internal/rspamd/vault/v1/dkim/{domain}", s.rspamdDKIM)
+	s.mux.HandleFunc("GET /internal/rspamd/local_domains", s.rspamdLocalDomains)
+	s.mountAPI()
+
+	return s
+}
+
+// ServeHTTP implements http.Handler for the internal endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// API returns the handler of the REST API
+func (s *Server) API() http.Handler {
+	return s.api
+}
+
+// ListenAndServe serves the internal endpoints on addr, which must be a
+// loopback address, and the REST API on apiAddr unless it is empty, until
+// ctx is done. It then waits for the requests in progress to finish.
+func (s *Server) ListenAndServe(ctx context.Context, addr, apiAddr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %s: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("refusing to serve the internal endpoints on %s: not a loopback address", addr)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	running := 1
+	go func() { errs <- s.listenAndServe(ctx, addr, s) }()
+	if apiAddr != "" {
+		running++
+		go func() { errs <- s.listenAndServe(ctx, apiAddr, s.api) }()
+	}
+
+	// The first listener to stop, e.g. on a listen error, stops the other
+	var first error
+	for ; running > 0; running-- {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+		cancel()
+	}
+	return first
+}
+
+// listenAndServe serves handler on addr until ctx is done
+func (s *Server) listenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          s.log,
+	}
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		done <- srv.Shutdown(shutdown)
+	}()
+
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve on %s: %w", addr, err)
+	}
+	return <-done
+}
+
+// health reports whether the database can be reached
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.Ping(); err != nil {
+		s.log.Printf("health: %v", err)
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON sends v as a JSON response
+func (s *Server) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Printf("failed to write response: %v", err)
+	}
+}
+
+// internalError logs err and answers with a 500
+func (s *Server) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	s.log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
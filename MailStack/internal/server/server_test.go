@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/dkim"
+)
+
+const (
+	testPassword = "Tr0ub4dor&3x"
+	testAPIToken = "fedcba9876543210fedcba9876543210"
+)
+
+// newTestServer returns a server with the REST API under /api over a
+// migrated SQLite database holding example.com, its alternative
+// example.org and alice@example.com
+func newTestServer(t *testing.T) (*Server, *database.DB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		SecretKey: "0123456789abcdef0123456789abcdef",
+		APIToken:  testAPIToken,
+		API:       true,
+		DKIMPath:  filepath.Join(dir, "{domain}.{selector}.key"),
+	}
+	cfg.Mail.DKIMSelector = "dkim"
+	cfg.Web.WebAPI = "/api"
+
+	db, err := database.Connect(config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(dir, "mailstack.db")})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	for _, err := range []error{
+		db.AddDomain("example.com"),
+		db.AddAlternative("example.org", "example.com"),
+		db.AddUser("alice@example.com", testPassword, 0),
+	} {
+		if err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	return New(cfg, db, log.New(io.Discard, "", 0)), db
+}
+
+func TestRspamdDKIM(t *testing.T) {
+	s, _ := newTestServer(t)
+	keyPath, _, err := dkim.Generate("example.com", "dkim", 1024, s.config.DKIMPath)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := string(data)
+
+	tests := []struct {
+		name       string
+		domain     string
+		token      string
+		wantStatus int
+		want       []dkimSelector
+	}{
+		{name: "no token", domain: "example.com", wantStatus: http.StatusForbidden},
+		{name: "wrong token", domain: "example.com", token: "0123456789abcdef0123456789abcdef", wantStatus: http.StatusForbidden},
+		{name: "signed domain", domain: "example.com", token: s.config.VaultToken(), wantStatus: http.StatusOK,
+			want: []dkimSelector{{Domain: "example.com", Key: key, Selector: "dkim"}}},
+		{name: "alternative signs with the primary key", domain: "EXAMPLE.org", token: s.config.VaultToken(), wantStatus: http.StatusOK,
+			want: []dkimSelector{{Domain: "example.org", Key: key, Selector: "dkim"}}},
+		{name: "unknown domain", domain: "example.net", token: s.config.VaultToken(), wantStatus: http.StatusOK, want: []dkimSelector{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/internal/rspamd/vault/v1/dkim/"+tt.domain, nil)
+			if tt.token != "" {
+				r.Header.Set("X-Vault-Token", tt.token)
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body struct {
+				Data struct {
+					Selectors []dkimSelector `json:"selectors"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !reflect.DeepEqual(body.Data.Selectors, tt.want) {
+				t.Errorf("selectors = %+v, want %+v", body.Data.Selectors, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthEmail(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    map[string]string // response headers
+	}{
+		{
+			name:    "incoming mail",
+			headers: map[string]string{"Auth-Method": "none", "Auth-Protocol": "smtp"},
+			want:    map[string]string{"Auth-Status": "OK", "Auth-Server": backend, "Auth-Port": "25", "Auth-User": ""},
+		},
+		{
+			name:    "imap without credentials",
+			headers: map[string]string{"Auth-Method": "none", "Auth-Protocol": "imap"},
+			want:    map[string]string{"Auth-Status": "Authentication required", "Auth-Wait": failureWait},
+		},
+		{
+			name:    "imap login",
+			headers: map[string]string{"Auth-Method": "plain", "Auth-Protocol": "imap", "Auth-User": "Alice@example.com", "Auth-Pass": "Tr0ub4dor%263x"},
+			want:    map[string]string{"Auth-Status": "OK", "Auth-Server": backend, "Auth-Port": "143", "Auth-User": "alice@example.com"},
+		},
+		{
+			name:    "login through an alternative domain",
+			headers: map[string]string{"Auth-Method": "login", "Auth-Protocol": "smtp", "Auth-User": "alice@example.org", "Auth-Pass": "Tr0ub4dor%263x"},
+			want:    map[string]string{"Auth-Status": "OK", "Auth-Port": "10025", "Auth-User": "alice@example.com"},
+		},
+		{
+			name:    "wrong password",
+			headers: map[string]string{"Auth-Method": "plain", "Auth-Protocol": "pop3", "Auth-User": "alice@example.com", "Auth-Pass": "wrong"},
+			want:    map[string]string{"Auth-Status": "Authentication credentials invalid", "Auth-Wait": failureWait, "Auth-Error-Code": ""},
+		},
+		{
+			name:    "wrong smtp password",
+			headers: map[string]string{"Auth-Method": "plain", "Auth-Protocol": "smtp", "Auth-User": "alice@example.com", "Auth-Pass": "wrong"},
+			want:    map[string]string{"Auth-Status": "Authentication credentials invalid", "Auth-Error-Code": "535 5.7.8"},
+		},
+		{
+			name:    "unsupported method",
+			headers: map[string]string{"Auth-Method": "cram-md5", "Auth-Protocol": "imap", "Auth-User": "alice@example.com", "Auth-Pass": "x"},
+			want:    map[string]string{"Auth-Status": "Unsupported authentication method"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/internal/auth/email", nil)
+			r.Header.Set("Client-Ip", "192.0.2.1")
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			for k, v := range tt.want {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	s, db := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	db.Close()
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status with the database closed = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestListenAndServeLoopbackOnly(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for _, addr := range []string{"0.0.0.0:0", "[::]:0", "192.0.2.1:8080", "mail.example.com:8080", "127.0.0.1"} {
+		err := s.ListenAndServe(context.Background(), addr, "")
+		if err == nil {
+			t.Errorf("ListenAndServe(%q) served, want an error", addr)
+		}
+	}
+}
@@ -15,10 +15,10 @@ type Manager struct {
 
 // ServiceStatus represents the status of a service
 type ServiceStatus struct {
-	Name    string
-	Running bool
-	Healthy bool
-	Status  string
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+	Healthy bool   `json:"healthy"`
+	Status  string `json:"status"`
 }
 
 // NewManager creates a new service manager
@@ -0,0 +1,98 @@
+package sieve
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// ScriptName is the auto-reply script in a user's mail home; dovecot runs
+// it before the user's own scripts (sieve_before2 in dovecot.conf)
+const ScriptName = "autoreply.sieve"
+
+// Mail files belong to the uid and gid dovecot delivers as, set by the
+// user_query in dovecot-sql.conf.ext
+const (
+	mailUID = 1000
+	mailGID = 1000
+)
+
+// Vacation returns the sieve script that sends r as an auto-reply. The
+// dates are checked when mail arrives, and each sender is answered at
+// most once every r.Days days. Spam and mail from lists and robots get
+// no reply.
+func Vacation(r *database.AutoReply) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Auto-reply for %s, written by mailstack; edits are overwritten\n", r.Email)
+	b.WriteString(`require ["vacation", "date", "relational"];` + "\n\n")
+
+	conditions := []string{`not header :contains "X-Spam" "Yes"`}
+	if r.Start != "" {
+		conditions = append(conditions, fmt.Sprintf(`currentdate :value "ge" "date" %s`, quote(r.Start)))
+	}
+	if r.End != "" {
+		conditions = append(conditions, fmt.Sprintf(`currentdate :value "le" "date" %s`, quote(r.End)))
+	}
+
+	fmt.Fprintf(&b, "if allof(%s) {\n", strings.Join(conditions, ",\n         "))
+	fmt.Fprintf(&b, "  vacation :days %d :subject %s\n    %s;\n", r.Days, quote(r.Subject), quote(r.Body))
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// quote returns s as a sieve quoted string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// Install writes script into the mail home directory, owned by the mail
+// user so that dovecot can compile it next to the script. A home that
+// does not exist yet is created, as dovecot would on first delivery.
+func Install(home string, script []byte) error {
+	var created []string
+	for dir := home; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		created = append(created, dir)
+	}
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", home, err)
+	}
+
+	path := filepath.Join(home, ScriptName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, script, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if os.Geteuid() == 0 {
+		for _, p := range append(created, tmp) {
+			if err := os.Chown(p, mailUID, mailGID); err != nil {
+				os.Remove(tmp)
+				return fmt.Errorf("failed to chown %s: %w", p, err)
+			}
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to install %s: %w", path, err)
+	}
+	return nil
+}
+
+// Uninstall removes the script and its compiled form from the mail home
+// directory. A missing script is not an error.
+func Uninstall(home string) error {
+	path := filepath.Join(home, ScriptName)
+	for _, p := range []string{path, strings.TrimSuffix(path, ".sieve") + ".svbin"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", p, err)
+		}
+	}
+	return nil
+}
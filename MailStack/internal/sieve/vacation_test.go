@@ -0,0 +1,115 @@
+package sieve
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{``, `""`},
+		{`Out of office`, `"Out of office"`},
+		{`Re: "urgent"`, `"Re: \"urgent\""`},
+		{`C:\mail`, `"C:\\mail"`},
+		{`\"`, `"\\\""`},
+		{"line one\nline two", "\"line one\nline two\""},
+		{`${name} stays literal`, `"${name} stays literal"`},
+	}
+
+	for _, tt := range tests {
+		if got := quote(tt.in); got != tt.want {
+			t.Errorf("quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVacation(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply database.AutoReply
+		want  string
+	}{
+		{
+			name:  "no dates",
+			reply: database.AutoReply{Email: "alice@example.com", Subject: "Away", Body: "Back soon.", Days: 7},
+			want: `# Auto-reply for alice@example.com, written by mailstack; edits are overwritten
+require ["vacation", "date", "relational"];
+
+if allof(not header :contains "X-Spam" "Yes") {
+  vacation :days 7 :subject "Away"
+    "Back soon.";
+}
+`,
+		},
+		{
+			name: "dates and quotes",
+			reply: database.AutoReply{Email: "alice@example.com", Subject: `Re: "holiday"`, Body: "Gone \\ fishing.\n\"Really.\"",
+				Start: "2026-07-01", End: "2026-07-31", Days: 1},
+			want: `# Auto-reply for alice@example.com, written by mailstack; edits are overwritten
+require ["vacation", "date", "relational"];
+
+if allof(not header :contains "X-Spam" "Yes",
+         currentdate :value "ge" "date" "2026-07-01",
+         currentdate :value "le" "date" "2026-07-31") {
+  vacation :days 1 :subject "Re: \"holiday\""
+    "Gone \\ fishing.
+\"Really.\"";
+}
+`,
+		},
+		{
+			name:  "end only",
+			reply: database.AutoReply{Email: "bob@example.com", Subject: "Left", Body: "Bye", End: "2026-12-31", Days: 3},
+			want: `# Auto-reply for bob@example.com, written by mailstack; edits are overwritten
+require ["vacation", "date", "relational"];
+
+if allof(not header :contains "X-Spam" "Yes",
+         currentdate :value "le" "date" "2026-12-31") {
+  vacation :days 3 :subject "Left"
+    "Bye";
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Vacation(&tt.reply)); got != tt.want {
+				t.Errorf("Vacation returned\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallUninstall(t *testing.T) {
+	home := filepath.Join(t.TempDir(), "example.com", "alice")
+	script := []byte("# test\n")
+
+	if err := Install(home, script); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(home, ScriptName))
+	if err != nil || string(got) != string(script) {
+		t.Fatalf("installed script = %q, %v; want %q", got, err, script)
+	}
+
+	compiled := filepath.Join(home, "autoreply.svbin")
+	if err := os.WriteFile(compiled, []byte("compiled"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Uninstall(home); err != nil {
+			t.Fatalf("Uninstall #%d: %v", i+1, err)
+		}
+	}
+	for _, p := range []string{filepath.Join(home, ScriptName), compiled} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s is still there: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,536 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/dkim"
+	"github.com/mailstack/mailstack/internal/installer"
+)
+
+// Action is what a change does, shown as its plan symbol
+type Action string
+
+// Plan actions
+const (
+	Create Action = "+"
+	Update Action = "~"
+	Delete Action = "-"
+)
+
+// Change is one step of a plan
+type Change struct {
+	Action  Action   `json:"action"`
+	Kind    string   `json:"kind"` // domain, user, alias, relay or dkim
+	Name    string   `json:"name"`
+	Details []string `json:"details,omitempty"` // field changes, "field: old → new"
+
+	apply     func(db *database.DB) error // database changes other than creates
+	applyFile func() error                // DKIM key changes, run after commit
+}
+
+// Plan is the set of changes that brings the database to a State
+type Plan struct {
+	Changes   []Change
+	Unmanaged []string // existing records not in the state, kept without prune
+
+	create *database.Dataset
+	config *config.Config
+	relays bool // relay domains change, so the transport map is rewritten
+}
+
+// Counts returns how many records the plan creates, updates and deletes
+func (p *Plan) Counts() (create, update, remove int) {
+	for _, c := range p.Changes {
+		switch c.Action {
+		case Create:
+			create++
+		case Update:
+			update++
+		case Delete:
+			remove++
+		}
+	}
+	return create, update, remove
+}
+
+// Compute compares st with the database and returns the changes needed.
+// With prune, records missing from st are deleted; mail directories are
+// never touched.
+func Compute(db *database.DB, cfg *config.Config, st *State, prune bool) (*Plan, error) {
+	current, err := db.Export()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{create: &database.Dataset{}, config: cfg}
+	var deletes []Change
+
+	// Domains
+	currentDomains := make(map[string]database.DomainRecord)
+	for _, d := range current.Domains {
+		currentDomains[d.Name] = d
+	}
+	wantDomains := make(map[string]bool)
+	for _, want := range st.Domains {
+		wantDomains[want.Name] = true
+
+		have, ok := currentDomains[want.Name]
+		if !ok {
+			plan.create.Domains = append(plan.create.Domains, want.DomainRecord)
+			plan.Changes = append(plan.Changes, Change{Action: Create, Kind: "domain", Name: want.Name})
+		} else if change, ok := diffDomain(have, want.DomainRecord); ok {
+			plan.Changes = append(plan.Changes, change)
+		}
+
+		if want.DKIMSelectors != nil {
+			changes, err := diffDKIM(cfg, want, prune)
+			if err != nil {
+				return nil, err
+			}
+			plan.Changes = append(plan.Changes, changes...)
+		}
+	}
+	for _, have := range current.Domains {
+		if wantDomains[have.Name] {
+			continue
+		}
+		if !prune {
+			plan.Unmanaged = append(plan.Unmanaged, "domain "+have.Name)
+			continue
+		}
+		name := have.Name
+		deletes = append(deletes, Change{
+			Action:  Delete,
+			Kind:    "domain",
+			Name:    name,
+			Details: []string{"mail directories are kept, DKIM keys are removed"},
+			apply:   func(db *database.DB) error { return db.DeleteDomainCascade(name, nil) },
+			applyFile: func() error {
+				_, err := dkim.Remove(name, cfg.DKIMPath)
+				return err
+			},
+		})
+	}
+
+	// Users
+	currentUsers := make(map[string]database.UserRecord)
+	for _, u := range current.Users {
+		currentUsers[u.Email] = u
+	}
+	wantUsers := make(map[string]bool)
+	for _, want := range st.Users {
+		wantUsers[want.Email] = true
+		if prune && !wantDomains[domainOf(want.Email)] {
+			return nil, fmt.Errorf("user %s: domain %s is not listed and would be pruned", want.Email, domainOf(want.Email))
+		}
+
+		have, ok := currentUsers[want.Email]
+		if !ok {
+			plan.create.Users = append(plan.create.Users, want)
+			plan.Changes = append(plan.Changes, Change{Action: Create, Kind: "user", Name: want.Email})
+			continue
+		}
+		change, ok, err := diffUser(have, want)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+	for _, have := range current.Users {
+		if wantUsers[have.Email] {
+			continue
+		}
+		if !prune {
+			plan.Unmanaged = append(plan.Unmanaged, "user "+have.Email)
+			continue
+		}
+		if !wantDomains[domainOf(have.Email)] {
+			continue // removed with its domain
+		}
+		email := have.Email
+		deletes = append(deletes, Change{
+			Action:  Delete,
+			Kind:    "user",
+			Name:    email,
+			Details: []string{"mailbox is kept"},
+			apply:   func(db *database.DB) error { return db.DeleteUser(email, nil) },
+		})
+	}
+
+	// Aliases
+	currentAliases := make(map[string]database.AliasRecord)
+	for _, a := range current.Aliases {
+		currentAliases[a.Email] = a
+	}
+	wantAliases := make(map[string]bool)
+	for _, want := range st.Aliases {
+		wantAliases[want.Email] = true
+		if prune && !wantDomains[domainOf(want.Email)] {
+			return nil, fmt.Errorf("alias %s: domain %s is not listed and would be pruned", want.Email, domainOf(want.Email))
+		}
+
+		have, ok := currentAliases[want.Email]
+		if !ok {
+			plan.create.Aliases = append(plan.create.Aliases, want)
+			plan.Changes = append(plan.Changes, Change{Action: Create, Kind: "alias", Name: want.Email})
+		} else if change, ok := diffAlias(have, want); ok {
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+	for _, have := range current.Aliases {
+		if wantAliases[have.Email] {
+			continue
+		}
+		if !prune {
+			plan.Unmanaged = append(plan.Unmanaged, "alias "+have.Email)
+			continue
+		}
+		if !wantDomains[domainOf(have.Email)] {
+			continue // removed with its domain
+		}
+		email := have.Email
+		deletes = append(deletes, Change{
+			Action: Delete,
+			Kind:   "alias",
+			Name:   email,
+			apply:  func(db *database.DB) error { return db.DeleteAlias(email) },
+		})
+	}
+
+	// Relays
+	relays, err := db.ListRelays()
+	if err != nil {
+		return nil, err
+	}
+	currentRelays := make(map[string]database.Relay)
+	for _, r := range relays {
+		currentRelays[r.Name] = r
+	}
+	wantRelays := make(map[string]bool)
+	for _, want := range st.Relays {
+		wantRelays[want.Name] = true
+
+		have, ok := currentRelays[want.Name]
+		if !ok {
+			want := want
+			plan.Changes = append(plan.Changes, Change{
+				Action: Create,
+				Kind:   "relay",
+				Name:   want.Name,
+				apply:  func(db *database.DB) error { return db.AddRelay(want.Name, want.Nexthop, want.Comment) },
+			})
+		} else if change, ok := diffRelay(have, want); ok {
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+	for _, have := range relays {
+		if wantRelays[have.Name] {
+			continue
+		}
+		if !prune {
+			plan.Unmanaged = append(plan.Unmanaged, "relay "+have.Name)
+			continue
+		}
+		name := have.Name
+		plan.Changes = append(plan.Changes, Change{
+			Action: Delete,
+			Kind:   "relay",
+			Name:   name,
+			apply:  func(db *database.DB) error { return db.DeleteRelay(name) },
+		})
+	}
+	for _, c := range plan.Changes {
+		if c.Kind == "relay" {
+			plan.relays = true
+		}
+	}
+
+	// Aliases go before users and users before domains
+	for i := len(deletes) - 1; i >= 0; i-- {
+		plan.Changes = append(plan.Changes, deletes[i])
+	}
+
+	// Check new records the way import would, against the database as it
+	// is once the deletes and updates ahead of them have run
+	var report *database.ImportReport
+	err = db.Transaction(func(tx *database.DB) error {
+		if err := plan.applyChanges(tx, Delete, Update); err != nil {
+			return err
+		}
+		report, err = tx.ValidateImport(plan.create)
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if err != errRollback {
+		return nil, err
+	}
+	if err := report.Err(); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// errRollback discards the transaction Compute checks the plan in
+var errRollback = errors.New("rollback")
+
+// Apply runs the plan: all database changes in one transaction, then,
+// once it has committed, the transport map when relays changed and the
+// DKIM key changes. Deletes run first so that records replacing them can
+// take over their addresses and their room under the domain limits.
+func (p *Plan) Apply(db *database.DB) error {
+	err := db.Transaction(func(tx *database.DB) error {
+		if err := p.applyChanges(tx, Delete, Update); err != nil {
+			return err
+		}
+		if _, err := tx.Import(p.create); err != nil {
+			return err
+		}
+		return p.applyChanges(tx, Create)
+	})
+	if err != nil {
+		return err
+	}
+
+	if p.relays {
+		relays, err := db.ListRelays()
+		if err != nil {
+			return err
+		}
+		if err := installer.New(p.config, false).WriteTransportMap(relays); err != nil {
+			return fmt.Errorf("relay domains were changed, but the transport map was kept as it was: %w", err)
+		}
+	}
+
+	for _, c := range p.Changes {
+		if c.applyFile == nil {
+			continue
+		}
+		if err := c.applyFile(); err != nil {
+			return fmt.Errorf("%s %s: %w", c.Kind, c.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyChanges runs the database changes of the given actions, all of the
+// first action before any of the next
+func (p *Plan) applyChanges(tx *database.DB, actions ...Action) error {
+	for _, action := range actions {
+		for _, c := range p.Changes {
+			if c.apply == nil || c.Action != action {
+				continue
+			}
+			if err := c.apply(tx); err != nil {
+				return fmt.Errorf("%s %s: %w", c.Kind, c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func diffDomain(have, want database.DomainRecord) (Change, bool) {
+	change := Change{Action: Update, Kind: "domain", Name: want.Name}
+	var update database.DomainUpdate
+
+	if have.MaxUsers != want.MaxUsers {
+		change.Details = append(change.Details, fmt.Sprintf("max_users: %d → %d", have.MaxUsers, want.MaxUsers))
+		update.MaxUsers = &want.MaxUsers
+	}
+	if have.MaxAliases != want.MaxAliases {
+		change.Details = append(change.Details, fmt.Sprintf("max_aliases: %d → %d", have.MaxAliases, want.MaxAliases))
+		update.MaxAliases = &want.MaxAliases
+	}
+	if have.MaxQuota != want.MaxQuota {
+		change.Details = append(change.Details, fmt.Sprintf("max_quota_bytes: %d → %d", have.MaxQuota, want.MaxQuota))
+		update.MaxQuota = &want.MaxQuota
+	}
+	if enabled := database.EnabledOr(want.Enabled); want.Enabled != nil && database.EnabledOr(have.Enabled) != enabled {
+		change.Details = append(change.Details, fmt.Sprintf("enabled: %t → %t", !enabled, enabled))
+		update.Enabled = &enabled
+	}
+
+	if len(change.Details) == 0 {
+		return change, false
+	}
+	change.apply = func(db *database.DB) error { return db.UpdateDomain(want.Name, update) }
+	return change, true
+}
+
+// diffUser compares attributes and, when the state gives one, the password
+// hash. A plain password in the state is only used to create the user.
+func diffUser(have, want database.UserRecord) (Change, bool, error) {
+	change := Change{Action: Update, Kind: "user", Name: want.Email}
+	var update database.UserUpdate
+	hash := ""
+
+	// Like the flags below, a display name left out of the state is kept
+	if want.DisplayName != nil && database.StringOr(have.DisplayName) != *want.DisplayName {
+		change.Details = append(change.Details, fmt.Sprintf("display_name: %q → %q", database.StringOr(have.DisplayName), *want.DisplayName))
+		update.DisplayName = want.DisplayName
+	}
+	if want.Quota != nil && *have.Quota != *want.Quota {
+		change.Details = append(change.Details, fmt.Sprintf("quota_bytes: %d → %d", *have.Quota, *want.Quota))
+		update.Quota = want.Quota
+	}
+	// Flags left out of the state keep their current value
+	flags := []struct {
+		name       string
+		given      bool
+		have, want bool
+		field      **bool
+	}{
+		{"enabled", want.Enabled != nil, database.EnabledOr(have.Enabled), database.EnabledOr(want.Enabled), &update.Enabled},
+		{"enable_imap", want.EnableIMAP != nil, database.EnabledOr(have.EnableIMAP), database.EnabledOr(want.EnableIMAP), &update.EnableIMAP},
+		{"enable_pop", want.EnablePOP != nil, database.EnabledOr(have.EnablePOP), database.EnabledOr(want.EnablePOP), &update.EnablePOP},
+		{"global_admin", true, have.GlobalAdmin, want.GlobalAdmin, &update.GlobalAdmin},
+		{"force_password_change", true, have.ForcePasswordChange, want.ForcePasswordChange, &update.ForcePasswordChange},
+	}
+	for _, flag := range flags {
+		if flag.given && flag.have != flag.want {
+			value := flag.want
+			change.Details = append(change.Details, fmt.Sprintf("%s: %t → %t", flag.name, flag.have, value))
+			*flag.field = &value
+		}
+	}
+
+	if want.PasswordHash != "" {
+		normalized, err := database.NormalizeHash(want.PasswordHash)
+		if err != nil {
+			return change, false, fmt.Errorf("user %s: %w", want.Email, err)
+		}
+		if normalized != have.PasswordHash {
+			change.Details = append(change.Details, "password_hash: (changed)")
+			hash = normalized
+		}
+	}
+
+	if len(change.Details) == 0 {
+		return change, false, nil
+	}
+	attributes := update != (database.UserUpdate{})
+	// A new password clears force_password_change, so it goes first
+	change.apply = func(db *database.DB) error {
+		if hash != "" {
+			if err := db.SetPasswordHash(want.Email, hash); err != nil {
+				return err
+			}
+		}
+		if attributes {
+			return db.UpdateUser(want.Email, update)
+		}
+		return nil
+	}
+	return change, true, nil
+}
+
+func diffAlias(have, want database.AliasRecord) (Change, bool) {
+	change := Change{Action: Update, Kind: "alias", Name: want.Email}
+	var update database.AliasUpdate
+
+	if have.Destination != want.Destination {
+		change.Details = append(change.Details, fmt.Sprintf("destination: %s → %s", have.Destination, want.Destination))
+		update.Destination = &want.Destination
+	}
+	if enabled := database.EnabledOr(want.Enabled); want.Enabled != nil && database.EnabledOr(have.Enabled) != enabled {
+		change.Details = append(change.Details, fmt.Sprintf("enabled: %t → %t", !enabled, enabled))
+		update.Enabled = &enabled
+	}
+	if want.Comment != nil && database.StringOr(have.Comment) != *want.Comment {
+		change.Details = append(change.Details, fmt.Sprintf("comment: %q → %q", database.StringOr(have.Comment), *want.Comment))
+		update.Comment = want.Comment
+	}
+
+	if len(change.Details) == 0 {
+		return change, false
+	}
+	change.apply = func(db *database.DB) error { return db.UpdateAlias(want.Email, update) }
+	return change, true
+}
+
+// diffDKIM generates missing keys for the listed selectors and, with
+// prune, removes keys of other selectors
+func diffDKIM(cfg *config.Config, want Domain, prune bool) ([]Change, error) {
+	existing, err := dkim.Selectors(want.Name, cfg.DKIMPath)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool)
+	for _, selector := range existing {
+		have[selector] = true
+	}
+
+	var changes []Change
+	for _, selector := range want.DKIMSelectors {
+		if have[selector] {
+			continue
+		}
+		domain, selector := want.Name, selector
+		changes = append(changes, Change{
+			Action: Create,
+			Kind:   "dkim",
+			Name:   domain + "/" + selector,
+			applyFile: func() error {
+				_, _, err := dkim.Generate(domain, selector, 2048, cfg.DKIMPath)
+				return err
+			},
+		})
+	}
+
+	if prune {
+		wanted := make(map[string]bool)
+		for _, selector := range want.DKIMSelectors {
+			wanted[selector] = true
+		}
+		sort.Strings(existing)
+		for _, selector := range existing {
+			if wanted[selector] {
+				continue
+			}
+			keyPath := dkim.KeyPath(want.Name, selector, cfg.DKIMPath)
+			changes = append(changes, Change{
+				Action:    Delete,
+				Kind:      "dkim",
+				Name:      want.Name + "/" + selector,
+				applyFile: func() error { return os.Remove(keyPath) },
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+func diffRelay(have database.Relay, want Relay) (Change, bool) {
+	change := Change{Action: Update, Kind: "relay", Name: want.Name}
+	var update database.RelayUpdate
+
+	if have.Nexthop != want.Nexthop {
+		change.Details = append(change.Details, fmt.Sprintf("nexthop: %q → %q", have.Nexthop, want.Nexthop))
+		update.Nexthop = &want.Nexthop
+	}
+	if have.Comment != want.Comment {
+		change.Details = append(change.Details, fmt.Sprintf("comment: %q → %q", have.Comment, want.Comment))
+		update.Comment = &want.Comment
+	}
+
+	if len(change.Details) == 0 {
+		return change, false
+	}
+	change.apply = func(db *database.DB) error { return db.UpdateRelay(want.Name, update) }
+	return change, true
+}
+
+func domainOf(email string) string {
+	_, domain, _ := strings.Cut(email, "@")
+	return domain
+}
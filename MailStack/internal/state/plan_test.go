@@ -0,0 +1,259 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+	"github.com/mailstack/mailstack/internal/database/databasetest"
+	"github.com/mailstack/mailstack/internal/dkim"
+)
+
+// newTestEnv returns a migrated SQLite database holding ds and a config
+// keeping DKIM keys in a temporary directory
+func newTestEnv(t *testing.T, ds *database.Dataset) (*database.DB, *config.Config) {
+	t.Helper()
+	return databasetest.NewDB(t, ds), &config.Config{DKIMPath: filepath.Join(t.TempDir(), "{domain}.{selector}.key")}
+}
+
+// baseDataset is the database the plans are computed against
+func baseDataset() *database.Dataset {
+	return &database.Dataset{
+		Domains: []database.DomainRecord{{Name: "example.com", MaxUsers: 2}, {Name: "example.net"}},
+		Users: []database.UserRecord{
+			{Email: "alice@example.com", DisplayName: database.Ptr("Alice"), Password: databasetest.Password, Quota: database.Ptr(int64(1 << 20))},
+			{Email: "bob@example.com", Password: databasetest.Password},
+			{Email: "carol@example.net", Password: databasetest.Password},
+		},
+		Aliases: []database.AliasRecord{{Email: "info@example.com", Destination: "alice@example.com", Comment: database.Ptr("front desk")}},
+	}
+}
+
+// baseState lists exactly what baseDataset holds
+func baseState() *State {
+	ds := baseDataset()
+	st := &State{Users: ds.Users, Aliases: ds.Aliases}
+	for _, d := range ds.Domains {
+		st.Domains = append(st.Domains, Domain{DomainRecord: d})
+	}
+	return st
+}
+
+// describe renders changes as "<action> <kind> <name>[: details]"
+func describe(changes []Change) []string {
+	var lines []string
+	for _, c := range changes {
+		line := fmt.Sprintf("%s %s %s", c.Action, c.Kind, c.Name)
+		if len(c.Details) > 0 {
+			line += ": " + strings.Join(c.Details, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name      string
+		edit      func(st *State)
+		prune     bool
+		want      []string
+		unmanaged []string
+		wantErr   string
+	}{
+		{
+			name: "unchanged",
+			edit: func(st *State) {},
+		},
+		{
+			name: "left-out quota and flags are kept",
+			edit: func(st *State) {
+				st.Users[0].Quota = nil
+				st.Users[0].Enabled = nil
+			},
+		},
+		{
+			name: "left-out display name and comment are kept",
+			edit: func(st *State) {
+				st.Users[0].DisplayName = nil
+				st.Aliases[0].Comment = nil
+			},
+		},
+		{
+			name: "empty display name and comment clear them",
+			edit: func(st *State) {
+				st.Users[0].DisplayName = database.Ptr("")
+				st.Aliases[0].Comment = database.Ptr("")
+			},
+			want: []string{
+				`~ user alice@example.com: display_name: "Alice" → ""`,
+				`~ alias info@example.com: comment: "front desk" → ""`,
+			},
+		},
+		{
+			name: "updates",
+			edit: func(st *State) {
+				st.Domains[0].MaxUsers = 3
+				st.Users[0].Quota = database.Ptr(int64(2 << 20))
+				st.Users[1].EnablePOP = database.Ptr(false)
+				st.Users[1].DisplayName = database.Ptr("Bob")
+				st.Aliases[0].Comment = database.Ptr("reception")
+			},
+			want: []string{
+				"~ domain example.com: max_users: 2 → 3",
+				"~ user alice@example.com: quota_bytes: 1048576 → 2097152",
+				`~ user bob@example.com: display_name: "" → "Bob", enable_pop: true → false`,
+				`~ alias info@example.com: comment: "front desk" → "reception"`,
+			},
+		},
+		{
+			name: "creates",
+			edit: func(st *State) {
+				st.Domains = append(st.Domains, Domain{DomainRecord: database.DomainRecord{Name: "example.org"}, DKIMSelectors: []string{"mail"}})
+				st.Users = append(st.Users, database.UserRecord{Email: "dave@example.org", Password: databasetest.Password})
+				st.Aliases = append(st.Aliases, database.AliasRecord{Email: "sales@example.org", Destination: "dave@example.org"})
+			},
+			want: []string{
+				"+ domain example.org",
+				"+ dkim example.org/mail",
+				"+ user dave@example.org",
+				"+ alias sales@example.org",
+			},
+		},
+		{
+			name: "unlisted records without prune",
+			edit: func(st *State) {
+				st.Domains = st.Domains[:1]
+				st.Users = st.Users[:1]
+				st.Aliases = nil
+			},
+			unmanaged: []string{
+				"domain example.net",
+				"user bob@example.com",
+				"user carol@example.net",
+				"alias info@example.com",
+			},
+		},
+		{
+			name: "prune deletes aliases, then users, then domains",
+			edit: func(st *State) {
+				st.Domains = st.Domains[:1]
+				st.Users = st.Users[:1]
+				st.Aliases = nil
+			},
+			prune: true,
+			want: []string{
+				"- alias info@example.com",
+				"- user bob@example.com: mailbox is kept",
+				"- domain example.net: mail directories are kept, DKIM keys are removed",
+			},
+		},
+		{
+			name: "prune keeps users of listed domains only",
+			edit: func(st *State) {
+				st.Domains = st.Domains[:1]
+			},
+			prune:   true,
+			wantErr: "domain example.net is not listed and would be pruned",
+		},
+		{
+			name: "new user over the domain limit",
+			edit: func(st *State) {
+				st.Users = append(st.Users, database.UserRecord{Email: "dave@example.com", Password: databasetest.Password})
+			},
+			wantErr: "validation error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cfg := newTestEnv(t, baseDataset())
+			st := baseState()
+			tt.edit(st)
+
+			plan, err := Compute(db, cfg, st, tt.prune)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Compute = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compute: %v", err)
+			}
+
+			if got := describe(plan.Changes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+			}
+			if !reflect.DeepEqual(plan.Unmanaged, tt.unmanaged) {
+				t.Errorf("unmanaged = %q, want %q", plan.Unmanaged, tt.unmanaged)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Run("rename under the domain limit", func(t *testing.T) {
+		db, cfg := newTestEnv(t, baseDataset())
+		st := baseState()
+		// example.com is full, so bob has to go before bobby can be created
+		st.Users[1] = database.UserRecord{Email: "bobby@example.com", Password: databasetest.Password}
+
+		plan, err := Compute(db, cfg, st, true)
+		if err != nil {
+			t.Fatalf("Compute: %v", err)
+		}
+		if err := plan.Apply(db); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+
+		if _, err := db.GetUser("bobby@example.com"); err != nil {
+			t.Errorf("renamed user: %v", err)
+		}
+		if _, err := db.GetUser("bob@example.com"); err == nil {
+			t.Error("old user is still there")
+		}
+	})
+
+	t.Run("pruned domain loses its DKIM keys", func(t *testing.T) {
+		db, cfg := newTestEnv(t, baseDataset())
+		if _, _, err := dkim.Generate("example.net", "mail", 1024, cfg.DKIMPath); err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		st := baseState()
+		st.Domains = st.Domains[:1]
+		st.Users = st.Users[:2]
+		st.Domains[0].DKIMSelectors = []string{"mail"}
+
+		plan, err := Compute(db, cfg, st, true)
+		if err != nil {
+			t.Fatalf("Compute: %v", err)
+		}
+		if err := plan.Apply(db); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+
+		if _, err := db.GetDomain("example.net"); err == nil {
+			t.Error("pruned domain is still there")
+		}
+		if selectors, err := dkim.Selectors("example.net", cfg.DKIMPath); err != nil || len(selectors) != 0 {
+			t.Errorf("pruned domain keys = %v, %v; want none", selectors, err)
+		}
+		if selectors, err := dkim.Selectors("example.com", cfg.DKIMPath); err != nil || !reflect.DeepEqual(selectors, []string{"mail"}) {
+			t.Errorf("listed domain keys = %v, %v; want [mail]", selectors, err)
+		}
+
+		// Applying the state again has nothing left to do
+		plan, err = Compute(db, cfg, st, true)
+		if err != nil {
+			t.Fatalf("Compute: %v", err)
+		}
+		if len(plan.Changes) != 0 {
+			t.Errorf("second plan has changes: %q", describe(plan.Changes))
+		}
+	})
+}
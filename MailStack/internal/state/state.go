@@ -0,0 +1,123 @@
+package state
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+// State is the desired set of accounts read from a state file. Fields
+// left out take their defaults, e.g. a user without "enabled" is enabled.
+type State struct {
+	Domains []Domain               `yaml:"domains"`
+	Users   []database.UserRecord  `yaml:"users"`
+	Aliases []database.AliasRecord `yaml:"aliases"`
+	Relays  []Relay                `yaml:"relays"`
+}
+
+// Domain is a desired domain. DKIM keys are only managed for domains that
+// list dkim_selectors.
+type Domain struct {
+	database.DomainRecord `yaml:",inline"`
+	DKIMSelectors         []string `yaml:"dkim_selectors,omitempty"`
+}
+
+// Relay is a desired relay domain; without a nexthop its mail goes to
+// the domain's MX hosts
+type Relay struct {
+	Name    string `yaml:"name"`
+	Nexthop string `yaml:"nexthop,omitempty"`
+	Comment string `yaml:"comment,omitempty"`
+}
+
+// Load reads a YAML (or JSON) state file, rejecting unknown keys
+func Load(path string) (*State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	defer f.Close()
+
+	var st State
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&st); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+
+	if err := st.validate(); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	return &st, nil
+}
+
+// validate catches duplicates, which the database checks cannot see
+// for records that already exist
+func (st *State) validate() error {
+	seen := make(map[string]bool)
+	for _, d := range st.Domains {
+		if d.Name == "" {
+			return fmt.Errorf("domain without a name")
+		}
+		if seen["domain:"+d.Name] {
+			return fmt.Errorf("domain %s is listed twice", d.Name)
+		}
+		seen["domain:"+d.Name] = true
+
+		selectors := make(map[string]bool)
+		for _, selector := range d.DKIMSelectors {
+			if selector == "" || selectors[selector] {
+				return fmt.Errorf("domain %s: empty or duplicate DKIM selector %q", d.Name, selector)
+			}
+			selectors[selector] = true
+		}
+	}
+
+	for _, u := range st.Users {
+		if u.Email == "" {
+			return fmt.Errorf("user without an email")
+		}
+		if seen["address:"+u.Email] {
+			return fmt.Errorf("address %s is listed twice", u.Email)
+		}
+		seen["address:"+u.Email] = true
+	}
+	for i := range st.Aliases {
+		a := &st.Aliases[i]
+		if a.Email == "" {
+			return fmt.Errorf("alias without an email")
+		}
+		// Catch-alls are stored as "%@domain", destinations normalized
+		a.Email = database.AliasKey(a.Email)
+		destination, err := database.NormalizeDestinations(a.Destination)
+		if err != nil {
+			return fmt.Errorf("alias %s: %w", a.Email, err)
+		}
+		a.Destination = destination
+		if seen["address:"+a.Email] {
+			return fmt.Errorf("address %s is listed twice", a.Email)
+		}
+		seen["address:"+a.Email] = true
+	}
+
+	for i := range st.Relays {
+		r := &st.Relays[i]
+		if r.Name == "" {
+			return fmt.Errorf("relay without a name")
+		}
+		if seen["domain:"+r.Name] {
+			return fmt.Errorf("domain %s is listed twice", r.Name)
+		}
+		seen["domain:"+r.Name] = true
+		nexthop, err := database.NormalizeNexthop(r.Nexthop)
+		if err != nil {
+			return fmt.Errorf("relay %s: %w", r.Name, err)
+		}
+		r.Nexthop = nexthop
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"syscall"
 )
 
 // CreateUser creates a system user
@@ -136,11 +137,71 @@ func IsRoot() bool {
 	return os.Geteuid() == 0
 }
 
-// WriteFile writes content to a file with specific permissions
+// WriteFile atomically writes content to a file. An existing file keeps
+// its permissions, owner and group, so that files set up for a daemon stay
+// readable by it and secrets stay private; a new file gets mode.
 func WriteFile(path string, content []byte, mode os.FileMode) error {
-	if err := os.WriteFile(path, content, mode); err != nil {
+	uid, gid := -1, -1
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			if int(st.Uid) != os.Geteuid() {
+				uid = int(st.Uid)
+			}
+			if int(st.Gid) != os.Getegid() {
+				gid = int(st.Gid)
+			}
+		}
+	}
+	return WriteFileAs(path, content, mode, uid, gid)
+}
+
+// WriteFileAs atomically writes content to a file with the given
+// permissions, owner and group; -1 keeps the owner or group of the process.
+// The content goes to a temporary file in the same directory, is fsynced
+// and then renamed over path, so readers never see a partial file.
+func WriteFileAs(path string, content []byte, mode os.FileMode, uid, gid int) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
 		return fmt.Errorf("failed to write file %s: %w", path, err)
 	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	if uid != -1 || gid != -1 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to set owner of %s: %w", path, err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", path, err)
+	}
+
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
 	return nil
 }
 
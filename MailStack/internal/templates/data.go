@@ -0,0 +1,219 @@
+package templates
+
+import (
+	"strings"
+
+	"github.com/mailstack/mailstack/internal/config"
+)
+
+// Data is the view of the configuration that templates render against.
+// Because it is a struct, a reference to a field that does not exist fails
+// at execution time instead of silently rendering "<no value>".
+type Data struct {
+	// Domain settings
+	Domain       string
+	Hostname     string
+	Hostnames    []string
+	HostnamesStr string // Hostnames joined with ","
+	Postmaster   string
+
+	// Mail settings
+	MessageSizeLimit   int64
+	MessageRateLimit   string
+	DefaultQuota       int64
+	RecipientDelimiter string
+	DKIMSelector       string
+	RelayHost          string
+	RelayUser          string
+	RelayPassword      string
+
+	// Network settings
+	Subnet        string
+	Subnet6       string
+	BindIPv4      string
+	BindIPv6      string
+	RelayNetworks string
+	RelayNets     string
+	RealIPHeader  string
+	RealIPFrom    string
+
+	// TLS settings
+	TLSFlavor     string
+	TLS           []string // certificate/key paths for nginx
+	TLS443        bool
+	TLSError      bool
+	TLSPermissive bool
+
+	// Web paths
+	AdminPath       string
+	WebmailPath     string
+	WebAdmin        string
+	WebWebmail      string
+	WebAPI          string
+	Sitename        string
+	WebrootRedirect string
+
+	// Data paths, both grouped and flattened
+	Paths         config.PathsConfig
+	DataPath      string
+	MailPath      string
+	DKIMPath      string
+	QueuePath     string
+	FilterPath    string
+	CertsPath     string
+	OverridesPath string
+
+	// Service addresses
+	FrontAddress    string
+	AdminAddress    string
+	AntispamAddress string
+	WebmailAddress  string
+	WebdavAddress   string
+	RedisAddress    string
+	Resolver        string
+
+	// Security keys
+	SecretKey        string
+	VaultToken       string
+	RoundcubeKey     string
+	SnuffleupagusKey string
+
+	// Database, as postfix and dovecot connect to it
+	DBDriver   string // sqlite, mysql or pgsql
+	DBPath     string // sqlite only
+	DBHost     string
+	DBPort     int
+	DBName     string
+	DBUser     string
+	DBPassword string
+	DBDsnw     string
+
+	// Webmail settings
+	Webmail                  string
+	Plugins                  string
+	Includes                 []string
+	PermanentSessionLifetime int64
+	FullTextSearch           bool
+
+	// Additional settings
+	Timezone    string
+	MaxFilesize int64 // in MB
+
+	// Port and protocol settings
+	Port80           bool
+	ProxyProtocol25  bool
+	ProxyProtocol80  bool
+	ProxyProtocol443 bool
+
+	// Feature flags derived from the configuration
+	Admin           bool // an admin account is configured
+	API             bool
+	EnableAntivirus bool
+	EnableWebmail   bool
+	EnableFetchmail bool
+	EnableWebdav    bool
+	EnableOletools  bool
+	Webdav          bool
+}
+
+// NewData builds the template view of a configuration
+func NewData(cfg *config.Config) *Data {
+	hostnames := cfg.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = []string{cfg.Hostname}
+	}
+
+	return &Data{
+		Domain:       cfg.Domain,
+		Hostname:     cfg.Hostname,
+		Hostnames:    hostnames,
+		HostnamesStr: strings.Join(hostnames, ","),
+		Postmaster:   cfg.Postmaster,
+
+		MessageSizeLimit:   cfg.Mail.MessageSizeLimit,
+		MessageRateLimit:   cfg.Mail.MessageRateLimit,
+		DefaultQuota:       cfg.Mail.DefaultQuota,
+		RecipientDelimiter: cfg.Mail.RecipientDelimiter,
+		DKIMSelector:       cfg.Mail.DKIMSelector,
+		RelayHost:          cfg.Mail.RelayHost,
+		RelayUser:          cfg.Mail.RelayUser,
+		RelayPassword:      cfg.Mail.RelayPassword,
+
+		Subnet:        cfg.Network.Subnet,
+		Subnet6:       cfg.Network.Subnet6,
+		BindIPv4:      cfg.Network.BindIPv4,
+		BindIPv6:      cfg.Network.BindIPv6,
+		RelayNetworks: cfg.Network.RelayNetworks,
+		RelayNets:     cfg.RelayNets,
+		RealIPHeader:  cfg.RealIPHeader,
+		RealIPFrom:    cfg.RealIPFrom,
+
+		TLSFlavor:     cfg.TLS.Flavor,
+		TLS:           cfg.TLS.TLS,
+		TLS443:        cfg.TLS443,
+		TLSError:      cfg.TLSError,
+		TLSPermissive: cfg.TLSPermissive,
+
+		AdminPath:       cfg.Web.AdminPath,
+		WebmailPath:     cfg.Web.WebmailPath,
+		WebAdmin:        cfg.Web.WebAdmin,
+		WebWebmail:      cfg.Web.WebWebmail,
+		WebAPI:          cfg.Web.WebAPI,
+		Sitename:        cfg.Web.Sitename,
+		WebrootRedirect: cfg.WebrootRedirect,
+
+		Paths:         cfg.Paths,
+		DataPath:      cfg.Paths.Data,
+		MailPath:      cfg.Paths.Mail,
+		DKIMPath:      cfg.Paths.DKIM,
+		QueuePath:     cfg.Paths.Queue,
+		FilterPath:    cfg.Paths.Filter,
+		CertsPath:     cfg.Paths.Certs,
+		OverridesPath: cfg.Paths.Overrides,
+
+		FrontAddress:    cfg.FrontAddress,
+		AdminAddress:    cfg.AdminAddress,
+		AntispamAddress: cfg.AntispamAddress,
+		WebmailAddress:  cfg.WebmailAddress,
+		WebdavAddress:   cfg.WebdavAddress,
+		RedisAddress:    cfg.RedisAddress,
+		Resolver:        cfg.Resolver,
+
+		SecretKey:        cfg.SecretKey,
+		VaultToken:       cfg.VaultToken(),
+		RoundcubeKey:     cfg.RoundcubeKey,
+		SnuffleupagusKey: cfg.SnuffleupagusKey,
+
+		DBDriver:   cfg.DatabaseDriver(),
+		DBPath:     cfg.DatabasePath(),
+		DBHost:     cfg.Database.Host,
+		DBPort:     cfg.Database.Port,
+		DBName:     cfg.Database.Name,
+		DBUser:     cfg.Database.User,
+		DBPassword: cfg.Database.Password,
+		DBDsnw:     cfg.Database.DBDsnw,
+
+		Webmail:                  cfg.Webmail,
+		Plugins:                  cfg.Plugins,
+		Includes:                 cfg.Includes,
+		PermanentSessionLifetime: int64(cfg.PermanentSessionLifetime),
+		FullTextSearch:           cfg.FullTextSearch,
+
+		Timezone:    cfg.Timezone,
+		MaxFilesize: int64(cfg.MaxFilesize),
+
+		Port80:           cfg.Port80,
+		ProxyProtocol25:  cfg.ProxyProtocol25,
+		ProxyProtocol80:  cfg.ProxyProtocol80,
+		ProxyProtocol443: cfg.ProxyProtocol443,
+
+		Admin:           cfg.Admin.Email != "",
+		API:             cfg.API,
+		EnableAntivirus: cfg.Services.Antivirus,
+		EnableWebmail:   WebmailEnabled(cfg),
+		EnableFetchmail: cfg.Services.Fetchmail,
+		EnableWebdav:    cfg.Services.Webdav,
+		EnableOletools:  cfg.EnableOletools,
+		Webdav:          cfg.Services.Webdav,
+	}
+}
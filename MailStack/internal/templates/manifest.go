@@ -0,0 +1,161 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mailstack/mailstack/internal/config"
+)
+
+// Target maps an embedded template to the file it is rendered into
+type Target struct {
+	Template string // path inside templatesFS
+	Output   string // absolute path on disk
+	Service  string // systemd unit to reload when the file changes, if any
+}
+
+// Manifest returns every template enabled by the configuration, grouped
+// by component in the order they should be written
+func Manifest(cfg *config.Config) []Target {
+	targets := []Target{
+		// Postfix
+		{"templates/postfix/main.cf", "/etc/postfix/main.cf", "postfix"},
+		{"templates/postfix/master.cf", "/etc/postfix/master.cf", "postfix"},
+		{"templates/postfix/sasl_passwd", "/etc/postfix/sasl_passwd", "postfix"},
+		{"templates/postfix/outclean_header_filter.cf", "/etc/postfix/outclean_header_filter.cf", "postfix"},
+		{"templates/postfix/mta-sts-daemon.yml", "/etc/mta-sts-daemon.yml", ""},
+		{"templates/postfix/logrotate.conf", "/etc/logrotate.d/postfix", ""},
+		{"templates/postfix/sql-virtual-mailbox-domains.cf", "/etc/postfix/sql-virtual-mailbox-domains.cf", "postfix"},
+		{"templates/postfix/sql-virtual-mailbox-maps.cf", "/etc/postfix/sql-virtual-mailbox-maps.cf", "postfix"},
+		{"templates/postfix/sql-virtual-forward-maps.cf", "/etc/postfix/sql-virtual-forward-maps.cf", "postfix"},
+		{"templates/postfix/sql-virtual-alias-maps.cf", "/etc/postfix/sql-virtual-alias-maps.cf", "postfix"},
+		{"templates/postfix/sql-sender-login-maps.cf", "/etc/postfix/sql-sender-login-maps.cf", "postfix"},
+		{"templates/postfix/sql-relay-domains.cf", "/etc/postfix/sql-relay-domains.cf", "postfix"},
+
+		// Dovecot
+		{"templates/dovecot/dovecot.conf", "/etc/dovecot/dovecot.conf", "dovecot"},
+		{"templates/dovecot/auth.conf", "/etc/dovecot/conf.d/auth.conf", "dovecot"},
+		{"templates/dovecot/dovecot-sql.conf.ext", "/etc/dovecot/dovecot-sql.conf.ext", "dovecot"},
+		{"templates/dovecot/dovecot-sql-tokens.conf.ext", "/etc/dovecot/dovecot-sql-tokens.conf.ext", "dovecot"},
+		{"templates/dovecot/report-spam.sieve", "/etc/dovecot/report-spam.sieve", "dovecot"},
+		{"templates/dovecot/report-ham.sieve", "/etc/dovecot/report-ham.sieve", "dovecot"},
+		{"templates/dovecot/spam.script", "/etc/dovecot/spam.script", "dovecot"},
+		{"templates/dovecot/ham.script", "/etc/dovecot/ham.script", "dovecot"},
+	}
+
+	// Rspamd
+	rspamdFiles := []string{
+		"antivirus.conf",
+		"arc.conf",
+		"classifier-bayes.conf",
+		"composites.conf",
+		"dkim_signing.conf",
+		"external_services.conf",
+		"external_services_group.conf",
+		"forbidden_file_extension.map",
+		"force_actions.conf",
+		"fuzzy_check.conf",
+		"headers_group.conf",
+		"history_redis.conf",
+		"local_subnet.map",
+		"metrics.conf",
+		"milter_headers.conf",
+		"multimap.conf",
+		"redis.conf",
+		"whitelist.conf",
+		"options.inc",
+		"logging.inc",
+		"worker-controller.inc",
+		"worker-fuzzy.inc",
+		"worker-normal.inc",
+		"worker-proxy.inc",
+	}
+	for _, name := range rspamdFiles {
+		targets = append(targets, Target{
+			Template: "templates/rspamd/" + name,
+			Output:   "/etc/rspamd/local.d/" + name,
+			Service:  "rspamd",
+		})
+	}
+
+	// Nginx
+	targets = append(targets,
+		Target{"templates/nginx/nginx.conf", "/etc/nginx/nginx.conf", "nginx"},
+		Target{"templates/nginx/proxy.conf", "/etc/nginx/proxy.conf", "nginx"},
+		Target{"templates/nginx/tls.conf", "/etc/nginx/tls.conf", "nginx"},
+	)
+
+	// Webmail
+	if WebmailEnabled(cfg) {
+		targets = append(targets,
+			Target{"templates/webmails/nginx-webmail.conf", "/etc/nginx/sites-available/webmail.conf", "nginx"},
+			Target{"templates/webmails/php-webmail.conf", "/etc/php/8.1/fpm/pool.d/webmail.conf", "php8.1-fpm"},
+			Target{"templates/webmails/php.ini", "/etc/php/8.1/fpm/conf.d/99-mailstack.ini", "php8.1-fpm"},
+			Target{"templates/webmails/snuffleupagus.rules", "/etc/snuffleupagus.rules", "php8.1-fpm"},
+		)
+
+		switch cfg.Webmail {
+		case "roundcube":
+			targets = append(targets,
+				Target{"templates/webmails/roundcube/config.inc.php", "/var/www/roundcube/config/config.inc.php", ""},
+				Target{"templates/webmails/roundcube/config.inc.carddav.php", "/var/www/roundcube/config/config.inc.carddav.php", ""},
+			)
+		case "snappymail":
+			targets = append(targets,
+				Target{"templates/webmails/snappymail/application.ini", "/var/www/snappymail/data/_data_/_default_/configs/application.ini", ""},
+				Target{"templates/webmails/snappymail/default.json", "/var/www/snappymail/data/_data_/_default_/domains/default.json", ""},
+			)
+		}
+	}
+
+	return targets
+}
+
+// secretFiles hold passwords or keys and are created readable by root only
+// (or root's group); files that already exist keep their permissions
+var secretFiles = map[string]os.FileMode{
+	"/etc/postfix/sasl_passwd":                    0600,
+	"/etc/postfix/sql-virtual-mailbox-domains.cf": 0640,
+	"/etc/postfix/sql-virtual-mailbox-maps.cf":    0640,
+	"/etc/postfix/sql-virtual-forward-maps.cf":    0640,
+	"/etc/postfix/sql-virtual-alias-maps.cf":      0640,
+	"/etc/postfix/sql-sender-login-maps.cf":       0640,
+	"/etc/postfix/sql-relay-domains.cf":           0640,
+	"/etc/dovecot/dovecot-sql.conf.ext":           0640,
+	"/etc/dovecot/dovecot-sql-tokens.conf.ext":    0640,
+	"/etc/rspamd/local.d/dkim_signing.conf":       0640,
+	"/etc/rspamd/local.d/arc.conf":                0640,
+}
+
+// FileMode returns the permissions a target is created with
+func FileMode(output string) os.FileMode {
+	if mode, ok := secretFiles[output]; ok {
+		return mode
+	}
+	return 0644
+}
+
+// TransportMap is the postfix transport table, generated from the relay
+// domains
+const TransportMap = "/etc/postfix/transport.map"
+
+// PostfixMaps returns the LMDB map sources that postmap must compile
+func PostfixMaps(cfg *config.Config) []string {
+	return []string{
+		filepath.Join(cfg.Paths.Data, "virtual_alias_maps"),
+		filepath.Join(cfg.Paths.Data, "virtual_domains"),
+		filepath.Join(cfg.Paths.Data, "virtual_mailbox_maps"),
+		filepath.Join(cfg.Paths.Data, "sender_canonical_maps"),
+		filepath.Join(cfg.Paths.Data, "recipient_canonical_maps"),
+		filepath.Join(cfg.Paths.Data, "sender_login_maps"),
+		TransportMap,
+		"/etc/postfix/tls_policy.map",
+	}
+}
+
+// WebmailEnabled reports whether a webmail package should be configured:
+// the top-level webmail selection is not "none" and Services.Webmail is
+// set to a non-empty, non-"none" value
+func WebmailEnabled(cfg *config.Config) bool {
+	return cfg.Webmail != "none" && cfg.Services.Webmail != "" && cfg.Services.Webmail != "none"
+}
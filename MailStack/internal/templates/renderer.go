@@ -7,10 +7,12 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
 	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/system"
 )
 
 //go:embed templates/postfix/* templates/dovecot/* templates/rspamd/* templates/nginx/* templates/webmails/**
@@ -26,31 +28,112 @@ func NewRenderer(cfg *config.Config) *Renderer {
 	return &Renderer{config: cfg}
 }
 
+// Source records where a rendered file came from
+type Source struct {
+	Template string   `json:"template"`
+	Origin   string   `json:"origin"`             // "embedded" or the override file used
+	Snippets []string `json:"snippets,omitempty"` // drop-in snippets appended, in order
+}
+
 // Render renders a template file with the given data
 func (r *Renderer) Render(templatePath string) ([]byte, error) {
-	// Read template file from embedded FS
-	content, err := templatesFS.ReadFile(templatePath)
+	content, _, err := r.RenderSource(templatePath)
+	return content, err
+}
+
+// RenderSource renders a template and reports which sources were used.
+// A file with the same relative path in the overrides directory replaces
+// the embedded template, e.g. <overrides>/postfix/main.cf for
+// templates/postfix/main.cf. Every file in <overrides>/postfix/main.cf.d/
+// is then rendered and appended in lexical order.
+func (r *Renderer) RenderSource(templatePath string) ([]byte, *Source, error) {
+	source := &Source{Template: templatePath, Origin: "embedded"}
+	rel := strings.TrimPrefix(templatePath, "templates/")
+
+	// Read the local override if present, else the embedded template
+	var content []byte
+	var err error
+	if r.config.Paths.Overrides != "" {
+		overridePath := filepath.Join(r.config.Paths.Overrides, rel)
+		content, err = os.ReadFile(overridePath)
+		if err == nil {
+			source.Origin = overridePath
+		} else if !os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("failed to read override %s: %w", overridePath, err)
+		}
+	}
+	if source.Origin == "embedded" {
+		content, err = templatesFS.ReadFile(templatePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read template %s: %w", templatePath, err)
+		}
+	}
+
+	label := templatePath
+	if source.Origin != "embedded" {
+		label = source.Origin
+	}
+	out, err := r.execute(label, filepath.Base(templatePath), content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read template %s: %w", templatePath, err)
+		return nil, nil, err
 	}
 
-	// Parse template
-	tmpl, err := template.New(filepath.Base(templatePath)).
-		Funcs(r.getFuncMap()).
-		Parse(string(content))
+	// Append drop-in snippets
+	if r.config.Paths.Overrides != "" {
+		snippets, err := filepath.Glob(filepath.Join(r.config.Paths.Overrides, rel+".d", "*"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list snippets for %s: %w", templatePath, err)
+		}
+		sort.Strings(snippets)
+
+		for _, snippet := range snippets {
+			if info, err := os.Stat(snippet); err != nil || info.IsDir() {
+				continue
+			}
+			snippetContent, err := os.ReadFile(snippet)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read snippet %s: %w", snippet, err)
+			}
+			rendered, err := r.execute(snippet, filepath.Base(snippet), snippetContent)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if len(out) > 0 && out[len(out)-1] != '\n' {
+				out = append(out, '\n')
+			}
+			out = append(out, rendered...)
+			source.Snippets = append(source.Snippets, snippet)
+		}
+	}
+
+	return out, source, nil
+}
+
+// execute parses and renders one template text; label is used in errors
+func (r *Renderer) execute(label, name string, content []byte) ([]byte, error) {
+	tmpl, err := r.parse(name, string(content))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse template %s: %w", templatePath, err)
+		return nil, fmt.Errorf("failed to parse template %s: %w", label, err)
 	}
 
-	// Render template
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, r.getTemplateData()); err != nil {
-		return nil, fmt.Errorf("failed to execute template %s: %w", templatePath, err)
+	if err := tmpl.Execute(&buf, NewData(r.config)); err != nil {
+		return nil, fmt.Errorf("failed to execute template %s: %w", label, err)
 	}
 
 	return buf.Bytes(), nil
 }
 
+// parse parses template text with the renderer's functions. Unknown keys
+// are errors so that a typo breaks rendering instead of the mail server.
+func (r *Renderer) parse(name, text string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=error").
+		Funcs(r.getFuncMap()).
+		Parse(text)
+}
+
 // RenderToFile renders a template and writes it to a file
 func (r *Renderer) RenderToFile(templatePath, outputPath string) error {
 	content, err := r.Render(templatePath)
@@ -58,11 +141,7 @@ func (r *Renderer) RenderToFile(templatePath, outputPath string) error {
 		return err
 	}
 
-	if err := os.WriteFile(outputPath, content, 0644); err != nil {
-		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
-	}
-
-	return nil
+	return system.WriteFile(outputPath, content, FileMode(outputPath))
 }
 
 // ListTemplates returns all available templates
@@ -82,115 +161,6 @@ func ListTemplates(prefix string) ([]string, error) {
 	return templates, err
 }
 
-// getTemplateData prepares data for template rendering
-func (r *Renderer) getTemplateData() map[string]interface{} {
-	// Build hostnames list
-	hostnames := r.config.Hostnames
-	if len(hostnames) == 0 {
-		hostnames = []string{r.config.Hostname}
-	}
-
-	return map[string]interface{}{
-		// Basic domain config
-		"Domain":       r.config.Domain,
-		"Hostname":     r.config.Hostname,
-		"Hostnames":    hostnames,
-		"HostnamesStr": strings.Join(hostnames, ","),
-		"Postmaster":   r.config.Postmaster,
-
-		// Mail settings
-		"MessageSizeLimit":   r.config.Mail.MessageSizeLimit,
-		"MessageRateLimit":   r.config.Mail.MessageRateLimit,
-		"DefaultQuota":       r.config.Mail.DefaultQuota,
-		"RecipientDelimiter": r.config.Mail.RecipientDelimiter,
-		"DKIMSelector":       r.config.Mail.DKIMSelector,
-		"RelayHost":          r.config.Mail.RelayHost,
-		"RelayUser":          r.config.Mail.RelayUser,
-		"RelayPassword":      r.config.Mail.RelayPassword,
-
-		// Network settings
-		"Subnet":        r.config.Network.Subnet,
-		"Subnet6":       r.config.Network.Subnet6,
-		"BindIPv4":      r.config.Network.BindIPv4,
-		"BindIPv6":      r.config.Network.BindIPv6,
-		"RelayNetworks": r.config.Network.RelayNetworks,
-		"RelayNets":     r.config.RelayNets,
-		"RealIPHeader":  r.config.RealIPHeader,
-		"RealIPFrom":    r.config.RealIPFrom,
-
-		// TLS settings
-		"TLSFlavor":     r.config.TLS.Flavor,
-		"TLS":           r.config.TLS.TLS,
-		"TLS443":        r.config.TLS443,
-		"TLSError":      r.config.TLSError,
-		"TLSPermissive": r.config.TLSPermissive,
-
-		// Web paths
-		"AdminPath":       r.config.Web.AdminPath,
-		"WebmailPath":     r.config.Web.WebmailPath,
-		"WebAdmin":        r.config.Web.WebAdmin,
-		"WebWebmail":      r.config.Web.WebWebmail,
-		"WebAPI":          r.config.Web.WebAPI,
-		"Sitename":        r.config.Web.Sitename,
-		"WebrootRedirect": r.config.WebrootRedirect,
-
-		// Data paths (Linux-specific)
-		"DataPath":      r.config.Paths.Data,
-		"MailPath":      r.config.Paths.Mail,
-		"DKIMPath":      r.config.Paths.DKIM,
-		"QueuePath":     r.config.Paths.Queue,
-		"FilterPath":    r.config.Paths.Filter,
-		"CertsPath":     r.config.Paths.Certs,
-		"OverridesPath": r.config.Paths.Overrides,
-
-		// Service addresses
-		"FrontAddress":    r.config.FrontAddress,
-		"AdminAddress":    r.config.AdminAddress,
-		"AntispamAddress": r.config.AntispamAddress,
-		"WebmailAddress":  r.config.WebmailAddress,
-		"WebdavAddress":   r.config.WebdavAddress,
-		"RedisAddress":    r.config.RedisAddress,
-		"Resolver":        r.config.Resolver,
-
-		// Security keys
-		"SecretKey":        r.config.SecretKey,
-		"RoundcubeKey":     r.config.RoundcubeKey,
-		"SnuffleupagusKey": r.config.SnuffleupagusKey,
-
-		// Database
-		"DBDsnw": r.config.Database.DBDsnw,
-
-		// Webmail settings
-		"Webmail":                  r.config.Webmail,
-		"Plugins":                  r.config.Plugins,
-		"Includes":                 r.config.Includes,
-		"PermanentSessionLifetime": r.config.PermanentSessionLifetime,
-		"FullTextSearch":           r.config.FullTextSearch,
-
-		// Additional settings
-		"Timezone":    r.config.Timezone,
-		"MaxFilesize": r.config.MaxFilesize,
-
-		// Port and protocol settings
-		"Port80":           r.config.Port80,
-		"ProxyProtocol25":  r.config.ProxyProtocol25,
-		"ProxyProtocol80":  r.config.ProxyProtocol80,
-		"ProxyProtocol443": r.config.ProxyProtocol443,
-
-		// Feature flags
-		"Admin":           r.config.Admin.Email != "",
-		"API":             r.config.API,
-		"EnableAntivirus": r.config.Services.Antivirus,
-		// Enable webmail when both top-level webmail selection is not "none"
-		// and Services.Webmail is set to a non-empty/non-"none" value.
-		"EnableWebmail":   (r.config.Webmail != "none" && r.config.Services.Webmail != "" && r.config.Services.Webmail != "none"),
-		"EnableFetchmail": r.config.Services.Fetchmail,
-		"EnableWebdav":    r.config.Services.Webdav,
-		"EnableOletools":  r.config.EnableOletools,
-		"Webdav":          r.config.Services.Webdav,
-	}
-}
-
 // getFuncMap returns custom template functions
 func (r *Renderer) getFuncMap() template.FuncMap {
 	return template.FuncMap{
@@ -221,17 +191,31 @@ func (r *Renderer) getFuncMap() template.FuncMap {
 			}
 			return value
 		},
+		// SQL that differs between the database backends, for the
+		// postfix and dovecot lookups
+		"sqlConcat": func(parts ...string) string {
+			if r.config.DatabaseDriver() == "mysql" {
+				return "CONCAT(" + strings.Join(parts, ", ") + ")"
+			}
+			return strings.Join(parts, " || ")
+		},
+		"sqlInstr": func(s, substr string) string {
+			if r.config.DatabaseDriver() == "pgsql" {
+				return "STRPOS(" + s + ", " + substr + ")"
+			}
+			return "INSTR(" + s + ", " + substr + ")"
+		},
 		// Math functions
-		"add": func(a, b int) int {
+		"add": func(a, b int64) int64 {
 			return a + b
 		},
-		"sub": func(a, b int) int {
+		"sub": func(a, b int64) int64 {
 			return a - b
 		},
-		"mul": func(a, b int) int {
+		"mul": func(a, b int64) int64 {
 			return a * b
 		},
-		"div": func(a, b int) int {
+		"div": func(a, b int64) int64 {
 			if b == 0 {
 				return 0
 			}
@@ -244,16 +228,16 @@ func (r *Renderer) getFuncMap() template.FuncMap {
 		"ne": func(a, b interface{}) bool {
 			return a != b
 		},
-		"lt": func(a, b int) bool {
+		"lt": func(a, b int64) bool {
 			return a < b
 		},
-		"le": func(a, b int) bool {
+		"le": func(a, b int64) bool {
 			return a <= b
 		},
-		"gt": func(a, b int) bool {
+		"gt": func(a, b int64) bool {
 			return a > b
 		},
-		"ge": func(a, b int) bool {
+		"ge": func(a, b int64) bool {
 			return a >= b
 		},
 		// Index function for arrays
@@ -0,0 +1,281 @@
+package templates
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/database"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	cfg, err := config.Load(filepath.Join("testdata", "config.json"))
+	if err != nil {
+		t.Fatalf("failed to load test config: %v", err)
+	}
+	return cfg
+}
+
+// TestRenderGolden renders every embedded template and compares it with
+// testdata/golden. Run `go test ./internal/templates -update` after an
+// intentional template change.
+func TestRenderGolden(t *testing.T) {
+	renderer := NewRenderer(loadTestConfig(t))
+
+	paths, err := ListTemplates("templates")
+	if err != nil {
+		t.Fatalf("ListTemplates: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no embedded templates found")
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimPrefix(path, "templates/"), func(t *testing.T) {
+			got, err := renderer.Render(path)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "golden", strings.TrimPrefix(path, "templates/")+".golden")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file (run with -update): %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("rendered output differs from %s (run with -update if intended)", golden)
+			}
+			if bytes.Contains(got, []byte("<no value>")) {
+				t.Errorf("rendered output contains <no value>")
+			}
+		})
+	}
+}
+
+func TestManifestTemplatesExist(t *testing.T) {
+	for _, target := range Manifest(loadTestConfig(t)) {
+		if _, err := templatesFS.ReadFile(target.Template); err != nil {
+			t.Errorf("manifest references missing template %s", target.Template)
+		}
+	}
+}
+
+func TestRenderUnknownFieldFails(t *testing.T) {
+	cfg := loadTestConfig(t)
+
+	tmpl, err := NewRenderer(cfg).parse("typo", "{{ .Pathz.Data }}")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, NewData(cfg)); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestRenderOverrideAndSnippets(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Paths.Overrides = t.TempDir()
+
+	write := func(rel, content string) {
+		path := filepath.Join(cfg.Paths.Overrides, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("postfix/main.cf", "mydomain = {{ .Domain }}")
+	write("postfix/main.cf.d/20-late.cf", "late = yes\n")
+	write("postfix/main.cf.d/10-early.cf", "early = {{ .Hostname }}\n")
+
+	got, source, err := NewRenderer(cfg).RenderSource("templates/postfix/main.cf")
+	if err != nil {
+		t.Fatalf("RenderSource: %v", err)
+	}
+
+	want := "mydomain = " + cfg.Domain + "\nearly = " + cfg.Hostname + "\nlate = yes\n"
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if source.Origin != filepath.Join(cfg.Paths.Overrides, "postfix/main.cf") {
+		t.Errorf("unexpected origin %q", source.Origin)
+	}
+	if len(source.Snippets) != 2 || filepath.Base(source.Snippets[0]) != "10-early.cf" {
+		t.Errorf("unexpected snippets %v", source.Snippets)
+	}
+}
+
+func TestRenderDatabaseBackends(t *testing.T) {
+	tests := []struct {
+		dbType   string
+		template string
+		want     []string
+	}{
+		{"sqlite", "templates/postfix/main.cf", []string{"virtual_mailbox_maps = sqlite:/etc/postfix/sql-virtual-mailbox-maps.cf"}},
+		{"mysql", "templates/postfix/main.cf", []string{"virtual_mailbox_maps = mysql:/etc/postfix/sql-virtual-mailbox-maps.cf"}},
+		{"postgresql", "templates/postfix/main.cf", []string{"virtual_mailbox_maps = pgsql:/etc/postfix/sql-virtual-mailbox-maps.cf"}},
+		{"mysql", "templates/postfix/sql-virtual-alias-maps.cf", []string{
+			"hosts = inet:db.example.com:3306", "user = mailstack", "password = s3cret", "dbname = mail",
+			"SUBSTR('%u', 1, INSTR(CONCAT('%u', '+'), '+') - 1)", "CONCAT('%u@', d.name)", ") AS matches ORDER BY",
+		}},
+		{"postgres", "templates/postfix/sql-virtual-alias-maps.cf", []string{
+			"hosts = inet:db.example.com:5432", "STRPOS('%u' || '+', '+')", "'%u@' || d.name",
+		}},
+		{"mariadb", "templates/postfix/sql-virtual-forward-maps.cf", []string{"CONCAT(email, ',', forward_destination)"}},
+		{"mysql", "templates/dovecot/dovecot-sql.conf.ext", []string{
+			"driver = mysql",
+			"connect = host=db.example.com port=3306 dbname=mail user=mailstack password=s3cret",
+			"CONCAT('/var/lib/mailstack/mail/', SUBSTR(email, INSTR(email, '@') + 1), '/', SUBSTR(email, 1, INSTR(email, '@') - 1)) as home",
+			"CONCAT('*:storage=', quota_bytes) as quota_rule",
+		}},
+		{"postgresql", "templates/dovecot/dovecot-sql-tokens.conf.ext", []string{"driver = pgsql", "connect = host=db.example.com port=5432"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dbType+"/"+filepath.Base(tt.template), func(t *testing.T) {
+			cfg := loadTestConfig(t)
+			cfg.Database = config.DatabaseConfig{
+				Type:     tt.dbType,
+				Host:     "db.example.com",
+				Name:     "mail",
+				User:     "mailstack",
+				Password: "s3cret",
+			}
+			// Reload, so that the database defaults apply
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := cfg.Save(path); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			cfg, err := config.Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			got, err := NewRenderer(cfg).Render(tt.template)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("output lacks %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestPostfixMapsQuerySQLite runs the rendered postfix lookups against a
+// real database, expanding %s, %u and %d the way postfix does
+func TestPostfixMapsQuerySQLite(t *testing.T) {
+	cfg := loadTestConfig(t)
+	cfg.Database.Path = filepath.Join(t.TempDir(), "mailstack.db")
+	cfg.Database.DSN = ""
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	for _, step := range []error{
+		db.AddDomain("example.com"),
+		db.AddUser("alice@example.com", "Tr0ub4dor&3x", 0),
+		db.AddUser("bob@example.com", "Tr0ub4dor&3x", 0),
+		db.AddAlias("info@example.com", "alice@example.com", ""),
+		db.AddAlias("%@example.com", "bob@example.com", ""),
+		db.AddAlternative("example.net", "example.com"),
+		db.SetForward("bob@example.com", "bob@elsewhere.org", true),
+		db.AddUser("carol@example.com", "Tr0ub4dor&3x", 0),
+		db.SetForward("carol@example.com", "carol@elsewhere.org,team@elsewhere.org", false),
+		db.AddUser("dave@example.com", "Tr0ub4dor&3x", 0),
+		db.SetForward("dave@example.com", "dave@elsewhere.org", true),
+		db.ClearForward("dave@example.com"),
+		db.AddUser("erin@example.com", "Tr0ub4dor&3x", 0),
+		db.SetForward("erin@example.com", "erin@elsewhere.org", false),
+		db.UpdateUser("erin@example.com", database.UserUpdate{Enabled: database.Ptr(false)}),
+		db.AddRelay("backup.org", "", ""),
+	} {
+		if step != nil {
+			t.Fatalf("setup: %v", step)
+		}
+	}
+
+	conn, err := sql.Open("sqlite3", cfg.Database.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	renderer := NewRenderer(cfg)
+	tests := []struct {
+		template string
+		key      string
+		want     string // "" when the lookup finds nothing
+	}{
+		{"sql-virtual-mailbox-domains.cf", "example.com", "example.com"},
+		{"sql-virtual-mailbox-domains.cf", "example.net", "example.net"},
+		{"sql-virtual-mailbox-domains.cf", "example.org", ""},
+		{"sql-virtual-mailbox-maps.cf", "alice@example.com", "alice@example.com"},
+		{"sql-virtual-mailbox-maps.cf", "frank@example.com", ""},
+		{"sql-virtual-alias-maps.cf", "alice@example.com", "alice@example.com"},
+		{"sql-virtual-alias-maps.cf", "info@example.com", "alice@example.com"},
+		{"sql-virtual-alias-maps.cf", "frank@example.com", "bob@example.com"},
+		{"sql-virtual-alias-maps.cf", "alice+tag@example.com", ""},
+		{"sql-virtual-alias-maps.cf", "alice@example.net", "alice@example.com"},
+		{"sql-virtual-forward-maps.cf", "bob@example.com", "bob@example.com,bob@elsewhere.org"},
+		{"sql-virtual-forward-maps.cf", "alice@example.com", ""},
+		{"sql-virtual-forward-maps.cf", "carol@example.com", "carol@elsewhere.org,team@elsewhere.org"},
+		{"sql-virtual-forward-maps.cf", "dave@example.com", ""},
+		{"sql-virtual-forward-maps.cf", "erin@example.com", ""},
+		{"sql-virtual-forward-maps.cf", "info@example.com", ""},
+		{"sql-sender-login-maps.cf", "alice@example.net", "alice@example.com"},
+		{"sql-relay-domains.cf", "backup.org", "backup.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template+"/"+tt.key, func(t *testing.T) {
+			out, err := renderer.Render("templates/postfix/" + tt.template)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			_, query, ok := strings.Cut(string(out), "\nquery = ")
+			if !ok {
+				t.Fatalf("no query in %s", tt.template)
+			}
+			local, domain, _ := strings.Cut(tt.key, "@")
+			query = strings.NewReplacer("%s", tt.key, "%u", local, "%d", domain).Replace(query)
+
+			var got string
+			err = conn.QueryRow(query).Scan(&got)
+			if err != nil && err != sql.ErrNoRows {
+				t.Fatalf("query failed: %v\n%s", err, query)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mailstack/mailstack/internal/config"
+	"github.com/mailstack/mailstack/internal/system"
+)
+
+// SourcesPath returns the file recording which source each installed
+// configuration file was rendered from
+func SourcesPath(cfg *config.Config) string {
+	return filepath.Join(cfg.Paths.Data, "config-sources.json")
+}
+
+// SaveSources writes the source record, keyed by output path
+func SaveSources(path string, sources map[string]*Source) error {
+	data, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config sources: %w", err)
+	}
+	return system.WriteFile(path, data, 0644)
+}
+
+// LoadSources reads the source record, keyed by output path
+func LoadSources(path string) (map[string]*Source, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config sources: %w", err)
+	}
+
+	sources := make(map[string]*Source)
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, fmt.Errorf("failed to parse config sources: %w", err)
+	}
+	return sources, nil
+}
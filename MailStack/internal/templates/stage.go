@@ -0,0 +1,101 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// StagedFile is a template rendered into a staging directory
+type StagedFile struct {
+	Target
+	Path    string  // location of the rendered file inside the staging directory
+	Changed bool    // content differs from (or is missing at) Target.Output
+	Source  *Source // override or embedded template and snippets used
+}
+
+// Stage renders targets beneath stagingDir, mirroring their absolute output
+// paths, and records which ones differ from the files currently on disk
+func (r *Renderer) Stage(targets []Target, stagingDir string) ([]StagedFile, error) {
+	var staged []StagedFile
+
+	for _, target := range targets {
+		content, source, err := r.RenderSource(target.Template)
+		if err != nil {
+			return nil, err
+		}
+
+		path := filepath.Join(stagingDir, target.Output)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		// Staged with the mode of the installed file, so that a secret is
+		// no easier to read in the staging directory than in place
+		mode := FileMode(target.Output)
+		if info, err := os.Stat(target.Output); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := writeStaged(path, content, mode); err != nil {
+			return nil, fmt.Errorf("failed to write staged file %s: %w", path, err)
+		}
+
+		current, err := os.ReadFile(target.Output)
+		changed := err != nil || !bytes.Equal(current, content)
+
+		staged = append(staged, StagedFile{
+			Target:  target,
+			Path:    path,
+			Changed: changed,
+			Source:  source,
+		})
+	}
+
+	return staged, nil
+}
+
+// writeStaged writes content with exactly mode, also over a file left in
+// a reused staging directory and whatever the umask
+func writeStaged(path string, content []byte, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Secret reports whether the file holds passwords or keys
+func (f StagedFile) Secret() bool {
+	_, ok := secretFiles[f.Output]
+	return ok
+}
+
+// Diff returns a unified diff from the installed file to the staged one.
+// A missing installed file is treated as empty. The content of secret
+// files is not shown.
+func (f StagedFile) Diff() (string, error) {
+	if f.Secret() {
+		return fmt.Sprintf("%s: changed (content redacted)\n", f.Output), nil
+	}
+	cmd := exec.Command("diff", "-u", "-N",
+		"--label", f.Output, "--label", f.Output+" (rendered)",
+		f.Output, f.Path)
+	output, err := cmd.Output()
+	if err != nil {
+		// diff exits with 1 when the files differ
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return string(output), nil
+		}
+		return "", fmt.Errorf("failed to diff %s: %w", f.Output, err)
+	}
+	return string(output), nil
+}
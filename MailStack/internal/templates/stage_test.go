@@ -0,0 +1,68 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStageModesAndRedaction(t *testing.T) {
+	// An installed file that is not in the manifest's secrets keeps its mode
+	installed := filepath.Join(t.TempDir(), "private.cf")
+	if err := os.WriteFile(installed, []byte("old\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		target     Target
+		wantMode   os.FileMode
+		wantSecret bool
+	}{
+		{name: "secret", target: Target{Template: "templates/postfix/sasl_passwd", Output: "/etc/postfix/sasl_passwd"}, wantMode: 0600, wantSecret: true},
+		{name: "group secret", target: Target{Template: "templates/dovecot/dovecot-sql.conf.ext", Output: "/etc/dovecot/dovecot-sql.conf.ext"}, wantMode: 0640, wantSecret: true},
+		{name: "plain", target: Target{Template: "templates/postfix/master.cf", Output: "/etc/postfix/master.cf"}, wantMode: 0644},
+		{name: "installed", target: Target{Template: "templates/postfix/master.cf", Output: installed}, wantMode: 0640},
+	}
+
+	renderer := NewRenderer(loadTestConfig(t))
+	stagingDir := t.TempDir()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Staging twice checks that a reused staging directory gets
+			// the mode too
+			for range 2 {
+				staged, err := renderer.Stage([]Target{tt.target}, stagingDir)
+				if err != nil {
+					t.Fatalf("Stage: %v", err)
+				}
+				file := staged[0]
+
+				info, err := os.Stat(file.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != tt.wantMode {
+					t.Errorf("staged mode = %v, want %v", info.Mode().Perm(), tt.wantMode)
+				}
+				if file.Secret() != tt.wantSecret {
+					t.Errorf("Secret() = %v, want %v", file.Secret(), tt.wantSecret)
+				}
+
+				diff, err := file.Diff()
+				if err != nil {
+					t.Fatalf("Diff: %v", err)
+				}
+				redacted := strings.Contains(diff, "changed (content redacted)")
+				if redacted != tt.wantSecret {
+					t.Errorf("diff redacted = %v, want %v:\n%s", redacted, tt.wantSecret, diff)
+				}
+				if err := os.Chmod(file.Path, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}